@@ -0,0 +1,140 @@
+package subtree
+
+import (
+	"fmt"
+
+	"github.com/bsv-blockchain/go-bt/v2"
+	safe "github.com/bsv-blockchain/go-safe-conversion"
+)
+
+// CoinbasePolicy determines whether the coinbase transaction is written to a subtree
+// data file, when the subtree starts with the coinbase placeholder.
+//
+// The readers accept data files both with and without the coinbase transaction, and
+// set the policy of the Data they return to match the file they read.
+type CoinbasePolicy uint8
+
+const (
+	// CoinbaseOmit does not write a transaction for the coinbase placeholder. This is the default.
+	CoinbaseOmit CoinbasePolicy = iota
+	// CoinbaseInclude writes the coinbase transaction attached to the data in place of the
+	// coinbase placeholder, see Data.SetCoinbaseTx.
+	CoinbaseInclude
+)
+
+// String returns a string representation of the coinbase policy.
+func (p CoinbasePolicy) String() string {
+	switch p {
+	case CoinbaseOmit:
+		return "omit"
+	case CoinbaseInclude:
+		return "include"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(p))
+	}
+}
+
+// HasCoinbasePlaceholder returns whether the first node of the subtree is the coinbase placeholder.
+func (st *Subtree) HasCoinbasePlaceholder() bool {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	return len(st.Nodes) > 0 && st.Nodes[0].Hash.Equal(CoinbasePlaceholderHashValue)
+}
+
+// ReplaceCoinbasePlaceholder replaces the coinbase placeholder node of the subtree with
+// a node for the given coinbase transaction, and returns the new root hash. The node
+// gets the size of the coinbase transaction and no fee, the subtree totals are updated
+// accordingly.
+//
+// Parameters:
+//   - coinbaseTx: The coinbase transaction of the block
+//
+// Returns:
+//   - error: An error if the transaction is not a coinbase or the subtree does not start with the placeholder
+func (st *Subtree) ReplaceCoinbasePlaceholder(coinbaseTx *bt.Tx) error {
+	if coinbaseTx == nil || !coinbaseTx.IsCoinbase() {
+		return ErrNotCoinbaseTx
+	}
+
+	size, err := safe.IntToUint64(coinbaseTx.Size())
+	if err != nil {
+		return fmt.Errorf("unable to get size of coinbase transaction: %w", err)
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if len(st.Nodes) == 0 || !st.Nodes[0].Hash.Equal(CoinbasePlaceholderHashValue) {
+		return ErrNoCoinbasePlaceholder
+	}
+
+	st.SizeInBytes = st.SizeInBytes - st.Nodes[0].SizeInBytes + size
+	st.Fees -= st.Nodes[0].Fee
+
+	st.Nodes[0] = Node{
+		Hash:        *coinbaseTx.TxIDChainHash(),
+		SizeInBytes: size,
+	}
+	st.rootHash = nil // reset rootHash
+
+	if st.nodeIndex != nil {
+		delete(st.nodeIndex, CoinbasePlaceholderHashValue)
+		st.nodeIndex[st.Nodes[0].Hash] = 0
+	}
+
+	return nil
+}
+
+// SetCoinbaseTx attaches the coinbase transaction of the block to the subtree data, at
+// index 0. The subtree must start with the coinbase placeholder, or with a node for the
+// coinbase transaction itself. An already attached coinbase transaction is replaced.
+//
+// Attaching the coinbase transaction does not change how the data is written, set
+// CoinbasePolicy to CoinbaseInclude to write it in place of the placeholder.
+//
+// Parameters:
+//   - coinbaseTx: The coinbase transaction of the block
+//
+// Returns:
+//   - error: An error if the transaction is not a coinbase or does not belong at index 0 of the subtree
+func (s *Data) SetCoinbaseTx(coinbaseTx *bt.Tx) error {
+	if coinbaseTx == nil || !coinbaseTx.IsCoinbase() {
+		return ErrNotCoinbaseTx
+	}
+
+	if len(s.Txs) == 0 || s.Subtree.Length() == 0 {
+		return ErrSubtreeNodesEmpty
+	}
+
+	if !s.Subtree.HasCoinbasePlaceholder() && !s.Subtree.Nodes[0].Hash.Equal(*coinbaseTx.TxIDChainHash()) {
+		return fmt.Errorf("%w at index 0", ErrTxHashMismatch)
+	}
+
+	s.Txs[0] = coinbaseTx
+	s.markFilled(0)
+
+	return nil
+}
+
+// CoinbaseTx returns the coinbase transaction attached to the data, or nil if it has
+// not been attached.
+func (s *Data) CoinbaseTx() *bt.Tx {
+	if len(s.Txs) == 0 || s.Txs[0] == nil || !s.Txs[0].IsCoinbase() {
+		return nil
+	}
+
+	return s.Txs[0]
+}
+
+// omitsTx returns whether the transaction at index is not written to the data file,
+// which is only the case for the coinbase placeholder with the CoinbaseOmit policy.
+func (s *Data) omitsTx(index int) bool {
+	return index == 0 && s.CoinbasePolicy == CoinbaseOmit && s.Subtree.HasCoinbasePlaceholder()
+}
+
+// isCoinbaseAt returns whether tx is the coinbase transaction written in place of the
+// coinbase placeholder of the subtree, at the given index.
+func isCoinbaseAt(subtree *Subtree, index int, tx *bt.Tx) bool {
+	return index == 0 && tx.IsCoinbase() && subtree.HasCoinbasePlaceholder()
+}
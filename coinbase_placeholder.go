@@ -35,6 +35,9 @@ var (
 	FrozenBytesTxHash = chainhash.Hash(FrozenBytesTxBytes)
 )
 
+// coinbasePlaceholderTxHash is the txid of the coinbase placeholder transaction.
+var coinbasePlaceholderTxHash = *generateCoinbasePlaceholderTx().TxIDChainHash()
+
 func generateCoinbasePlaceholderTx() *bt.Tx {
 	tx := bt.NewTx()
 	tx.Version = 0xFFFFFFFF
@@ -45,9 +48,9 @@ func generateCoinbasePlaceholderTx() *bt.Tx {
 
 // IsCoinbasePlaceHolderTx checks if the given transaction is a coinbase placeholder transaction.
 func IsCoinbasePlaceHolderTx(tx *bt.Tx) bool {
-	coinbasePlaceholderTx := generateCoinbasePlaceholderTx()
-
-	coinbasePlaceholderTxHash := coinbasePlaceholderTx.TxIDChainHash()
+	if tx == nil {
+		return false
+	}
 
-	return tx.TxIDChainHash().IsEqual(coinbasePlaceholderTxHash)
+	return tx.TxIDChainHash().Equal(coinbasePlaceholderTxHash)
 }
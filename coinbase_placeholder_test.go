@@ -15,5 +15,6 @@ func TestCoinbasePlaceholderTx(t *testing.T) {
 	assert.Equal(t, uint32(0xFFFFFFFF), coinbasePlaceholderTx.LockTime)
 	assert.Equal(t, coinbasePlaceholderTxHash, coinbasePlaceholderTx.TxIDChainHash())
 	assert.False(t, IsCoinbasePlaceHolderTx(bt.NewTx()))
+	assert.False(t, IsCoinbasePlaceHolderTx(nil))
 	assert.Equal(t, "a8502e9c08b3c851201a71d25bf29fd38a664baedb777318b12d19242f0e46ab", coinbasePlaceholderTx.TxIDChainHash().String())
 }
@@ -0,0 +1,284 @@
+package subtree
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoinbasePolicyString(t *testing.T) {
+	assert.Equal(t, "omit", CoinbaseOmit.String())
+	assert.Equal(t, "include", CoinbaseInclude.String())
+	assert.Equal(t, "unknown(7)", CoinbasePolicy(7).String())
+}
+
+func TestSubtreeHasCoinbasePlaceholder(t *testing.T) {
+	st, err := NewTree(2)
+	require.NoError(t, err)
+	assert.False(t, st.HasCoinbasePlaceholder())
+
+	require.NoError(t, st.AddCoinbaseNode())
+	assert.True(t, st.HasCoinbasePlaceholder())
+
+	subtree, _, _ := setupTestSubtreeData(t)
+	assert.False(t, subtree.HasCoinbasePlaceholder())
+}
+
+func TestSubtreeReplaceCoinbasePlaceholder(t *testing.T) {
+	t.Run("replace placeholder", func(t *testing.T) {
+		subtree, _, txs := setupCoinbaseTestSubtreeData(t)
+
+		// build the node index before replacing
+		require.Equal(t, 0, subtree.NodeIndex(CoinbasePlaceholderHashValue))
+
+		expected := subtree.Duplicate()
+		expectedRoot := expected.ReplaceRootNode(coinbaseTx.TxIDChainHash(), 0, uint64(coinbaseTx.Size())) //nolint:gosec // G115: test data
+
+		sizeInBytes := subtree.SizeInBytes
+
+		require.NoError(t, subtree.ReplaceCoinbasePlaceholder(coinbaseTx))
+
+		assert.False(t, subtree.HasCoinbasePlaceholder())
+		assert.Equal(t, expectedRoot, subtree.RootHash())
+		assert.Equal(t, sizeInBytes+uint64(coinbaseTx.Size()), subtree.SizeInBytes) //nolint:gosec // G115: test data
+		assert.Equal(t, 0, subtree.NodeIndex(*coinbaseTx.TxIDChainHash()))
+		assert.Equal(t, -1, subtree.NodeIndex(CoinbasePlaceholderHashValue))
+		assert.Equal(t, 1, subtree.NodeIndex(*txs[0].TxIDChainHash()))
+
+		require.ErrorIs(t, subtree.ReplaceCoinbasePlaceholder(coinbaseTx), ErrNoCoinbasePlaceholder)
+	})
+
+	t.Run("not a coinbase", func(t *testing.T) {
+		subtree, _, txs := setupCoinbaseTestSubtreeData(t)
+
+		require.ErrorIs(t, subtree.ReplaceCoinbasePlaceholder(txs[0]), ErrNotCoinbaseTx)
+		require.ErrorIs(t, subtree.ReplaceCoinbasePlaceholder(nil), ErrNotCoinbaseTx)
+		assert.True(t, subtree.HasCoinbasePlaceholder())
+	})
+
+	t.Run("data of the replaced subtree contains the coinbase", func(t *testing.T) {
+		subtree, data, txs := setupCoinbaseTestSubtreeData(t)
+
+		require.NoError(t, subtree.ReplaceCoinbasePlaceholder(coinbaseTx))
+		require.NoError(t, data.AddTx(coinbaseTx, 0))
+
+		b, err := data.Serialize()
+		require.NoError(t, err)
+
+		expected := coinbaseTx.Bytes()
+		for _, tx := range txs {
+			expected = append(expected, tx.ExtendedBytes()...)
+		}
+
+		assert.Equal(t, expected, b)
+
+		readData, err := NewSubtreeDataFromBytes(subtree, b)
+		require.NoError(t, err)
+		assert.Equal(t, coinbaseTx.TxID(), readData.CoinbaseTx().TxID())
+	})
+}
+
+func TestDataSetCoinbaseTx(t *testing.T) {
+	t.Run("attach to placeholder", func(t *testing.T) {
+		_, data, _ := setupCoinbaseTestSubtreeData(t)
+		assert.Nil(t, data.CoinbaseTx())
+
+		require.NoError(t, data.SetCoinbaseTx(coinbaseTx))
+		assert.Same(t, coinbaseTx, data.CoinbaseTx())
+		assert.True(t, data.Has(0))
+
+		// replacing the attached coinbase is allowed
+		otherCoinbase := coinbaseTx.Clone()
+		otherCoinbase.LockTime++
+
+		require.NoError(t, data.SetCoinbaseTx(otherCoinbase))
+		assert.Same(t, otherCoinbase, data.CoinbaseTx())
+	})
+
+	t.Run("attach to replaced placeholder", func(t *testing.T) {
+		subtree, data, _ := setupCoinbaseTestSubtreeData(t)
+		require.NoError(t, subtree.ReplaceCoinbasePlaceholder(coinbaseTx))
+
+		require.NoError(t, data.SetCoinbaseTx(coinbaseTx))
+
+		otherCoinbase := coinbaseTx.Clone()
+		otherCoinbase.LockTime++
+
+		require.ErrorIs(t, data.SetCoinbaseTx(otherCoinbase), ErrTxHashMismatch)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, data, txs := setupCoinbaseTestSubtreeData(t)
+		require.ErrorIs(t, data.SetCoinbaseTx(txs[0]), ErrNotCoinbaseTx)
+
+		_, data, _ = setupTestSubtreeData(t)
+		require.ErrorIs(t, data.SetCoinbaseTx(coinbaseTx), ErrTxHashMismatch)
+		assert.Nil(t, data.CoinbaseTx())
+
+		st, err := NewTree(1)
+		require.NoError(t, err)
+		require.ErrorIs(t, NewSubtreeData(st).SetCoinbaseTx(coinbaseTx), ErrSubtreeNodesEmpty)
+	})
+}
+
+func TestDataCoinbasePolicy(t *testing.T) {
+	t.Run("include requires the coinbase", func(t *testing.T) {
+		_, data, _ := setupCoinbaseTestSubtreeData(t)
+		data.CoinbasePolicy = CoinbaseInclude
+
+		_, err := data.Serialize()
+		require.ErrorIs(t, err, ErrCoinbaseTxMissing)
+
+		err = data.WriteTransactionsToWriter(&bytes.Buffer{}, 0, 4)
+		require.ErrorIs(t, err, ErrCoinbaseTxMissing)
+	})
+
+	tests := []struct {
+		name   string
+		policy CoinbasePolicy
+	}{
+		{name: "omit", policy: CoinbaseOmit},
+		{name: "include", policy: CoinbaseInclude},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+" is handled the same by all readers and writers", func(t *testing.T) {
+			subtree, data, txs := setupCoinbaseTestSubtreeData(t)
+			require.NoError(t, data.SetCoinbaseTx(coinbaseTx))
+
+			data.CoinbasePolicy = tt.policy
+
+			var expected []byte
+			if tt.policy == CoinbaseInclude {
+				expected = coinbaseTx.Bytes()
+			}
+
+			for _, tx := range txs {
+				expected = append(expected, tx.ExtendedBytes()...)
+			}
+
+			b, index, err := data.SerializeWithIndex()
+			require.NoError(t, err)
+			assert.Equal(t, expected, b)
+
+			buf := &bytes.Buffer{}
+			require.NoError(t, data.WriteTransactionsToWriter(buf, 0, 4))
+			assert.Equal(t, expected, buf.Bytes())
+
+			expectedCoinbase := (*chainhash.Hash)(nil)
+			if tt.policy == CoinbaseInclude {
+				expectedCoinbase = coinbaseTx.TxIDChainHash()
+			}
+
+			checkData := func(t *testing.T, readData *Data) {
+				t.Helper()
+
+				assert.Equal(t, tt.policy, readData.CoinbasePolicy)
+				assert.Equal(t, DataEncodingExtended, readData.Encoding)
+
+				if expectedCoinbase == nil {
+					assert.Nil(t, readData.CoinbaseTx())
+				} else {
+					assert.Equal(t, *expectedCoinbase, *readData.CoinbaseTx().TxIDChainHash())
+				}
+
+				// written back the same way it was read
+				b2, err := readData.Serialize()
+				require.NoError(t, err)
+				assert.Equal(t, b, b2)
+			}
+
+			readData, err := NewSubtreeDataFromBytes(subtree, b)
+			require.NoError(t, err)
+			checkData(t, readData)
+
+			readData, err = NewSubtreeDataFromBytesParallel(subtree, b, 2)
+			require.NoError(t, err)
+			checkData(t, readData)
+
+			readData = NewSubtreeData(subtree)
+			n, err := readData.ReadTransactionsFromReader(bytes.NewReader(b), 0, 4)
+			require.NoError(t, err)
+			if tt.policy == CoinbaseInclude {
+				assert.Equal(t, len(txs)+1, n)
+			} else {
+				assert.Equal(t, len(txs), n)
+			}
+			checkData(t, readData)
+
+			chunk, err := ReadTransactionChunk(bytes.NewReader(b), subtree, 0, 4)
+			require.NoError(t, err)
+
+			if tt.policy == CoinbaseInclude {
+				require.Len(t, chunk, 4)
+				assert.True(t, chunk[0].IsCoinbase())
+			} else {
+				require.Len(t, chunk, 3)
+			}
+
+			indexedReader, err := NewIndexedDataReader(subtree, bytes.NewReader(b), index)
+			require.NoError(t, err)
+
+			cb, err := indexedReader.TxAt(0)
+			if tt.policy == CoinbaseInclude {
+				require.NoError(t, err)
+				assert.True(t, cb.IsCoinbase())
+			} else {
+				require.ErrorIs(t, err, ErrTxNotInData)
+			}
+
+			metaBuf := &bytes.Buffer{}
+			require.NoError(t, WriteSubtreeMetaFromData(metaBuf, subtree, bytes.NewReader(b)))
+		})
+	}
+
+	t.Run("chunked reads", func(t *testing.T) {
+		subtree, data, txs := setupCoinbaseTestSubtreeData(t)
+		require.NoError(t, data.SetCoinbaseTx(coinbaseTx))
+
+		data.CoinbasePolicy = CoinbaseInclude
+
+		buf := &bytes.Buffer{}
+		require.NoError(t, data.WriteTransactionsToWriter(buf, 0, 2))
+		require.NoError(t, data.WriteTransactionsToWriter(buf, 2, 4))
+
+		readData := NewSubtreeData(subtree)
+
+		n, err := readData.ReadTransactionsFromReader(buf, 0, 2)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+
+		n, err = readData.ReadTransactionsFromReader(buf, 2, 4)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+
+		assert.True(t, readData.IsComplete())
+		assert.Equal(t, CoinbaseInclude, readData.CoinbasePolicy)
+		assert.Equal(t, txs[2].TxID(), readData.Txs[3].TxID())
+	})
+
+	t.Run("merge and split keep the policy", func(t *testing.T) {
+		_, data, _ := setupCoinbaseTestSubtreeData(t)
+		require.NoError(t, data.SetCoinbaseTx(coinbaseTx))
+
+		data.CoinbasePolicy = CoinbaseInclude
+
+		parts, err := SplitData(data, 2)
+		require.NoError(t, err)
+		assert.Equal(t, CoinbaseInclude, parts[0].CoinbasePolicy)
+
+		merged, err := MergeData(parts[0], parts[1])
+		require.NoError(t, err)
+		assert.Equal(t, CoinbaseInclude, merged.CoinbasePolicy)
+
+		b, err := merged.Serialize()
+		require.NoError(t, err)
+
+		expected, err := data.Serialize()
+		require.NoError(t, err)
+		assert.Equal(t, expected, b)
+	})
+}
@@ -0,0 +1,298 @@
+package subtree
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+)
+
+// PackageFee holds the aggregated fee and size of a package of dependent transactions.
+type PackageFee struct {
+	// Fee is the sum of the fees of all transactions in the package
+	Fee uint64
+	// SizeInBytes is the sum of the sizes of all transactions in the package
+	SizeInBytes uint64
+	// Count is the number of transactions in the package
+	Count int
+}
+
+// FeeRate returns the fee rate of the package in satoshis per byte, 0 for an empty package.
+func (p PackageFee) FeeRate() float64 {
+	if p.SizeInBytes == 0 {
+		return 0
+	}
+
+	return float64(p.Fee) / float64(p.SizeInBytes)
+}
+
+// DependencyGraph is the graph of parent / child relations between the transactions
+// of one or more subtrees, built from the ParentTxHashes in their Meta. Only relations
+// between transactions that are both in the graph are recorded.
+//
+// Transactions are numbered in the order they appear in the metas, which is the
+// block order, and all returned slices of hashes are in that order.
+type DependencyGraph struct {
+	hashes    []chainhash.Hash
+	positions []nodePosition
+	fees      []uint64
+	sizes     []uint64
+	parents   [][]int
+	children  [][]int
+	index     map[chainhash.Hash]int
+}
+
+// NewDependencyGraph builds a DependencyGraph from the given metas. The coinbase
+// placeholder is not part of the graph.
+//
+// Parameters:
+//   - metas: The Meta objects of the subtrees, in block order
+//
+// Returns:
+//   - *DependencyGraph: The dependency graph of all transactions in the subtrees
+//   - error: An error if a meta or its subtree is not set
+func NewDependencyGraph(metas ...*Meta) (*DependencyGraph, error) {
+	total := 0
+
+	for i, meta := range metas {
+		if meta == nil {
+			return nil, fmt.Errorf("meta %d: %w", i, ErrSubtreeMetaNil)
+		}
+
+		if meta.Subtree == nil {
+			return nil, fmt.Errorf("meta %d: %w", i, ErrSubtreeNil)
+		}
+
+		total += len(meta.Subtree.Nodes)
+	}
+
+	g := &DependencyGraph{
+		hashes:    make([]chainhash.Hash, 0, total),
+		positions: make([]nodePosition, 0, total),
+		fees:      make([]uint64, 0, total),
+		sizes:     make([]uint64, 0, total),
+		parents:   make([][]int, 0, total),
+		children:  make([][]int, 0, total),
+		index:     make(map[chainhash.Hash]int, total),
+	}
+
+	for i, meta := range metas {
+		for j, node := range meta.Subtree.Nodes {
+			if node.Hash.Equal(CoinbasePlaceholderHashValue) {
+				continue
+			}
+
+			g.index[node.Hash] = len(g.hashes)
+			g.hashes = append(g.hashes, node.Hash)
+			g.positions = append(g.positions, nodePosition{subtree: i, index: j})
+			g.fees = append(g.fees, node.Fee)
+			g.sizes = append(g.sizes, node.SizeInBytes)
+			g.parents = append(g.parents, nil)
+			g.children = append(g.children, nil)
+		}
+	}
+
+	for id, pos := range g.positions {
+		meta := metas[pos.subtree]
+		if pos.index >= len(meta.TxInpoints) {
+			continue
+		}
+
+		for _, parentHash := range meta.TxInpoints[pos.index].ParentTxHashes {
+			parentID, ok := g.index[parentHash]
+			if !ok || parentID == id {
+				continue
+			}
+
+			g.parents[id] = append(g.parents[id], parentID)
+			g.children[parentID] = append(g.children[parentID], id)
+		}
+	}
+
+	return g, nil
+}
+
+// Len returns the number of transactions in the graph.
+func (g *DependencyGraph) Len() int {
+	return len(g.hashes)
+}
+
+// Contains returns true if the transaction is in the graph.
+func (g *DependencyGraph) Contains(hash chainhash.Hash) bool {
+	_, ok := g.index[hash]
+	return ok
+}
+
+// Position returns the subtree index and the node index of the transaction.
+func (g *DependencyGraph) Position(hash chainhash.Hash) (subtreeIdx, nodeIdx int, err error) {
+	id, ok := g.index[hash]
+	if !ok {
+		return 0, 0, ErrNodeNotFound
+	}
+
+	return g.positions[id].subtree, g.positions[id].index, nil
+}
+
+// Parents returns the in-graph parents of the transaction.
+func (g *DependencyGraph) Parents(hash chainhash.Hash) ([]chainhash.Hash, error) {
+	id, ok := g.index[hash]
+	if !ok {
+		return nil, ErrNodeNotFound
+	}
+
+	return g.hashesForIDs(sortedIDs(g.parents[id])), nil
+}
+
+// Children returns the in-graph transactions directly spending the transaction.
+func (g *DependencyGraph) Children(hash chainhash.Hash) ([]chainhash.Hash, error) {
+	id, ok := g.index[hash]
+	if !ok {
+		return nil, ErrNodeNotFound
+	}
+
+	return g.hashesForIDs(sortedIDs(g.children[id])), nil
+}
+
+// Ancestors returns all in-graph transactions the transaction depends on, directly
+// or through other transactions, in block order.
+func (g *DependencyGraph) Ancestors(hash chainhash.Hash) ([]chainhash.Hash, error) {
+	id, ok := g.index[hash]
+	if !ok {
+		return nil, ErrNodeNotFound
+	}
+
+	return g.hashesForIDs(g.reachable(id, g.parents)), nil
+}
+
+// Descendants returns all in-graph transactions depending on the transaction,
+// directly or through other transactions, in block order.
+func (g *DependencyGraph) Descendants(hash chainhash.Hash) ([]chainhash.Hash, error) {
+	id, ok := g.index[hash]
+	if !ok {
+		return nil, ErrNodeNotFound
+	}
+
+	return g.hashesForIDs(g.reachable(id, g.children)), nil
+}
+
+// HasInBlockParents returns true if the transaction spends the output of another
+// transaction in the graph.
+func (g *DependencyGraph) HasInBlockParents(hash chainhash.Hash) bool {
+	id, ok := g.index[hash]
+	return ok && len(g.parents[id]) > 0
+}
+
+// Chains returns the groups of transactions that are connected through parent /
+// child relations, ignoring transactions without any in-graph relation. Every chain
+// and the list of chains are in block order.
+func (g *DependencyGraph) Chains() [][]chainhash.Hash {
+	chains := make([][]chainhash.Hash, 0)
+	visited := make([]bool, len(g.hashes))
+
+	for id := range g.hashes {
+		if visited[id] || (len(g.parents[id]) == 0 && len(g.children[id]) == 0) {
+			continue
+		}
+
+		members := make([]int, 0, 2)
+		queue := []int{id}
+		visited[id] = true
+
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+			members = append(members, current)
+
+			for _, next := range slices.Concat(g.parents[current], g.children[current]) {
+				if !visited[next] {
+					visited[next] = true
+					queue = append(queue, next)
+				}
+			}
+		}
+
+		slices.Sort(members)
+		chains = append(chains, g.hashesForIDs(members))
+	}
+
+	return chains
+}
+
+// AncestorPackage returns the aggregated fee and size of the transaction and all
+// its in-graph ancestors, the package a miner has to include to mine the
+// transaction (child pays for parent).
+func (g *DependencyGraph) AncestorPackage(hash chainhash.Hash) (PackageFee, error) {
+	id, ok := g.index[hash]
+	if !ok {
+		return PackageFee{}, ErrNodeNotFound
+	}
+
+	return g.packageFee(append(g.reachable(id, g.parents), id)), nil
+}
+
+// DescendantPackage returns the aggregated fee and size of the transaction and all
+// its in-graph descendants, the package that is dropped when the transaction is
+// removed.
+func (g *DependencyGraph) DescendantPackage(hash chainhash.Hash) (PackageFee, error) {
+	id, ok := g.index[hash]
+	if !ok {
+		return PackageFee{}, ErrNodeNotFound
+	}
+
+	return g.packageFee(append(g.reachable(id, g.children), id)), nil
+}
+
+// reachable returns the sorted ids of all nodes reachable from id through edges,
+// excluding id itself.
+func (g *DependencyGraph) reachable(id int, edges [][]int) []int {
+	visited := map[int]struct{}{id: {}}
+	stack := append([]int(nil), edges[id]...)
+	result := make([]int, 0, len(stack))
+
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if _, ok := visited[current]; ok {
+			continue
+		}
+
+		visited[current] = struct{}{}
+		result = append(result, current)
+		stack = append(stack, edges[current]...)
+	}
+
+	slices.Sort(result)
+
+	return result
+}
+
+// packageFee sums the fees and sizes of the given ids.
+func (g *DependencyGraph) packageFee(ids []int) PackageFee {
+	p := PackageFee{Count: len(ids)}
+
+	for _, id := range ids {
+		p.Fee += g.fees[id]
+		p.SizeInBytes += g.sizes[id]
+	}
+
+	return p
+}
+
+// hashesForIDs returns the hashes of the given ids.
+func (g *DependencyGraph) hashesForIDs(ids []int) []chainhash.Hash {
+	hashes := make([]chainhash.Hash, len(ids))
+	for i, id := range ids {
+		hashes[i] = g.hashes[id]
+	}
+
+	return hashes
+}
+
+// sortedIDs returns a sorted copy of ids.
+func sortedIDs(ids []int) []int {
+	sorted := slices.Clone(ids)
+	slices.Sort(sorted)
+
+	return sorted
+}
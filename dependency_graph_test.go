@@ -0,0 +1,126 @@
+package subtree
+
+import (
+	"testing"
+
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDependencyGraph(t *testing.T) {
+	h := make([]chainhash.Hash, 7)
+	for i := range h {
+		h[i] = chainhash.HashH([]byte{byte(i)})
+	}
+
+	external := chainhash.HashH([]byte("external"))
+
+	// h0 <- h1 <- h3, h0 <- h4, h2 independent, h5 <- h6 (across subtrees)
+	meta1 := buildChainMeta(t, 4, h[0:4], [][]chainhash.Hash{{external}, {h[0]}, {external}, {h[1]}})
+	meta2 := buildChainMeta(t, 4, h[4:7], [][]chainhash.Hash{{h[0], external}, {external}, {h[5]}})
+
+	g, err := NewDependencyGraph(meta1, meta2)
+	require.NoError(t, err)
+
+	t.Run("len and contains", func(t *testing.T) {
+		assert.Equal(t, 7, g.Len())
+		assert.True(t, g.Contains(h[3]))
+		assert.False(t, g.Contains(external))
+
+		subtreeIdx, nodeIdx, err := g.Position(h[6])
+		require.NoError(t, err)
+		assert.Equal(t, 1, subtreeIdx)
+		assert.Equal(t, 2, nodeIdx)
+
+		_, _, err = g.Position(external)
+		require.ErrorIs(t, err, ErrNodeNotFound)
+	})
+
+	t.Run("parents and children", func(t *testing.T) {
+		parents, err := g.Parents(h[4])
+		require.NoError(t, err)
+		assert.Equal(t, []chainhash.Hash{h[0]}, parents)
+
+		children, err := g.Children(h[0])
+		require.NoError(t, err)
+		assert.Equal(t, []chainhash.Hash{h[1], h[4]}, children)
+
+		_, err = g.Children(external)
+		require.ErrorIs(t, err, ErrNodeNotFound)
+
+		_, err = g.Parents(external)
+		require.ErrorIs(t, err, ErrNodeNotFound)
+	})
+
+	t.Run("ancestors and descendants", func(t *testing.T) {
+		ancestors, err := g.Ancestors(h[3])
+		require.NoError(t, err)
+		assert.Equal(t, []chainhash.Hash{h[0], h[1]}, ancestors)
+
+		descendants, err := g.Descendants(h[0])
+		require.NoError(t, err)
+		assert.Equal(t, []chainhash.Hash{h[1], h[3], h[4]}, descendants)
+
+		descendants, err = g.Descendants(h[2])
+		require.NoError(t, err)
+		assert.Empty(t, descendants)
+
+		_, err = g.Ancestors(external)
+		require.ErrorIs(t, err, ErrNodeNotFound)
+
+		_, err = g.Descendants(external)
+		require.ErrorIs(t, err, ErrNodeNotFound)
+	})
+
+	t.Run("chains", func(t *testing.T) {
+		assert.True(t, g.HasInBlockParents(h[6]))
+		assert.False(t, g.HasInBlockParents(h[5]))
+		assert.False(t, g.HasInBlockParents(external))
+
+		assert.Equal(t, [][]chainhash.Hash{
+			{h[0], h[1], h[3], h[4]},
+			{h[5], h[6]},
+		}, g.Chains())
+	})
+
+	t.Run("packages", func(t *testing.T) {
+		// buildChainMeta sets fee and size to the index in the subtree
+		pkg, err := g.AncestorPackage(h[3])
+		require.NoError(t, err)
+		assert.Equal(t, PackageFee{Fee: 0 + 1 + 3, SizeInBytes: 0 + 1 + 3, Count: 3}, pkg)
+		assert.InDelta(t, 1.0, pkg.FeeRate(), 0.0001)
+
+		pkg, err = g.DescendantPackage(h[0])
+		require.NoError(t, err)
+		assert.Equal(t, PackageFee{Fee: 0 + 1 + 3 + 0, SizeInBytes: 0 + 1 + 3 + 0, Count: 4}, pkg)
+
+		_, err = g.AncestorPackage(external)
+		require.ErrorIs(t, err, ErrNodeNotFound)
+
+		_, err = g.DescendantPackage(external)
+		require.ErrorIs(t, err, ErrNodeNotFound)
+
+		assert.Zero(t, PackageFee{}.FeeRate())
+	})
+
+	t.Run("skips coinbase placeholder", func(t *testing.T) {
+		st, err := NewTreeByLeafCount(2)
+		require.NoError(t, err)
+		require.NoError(t, st.AddCoinbaseNode())
+		require.NoError(t, st.AddNode(h[0], 1, 1))
+
+		cg, err := NewDependencyGraph(NewSubtreeMeta(st))
+		require.NoError(t, err)
+		assert.Equal(t, 1, cg.Len())
+		assert.False(t, cg.Contains(CoinbasePlaceholderHashValue))
+	})
+
+	t.Run("invalid metas", func(t *testing.T) {
+		_, err := NewDependencyGraph(nil)
+		require.ErrorIs(t, err, ErrSubtreeMetaNil)
+
+		_, err = NewDependencyGraph(&Meta{})
+		require.ErrorIs(t, err, ErrSubtreeNil)
+	})
+}
@@ -1,6 +1,11 @@
 package subtree
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+)
 
 // Sentinel errors for the subtree package
 
@@ -27,6 +32,9 @@ var (
 	// ErrSubtreeNil is returned when the subtree is nil
 	ErrSubtreeNil = errors.New("subtree is nil")
 
+	// ErrSubtreeMetaNil is returned when the subtree meta is nil
+	ErrSubtreeMetaNil = errors.New("subtree meta is nil")
+
 	// ErrSubtreeNotEmpty is returned when subtree should be empty before adding a coinbase node
 	ErrSubtreeNotEmpty = errors.New("subtree should be empty before adding a coinbase node")
 
@@ -39,6 +47,15 @@ var (
 	// ErrCoinbasePlaceholderMisuse is returned when coinbase placeholder node should be added with AddCoinbaseNode
 	ErrCoinbasePlaceholderMisuse = errors.New("coinbase placeholder node should be added with AddCoinbaseNode")
 
+	// ErrNoCoinbasePlaceholder is returned when the subtree does not start with the coinbase placeholder
+	ErrNoCoinbasePlaceholder = errors.New("subtree does not start with the coinbase placeholder")
+
+	// ErrNotCoinbaseTx is returned when a transaction is expected to be a coinbase transaction, but is not
+	ErrNotCoinbaseTx = errors.New("transaction is not a coinbase transaction")
+
+	// ErrCoinbaseTxMissing is returned when the coinbase transaction must be written, but has not been attached
+	ErrCoinbaseTxMissing = errors.New("coinbase transaction is missing")
+
 	// ErrConflictingNodeNotInSubtree is returned when conflicting node is not in the subtree
 	ErrConflictingNodeNotInSubtree = errors.New("conflicting node is not in the subtree")
 
@@ -49,6 +66,9 @@ var (
 	// subtree to a height that is smaller than the height implied by its current
 	// leaf count.
 	ErrTargetHeightTooSmall = errors.New("target height is smaller than the subtree's actual height")
+
+	// ErrTopologicalCycle is returned when the parent relations of the transactions contain a cycle
+	ErrTopologicalCycle = errors.New("transaction dependencies contain a cycle")
 )
 
 // Data mismatch errors
@@ -59,8 +79,20 @@ var (
 	// ErrTxHashMismatch is returned when transaction hash does not match subtree node hash
 	ErrTxHashMismatch = errors.New("transaction hash does not match subtree node hash")
 
+	// ErrTxAlreadySet is returned when a transaction is added at an index of the subtree data that has already been set
+	ErrTxAlreadySet = errors.New("transaction has already been set in the subtree data")
+
+	// ErrTxNotInData is returned when a transaction is not part of the subtree data
+	ErrTxNotInData = errors.New("transaction is not in the subtree data")
+
 	// ErrSubtreeLengthMismatch is returned when subtree length does not match tx data length
 	ErrSubtreeLengthMismatch = errors.New("subtree length does not match tx data length")
+
+	// ErrSubtreeRootMismatch is returned when objects that should be for the same subtree have different root hashes
+	ErrSubtreeRootMismatch = errors.New("subtree root hash mismatch")
+
+	// ErrSubtreeMetaCountMismatch is returned when the number of metas does not match the number of subtrees
+	ErrSubtreeMetaCountMismatch = errors.New("number of subtree metas does not match number of subtrees")
 )
 
 // Serialization errors
@@ -79,10 +111,45 @@ var (
 
 	// ErrTransactionRead is returned when reading a transaction fails
 	ErrTransactionRead = errors.New("error reading transaction")
+
+	// ErrUnknownMetaFormat is returned when a subtree meta uses a format that is not known
+	ErrUnknownMetaFormat = errors.New("unknown subtree meta format")
+
+	// ErrMetaNoOffsetTable is returned when random access is requested on a subtree meta without an offset table
+	ErrMetaNoOffsetTable = errors.New("subtree meta has no offset table")
+
+	// ErrDataIndexCorrupt is returned when the entries of a data index are out of order or overlap
+	ErrDataIndexCorrupt = errors.New("data index entries are out of order or overlap")
+
+	// ErrTxNotExtended is returned when a transaction must be written in Extended Format but is not extended
+	ErrTxNotExtended = errors.New("transaction is not in extended format")
 )
 
 // Mmap errors
 var (
 	// ErrCapacityNotPositive is returned when mmap capacity is not positive
 	ErrCapacityNotPositive = errors.New("capacity must be positive")
+
+	// ErrMetaArenaReadOnly is returned when trying to modify an mmap-backed subtree meta arena
+	ErrMetaArenaReadOnly = errors.New("mmap-backed subtree meta arena is read-only")
 )
+
+// RootHashMismatchError is returned when the root hash stored in a subtree meta file does
+// not match the root hash of the subtree it is loaded for. It matches ErrSubtreeRootMismatch
+// with errors.Is.
+type RootHashMismatchError struct {
+	// Expected is the root hash of the subtree
+	Expected chainhash.Hash
+	// Actual is the root hash stored in the file
+	Actual chainhash.Hash
+}
+
+// Error returns the error message, including both root hashes.
+func (e *RootHashMismatchError) Error() string {
+	return fmt.Sprintf("%s: expected %s, got %s", ErrSubtreeRootMismatch, e.Expected.String(), e.Actual.String())
+}
+
+// Unwrap returns ErrSubtreeRootMismatch.
+func (e *RootHashMismatchError) Unwrap() error {
+	return ErrSubtreeRootMismatch
+}
@@ -95,6 +95,23 @@ func NewTxInpointsFromInputs(inputs []*bt.Input) (TxInpoints, error) {
 	return newSizedFromInputs(inputs), nil
 }
 
+// NewTxInpointsFromTxBytes creates a new TxInpoints object from the serialized
+// transaction, in standard or Extended Format, at the start of b. Only the previous
+// txid and output index of every input are read, the scripts are skipped without
+// being parsed or copied, which makes this a lot cheaper than parsing a bt.Tx for
+// NewTxInpointsFromTx. The result is identical.
+//
+// Returns the TxInpoints and the length of the transaction in b, or an error if the
+// transaction is truncated.
+func NewTxInpointsFromTxBytes(b []byte) (TxInpoints, int, error) {
+	tx, err := scanTx(b, false)
+	if err != nil {
+		return TxInpoints{}, 0, err
+	}
+
+	return tx.inpoints, tx.length, nil
+}
+
 // NewTxInpointsFromPacked builds a TxInpoints whose internal storage *aliases*
 // the supplied slices. Zero allocation, zero validation: a hot-path
 // constructor for trusted callers that already hold the packed layout in a
@@ -143,6 +160,20 @@ func NewTxInpointsFromReader(buf io.Reader) (TxInpoints, error) {
 	return p, nil
 }
 
+// NewTxInpointsFromVarintBytes creates a new TxInpoints object from a byte slice
+// written by SerializeVarint.
+func NewTxInpointsFromVarintBytes(data []byte) (TxInpoints, error) {
+	p := TxInpoints{}
+	r := bytes.NewReader(data)
+	codec := &metaCodec{format: MetaFormatVarint}
+
+	if err := codec.readTxInpoints(r, r, &p); err != nil {
+		return p, err
+	}
+
+	return p, nil
+}
+
 // String returns a string representation of the TxInpoints object. The format
 // is kept compatible with the pre-packed version (it still names the field
 // "Idxs") so any code that greps logs or test output keeps working.
@@ -203,6 +234,74 @@ func (p *TxInpoints) GetParentVoutsAtIndex(index int) ([]uint32, error) {
 	return p.voutSliceForParent(index), nil
 }
 
+// Equal returns whether p and other hold the same set of inpoints. The order of
+// the parents and of the vouts within a parent is ignored, so two TxInpoints
+// built from the same inputs in a different order are equal.
+func (p *TxInpoints) Equal(other *TxInpoints) bool {
+	if slices.Equal(p.ParentTxHashes, other.ParentTxHashes) && slices.Equal(p.voutIdxs, other.voutIdxs) {
+		return true
+	}
+
+	return slices.Equal(p.sortedInpoints(), other.sortedInpoints())
+}
+
+// Contains returns whether the inpoint is one of the inpoints of p.
+func (p *TxInpoints) Contains(inpoint Inpoint) bool {
+	pos := 0
+
+	for _, hash := range p.ParentTxHashes {
+		count := int(p.voutIdxs[pos])
+
+		if hash == inpoint.Hash && slices.Contains(p.voutIdxs[pos+1:pos+1+count], inpoint.Index) {
+			return true
+		}
+
+		pos += 1 + count
+	}
+
+	return false
+}
+
+// Union returns the inpoints of p and other combined, in canonical form, see
+// Canonical. Neither p nor other is modified.
+func (p *TxInpoints) Union(other *TxInpoints) TxInpoints {
+	inpoints := append(p.GetTxInpoints(), other.GetTxInpoints()...)
+
+	slices.SortFunc(inpoints, compareInpoints)
+
+	return newTxInpointsFromSorted(slices.Compact(inpoints))
+}
+
+// Intersect returns the inpoints held by both p and other, in canonical form, see
+// Canonical. Neither p nor other is modified.
+func (p *TxInpoints) Intersect(other *TxInpoints) TxInpoints {
+	a, b := p.sortedInpoints(), other.sortedInpoints()
+	inpoints := make([]Inpoint, 0, Min(len(a), len(b)))
+
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch c := compareInpoints(a[i], b[j]); {
+		case c < 0:
+			i++
+		case c > 0:
+			j++
+		default:
+			inpoints = append(inpoints, a[i])
+			i++
+			j++
+		}
+	}
+
+	return newTxInpointsFromSorted(inpoints)
+}
+
+// Canonical returns a copy of p in canonical form: the parents sorted by hash, the
+// vouts of every parent sorted ascending and duplicate inpoints removed. TxInpoints
+// holding the same set of inpoints have identical canonical forms, which also
+// serialize to the same bytes.
+func (p *TxInpoints) Canonical() TxInpoints {
+	return newTxInpointsFromSorted(p.sortedInpoints())
+}
+
 // Serialize serializes the TxInpoints object into a byte slice. The wire
 // format is unchanged from the pre-packed-layout version.
 func (p *TxInpoints) Serialize() ([]byte, error) {
@@ -252,6 +351,20 @@ func (p *TxInpoints) Serialize() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// SerializeVarint serializes the TxInpoints object into a byte slice, in the same
+// layout as Serialize but with the parent count, vout counts and vouts written as
+// unsigned varints. This is the record encoding of the MetaFormatVarint meta format.
+func (p *TxInpoints) SerializeVarint() ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, 1+len(p.ParentTxHashes)*32+len(p.voutIdxs)))
+	codec := &metaCodec{format: MetaFormatVarint}
+
+	if err := codec.writeTxInpoints(buf, p); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
 // voutSliceForParent returns the underlying vout slice (no copy) for the i-th
 // parent. The caller MUST treat the result as read-only — it aliases voutIdxs.
 //
@@ -268,6 +381,16 @@ func (p *TxInpoints) voutSliceForParent(i int) []uint32 {
 	return p.voutIdxs[pos+1 : pos+1+count]
 }
 
+// sortedInpoints returns the inpoints of p sorted by hash and index, without
+// duplicates.
+func (p *TxInpoints) sortedInpoints() []Inpoint {
+	inpoints := p.GetTxInpoints()
+
+	slices.SortFunc(inpoints, compareInpoints)
+
+	return slices.Compact(inpoints)
+}
+
 // nrInputs returns the total number of tx inputs represented across all
 // parents. 0 for an empty TxInpoints.
 //
@@ -393,6 +516,30 @@ func newSizedFromInputs(inputs []*bt.Input) TxInpoints {
 	return p
 }
 
+// newTxInpointsFromSorted builds a TxInpoints from inpoints sorted by hash and
+// index, grouping the vouts of every parent in a single pass.
+func newTxInpointsFromSorted(inpoints []Inpoint) TxInpoints {
+	p := TxInpoints{
+		ParentTxHashes: make([]chainhash.Hash, 0, len(inpoints)),
+		voutIdxs:       make([]uint32, 0, 2*len(inpoints)),
+	}
+
+	countPos := 0
+
+	for i, inpoint := range inpoints {
+		if i == 0 || inpoint.Hash != inpoints[i-1].Hash {
+			p.ParentTxHashes = append(p.ParentTxHashes, inpoint.Hash)
+			countPos = len(p.voutIdxs)
+			p.voutIdxs = append(p.voutIdxs, 0)
+		}
+
+		p.voutIdxs = append(p.voutIdxs, inpoint.Index)
+		p.voutIdxs[countPos]++
+	}
+
+	return p
+}
+
 func len32[V any](b []V) uint32 {
 	if b == nil {
 		return 0
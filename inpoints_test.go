@@ -2,8 +2,11 @@ package subtree
 
 import (
 	"bytes"
+	"io"
+	"slices"
 	"testing"
 
+	"github.com/bsv-blockchain/go-bt/v2"
 	"github.com/bsv-blockchain/go-bt/v2/chainhash"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -304,6 +307,208 @@ func TestNewTxInpointsFromPacked(t *testing.T) {
 	})
 }
 
+func TestTxInpointsSetOperations(t *testing.T) {
+	h := make([]chainhash.Hash, 3)
+	for i := range h {
+		h[i] = chainhash.HashH([]byte{byte(i)})
+	}
+
+	build := func(inpoints ...Inpoint) TxInpoints {
+		p := NewTxInpoints()
+		for _, inpoint := range inpoints {
+			p.appendInput(inpoint.Hash, inpoint.Index)
+		}
+
+		return p
+	}
+
+	a := build(Inpoint{h[2], 1}, Inpoint{h[0], 3}, Inpoint{h[2], 0}, Inpoint{h[1], 5})
+	b := build(Inpoint{h[1], 5}, Inpoint{h[2], 0}, Inpoint{h[0], 3}, Inpoint{h[2], 1})
+
+	t.Run("equal ignores order", func(t *testing.T) {
+		assert.True(t, a.Equal(&b))
+		assert.True(t, b.Equal(&a))
+		assert.True(t, a.Equal(&a))
+
+		c := build(Inpoint{h[1], 5}, Inpoint{h[2], 0}, Inpoint{h[0], 3})
+		assert.False(t, a.Equal(&c))
+
+		d := build(Inpoint{h[1], 5}, Inpoint{h[2], 0}, Inpoint{h[0], 3}, Inpoint{h[2], 2})
+		assert.False(t, a.Equal(&d))
+
+		empty := NewTxInpoints()
+		assert.True(t, empty.Equal(&TxInpoints{}))
+		assert.False(t, empty.Equal(&a))
+	})
+
+	t.Run("contains", func(t *testing.T) {
+		for _, inpoint := range a.GetTxInpoints() {
+			assert.True(t, a.Contains(inpoint))
+		}
+
+		assert.False(t, a.Contains(Inpoint{h[2], 5}))
+		assert.False(t, a.Contains(Inpoint{chainhash.HashH([]byte("other")), 0}))
+	})
+
+	t.Run("canonical", func(t *testing.T) {
+		canonical := a.Canonical()
+
+		assert.True(t, canonical.Equal(&a))
+		assert.Equal(t, canonical, b.Canonical())
+
+		sorted := slices.Clone(canonical.ParentTxHashes)
+		slices.SortFunc(sorted, func(x, y chainhash.Hash) int { return bytes.Compare(x[:], y[:]) })
+		assert.Equal(t, sorted, canonical.ParentTxHashes)
+
+		vouts, err := canonical.GetParentVoutsAtIndex(slices.Index(canonical.ParentTxHashes, h[2]))
+		require.NoError(t, err)
+		assert.Equal(t, []uint32{0, 1}, vouts)
+
+		canonicalBytes, err := canonical.Serialize()
+		require.NoError(t, err)
+
+		otherCanonical := b.Canonical()
+		otherBytes, err := otherCanonical.Serialize()
+		require.NoError(t, err)
+		assert.Equal(t, canonicalBytes, otherBytes)
+
+		// a does not alias the canonical form
+		aBytes, err := a.Serialize()
+		require.NoError(t, err)
+		assert.NotEqual(t, canonicalBytes, aBytes)
+	})
+
+	t.Run("union", func(t *testing.T) {
+		c := build(Inpoint{h[0], 3}, Inpoint{h[0], 4})
+
+		union := a.Union(&c)
+		expected := build(Inpoint{h[2], 1}, Inpoint{h[0], 3}, Inpoint{h[2], 0}, Inpoint{h[1], 5}, Inpoint{h[0], 4})
+		assert.True(t, union.Equal(&expected))
+		assert.Equal(t, expected.Canonical(), union)
+
+		empty := NewTxInpoints()
+		union = empty.Union(&TxInpoints{})
+		assert.NotNil(t, union.ParentTxHashes)
+		assert.Empty(t, union.GetTxInpoints())
+	})
+
+	t.Run("intersect", func(t *testing.T) {
+		c := build(Inpoint{h[0], 3}, Inpoint{h[0], 4}, Inpoint{h[2], 1})
+
+		intersect := a.Intersect(&c)
+		expected := build(Inpoint{h[2], 1}, Inpoint{h[0], 3})
+		assert.Equal(t, expected.Canonical(), intersect)
+
+		d := build(Inpoint{h[1], 6})
+		intersect = a.Intersect(&d)
+		assert.Empty(t, intersect.GetTxInpoints())
+	})
+}
+
+func TestNewTxInpointsFromTxBytes(t *testing.T) {
+	standardTx := tx.Clone()
+	standardTx.Version = 2
+
+	t.Run("matches parsed transaction", func(t *testing.T) {
+		for _, testTx := range []*bt.Tx{tx, standardTx, coinbaseTx} {
+			expected, err := NewTxInpointsFromTx(testTx)
+			require.NoError(t, err)
+
+			for _, b := range [][]byte{testTx.Bytes(), testTx.ExtendedBytes()} {
+				p, length, err := NewTxInpointsFromTxBytes(append(b, 0x01))
+				require.NoError(t, err)
+				assert.Equal(t, expected, p)
+				assert.Equal(t, len(b), length)
+			}
+		}
+	})
+
+	t.Run("multiple inputs", func(t *testing.T) {
+		parent := chainhash.HashH([]byte("parent"))
+
+		multiTx := tx.Clone()
+		for _, vout := range []uint32{3, 1} {
+			input := &bt.Input{PreviousTxOutIndex: vout, SequenceNumber: 0xffffffff}
+			require.NoError(t, input.PreviousTxIDAdd(&parent))
+			multiTx.Inputs = append(multiTx.Inputs, input)
+		}
+
+		expected, err := NewTxInpointsFromTx(multiTx)
+		require.NoError(t, err)
+
+		p, _, err := NewTxInpointsFromTxBytes(multiTx.Bytes())
+		require.NoError(t, err)
+		assert.Equal(t, expected, p)
+		assert.Equal(t, []chainhash.Hash{*tx.Inputs[0].PreviousTxIDChainHash(), parent}, p.ParentTxHashes)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		b := tx.ExtendedBytes()
+
+		for _, l := range []int{0, 4, 10, 45, len(b) - 1} {
+			_, _, err := NewTxInpointsFromTxBytes(b[:l])
+			require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		}
+	})
+}
+
+func TestTxInpointsVarint(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		p, err := NewTxInpointsFromTx(tx)
+		require.NoError(t, err)
+
+		p.appendInput(chainhash.HashH([]byte("a")), 300)
+		p.appendInput(chainhash.HashH([]byte("a")), 70000)
+
+		b, err := p.SerializeVarint()
+		require.NoError(t, err)
+
+		legacy, err := p.Serialize()
+		require.NoError(t, err)
+		assert.Less(t, len(b), len(legacy))
+
+		p2, err := NewTxInpointsFromVarintBytes(b)
+		require.NoError(t, err)
+		assert.Equal(t, p.ParentTxHashes, p2.ParentTxHashes)
+		assert.Equal(t, p.voutIdxs, p2.voutIdxs)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		p := TxInpoints{}
+
+		b, err := p.SerializeVarint()
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0}, b)
+
+		p2, err := NewTxInpointsFromVarintBytes(b)
+		require.NoError(t, err)
+		assert.Empty(t, p2.ParentTxHashes)
+	})
+
+	t.Run("mismatched parent/vout state", func(t *testing.T) {
+		p := NewTxInpointsFromPacked(nil, []uint32{1})
+
+		_, err := p.SerializeVarint()
+		require.ErrorIs(t, err, ErrParentTxHashesMismatch)
+	})
+
+	t.Run("invalid bytes", func(t *testing.T) {
+		_, err := NewTxInpointsFromVarintBytes(nil)
+		require.Error(t, err)
+
+		// one parent, but the hash is truncated
+		_, err = NewTxInpointsFromVarintBytes([]byte{1, 2, 3})
+		require.Error(t, err)
+
+		// a vout that does not fit in an uint32
+		b := append([]byte{1}, make([]byte, 32)...)
+		b = append(b, 1, 0xff, 0xff, 0xff, 0xff, 0x7f)
+
+		_, err = NewTxInpointsFromVarintBytes(b)
+		require.Error(t, err)
+	})
+}
+
 // BenchmarkNewTxInpointsFromPacked measures the hot path block-assembly takes
 // after PR2 in teranode — pre-packed slices arrive over gRPC and TxInpoints
 // aliases them with zero allocation.
@@ -13,7 +13,8 @@ import (
 // which makes it safe to store in mmap'd memory outside the GC's reach.
 const nodeSize = int(unsafe.Sizeof(Node{}))
 
-// mmapNodeStore manages a file-backed mmap region that stores Node data.
+// mmapNodeStore manages a file-backed mmap region that stores Node data, or the
+// arenas of a MetaArena.
 // When closed, it unmaps the region and removes the backing file.
 type mmapNodeStore struct {
 	data     []byte // raw mmap region
@@ -51,10 +52,24 @@ func newFileBackedMmapNodes(capacity int, dir string) ([]Node, io.Closer, error)
 		return nil, nil, fmt.Errorf("%w: got %d", ErrCapacityNotPositive, capacity)
 	}
 
-	size := capacity * nodeSize
+	data, store, err := newFileBackedMmap(capacity*nodeSize, dir, "subtree-nodes-*")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Create a []Node view backed by the mmap'd memory.
+	// This is safe because Node has no pointer fields, so the GC won't scan this region.
+	nodes := unsafe.Slice((*Node)(unsafe.Pointer(&data[0])), capacity)[:0:capacity] //nolint:gosec // G103: intentional unsafe for mmap-backed Node slice
+
+	return nodes, store, nil
+}
 
+// newFileBackedMmap creates a file-backed mmap region of size bytes, in a temp file
+// in dir named after pattern. Closing the returned store unmaps the region and removes
+// the file.
+func newFileBackedMmap(size int, dir, pattern string) ([]byte, *mmapNodeStore, error) {
 	// Create temp file
-	f, err := os.CreateTemp(dir, "subtree-nodes-*")
+	f, err := os.CreateTemp(dir, pattern)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create temp file: %w", err)
 	}
@@ -79,14 +94,10 @@ func newFileBackedMmapNodes(capacity int, dir string) ([]Node, io.Closer, error)
 	// This saves file descriptors (important at 1000+ subtrees).
 	_ = f.Close()
 
-	// Create a []Node view backed by the mmap'd memory.
-	// This is safe because Node has no pointer fields, so the GC won't scan this region.
-	nodes := unsafe.Slice((*Node)(unsafe.Pointer(&data[0])), capacity)[:0:capacity] //nolint:gosec // G103: intentional unsafe for mmap-backed Node slice
-
 	store := &mmapNodeStore{
 		data:     data,
 		filePath: filePath,
 	}
 
-	return nodes, store, nil
+	return data, store, nil
 }
@@ -40,6 +40,10 @@ type Subtree struct {
 	mu        sync.RWMutex           // protects Nodes slice
 	nodeIndex map[chainhash.Hash]int // maps txid to index in Nodes slice
 
+	// conflicting is the set of ConflictingNodes used by IsConflicting, protected by mu.
+	// It is built on the first lookup and reset by the methods changing ConflictingNodes.
+	conflicting map[chainhash.Hash]struct{}
+
 	// closer is non-nil when Nodes are backed by mmap'd memory.
 	// Call Close() to munmap and remove the backing file.
 	closer io.Closer
@@ -352,12 +356,9 @@ func (st *Subtree) AddCoinbaseNode() error {
 	return nil
 }
 
-// AddConflictingNode adds a conflicting node to the subtree.
+// AddConflictingNode adds a conflicting node to the subtree. Adding a node that is
+// already marked as conflicting is a no-op.
 func (st *Subtree) AddConflictingNode(newConflictingNode chainhash.Hash) error {
-	if st.ConflictingNodes == nil {
-		st.ConflictingNodes = make([]chainhash.Hash, 0, 1)
-	}
-
 	// check the conflicting node is actually in the subtree
 	found := false
 
@@ -372,18 +373,58 @@ func (st *Subtree) AddConflictingNode(newConflictingNode chainhash.Hash) error {
 		return ErrConflictingNodeNotInSubtree
 	}
 
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
 	// check whether the conflicting node has already been added
-	for _, conflictingNode := range st.ConflictingNodes {
-		if conflictingNode.Equal(newConflictingNode) {
-			return nil
-		}
+	conflicting := st.conflictingSetLocked()
+	if _, ok := conflicting[newConflictingNode]; ok {
+		return nil
+	}
+
+	if st.ConflictingNodes == nil {
+		st.ConflictingNodes = make([]chainhash.Hash, 0, 1)
 	}
 
 	st.ConflictingNodes = append(st.ConflictingNodes, newConflictingNode)
+	conflicting[newConflictingNode] = struct{}{}
 
 	return nil
 }
 
+// SetConflictingNodes replaces the conflicting nodes of the subtree. ConflictingNodes
+// should only be changed with SetConflictingNodes or AddConflictingNode, which keep the
+// set used by IsConflicting in sync.
+func (st *Subtree) SetConflictingNodes(conflictingNodes []chainhash.Hash) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.ConflictingNodes = conflictingNodes
+	st.conflicting = nil
+}
+
+// IsConflicting returns true if the node is marked as conflicting in the subtree. It is
+// safe for concurrent use.
+func (st *Subtree) IsConflicting(hash chainhash.Hash) bool {
+	st.mu.RLock()
+
+	if st.conflicting != nil {
+		_, ok := st.conflicting[hash]
+		st.mu.RUnlock()
+
+		return ok
+	}
+
+	st.mu.RUnlock()
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	_, ok := st.conflictingSetLocked()[hash]
+
+	return ok
+}
+
 // AddNode adds a node to the subtree
 // WARNING: this function is not concurrency safe, so it should be called from a single goroutine
 //
@@ -441,14 +482,11 @@ func (st *Subtree) RemoveNodeAtIndex(index int) error {
 	st.Fees -= st.Nodes[index].Fee
 	st.SizeInBytes -= st.Nodes[index].SizeInBytes
 
-	hash := st.Nodes[index].Hash
 	st.Nodes = append(st.Nodes[:index], st.Nodes[index+1:]...)
 	st.rootHash = nil // reset rootHash
 
-	if st.nodeIndex != nil {
-		// remove the node from the node index map
-		delete(st.nodeIndex, hash)
-	}
+	// the nodes after the removed node have moved, the node index map is rebuilt on the next lookup
+	st.nodeIndex = nil
 
 	return nil
 }
@@ -558,17 +596,34 @@ func (st *Subtree) GetMap() (TxMap, error) {
 }
 
 // NodeIndex returns the index of the node with the given hash in the subtree.
+// The lookup map is built on first use and is safe to use from multiple goroutines.
 func (st *Subtree) NodeIndex(hash chainhash.Hash) int {
+	st.mu.RLock()
+
+	if st.nodeIndex != nil {
+		nodeIndex, ok := st.nodeIndex[hash]
+		st.mu.RUnlock()
+
+		if ok {
+			return nodeIndex
+		}
+
+		return -1
+	}
+
+	st.mu.RUnlock()
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	// another goroutine might have created the map while we were waiting for the lock
 	if st.nodeIndex == nil {
 		// create the node index map
-		st.mu.Lock()
 		st.nodeIndex = make(map[chainhash.Hash]int, len(st.Nodes))
 
 		for idx, node := range st.Nodes {
 			st.nodeIndex[node.Hash] = idx
 		}
-
-		st.mu.Unlock()
 	}
 
 	nodeIndex, ok := st.nodeIndex[hash]
@@ -595,17 +650,15 @@ func (st *Subtree) GetNode(hash chainhash.Hash) (*Node, error) {
 }
 
 // Difference returns the nodes in the subtree that are not present in the given TxMap.
+// Use DifferenceWithIndices to also get the indices of the nodes.
 func (st *Subtree) Difference(ids TxMap) ([]Node, error) {
 	// return all the ids that are in st.Nodes, but not in ids
-	diff := make([]Node, 0, 1_000)
-
-	for _, node := range st.Nodes {
-		if !ids.Exists(node.Hash) {
-			diff = append(diff, node)
-		}
+	diff, err := st.DifferenceWithIndices(ids)
+	if err != nil {
+		return nil, err
 	}
 
-	return diff, nil
+	return diff.Nodes, nil
 }
 
 // GetMerkleProof returns the merkle proof for the given index
@@ -928,6 +981,7 @@ func (st *Subtree) deserializeFromReaderMmap(reader io.Reader, dir string) error
 		nodes = append(nodes, node)
 	}
 	st.Nodes = nodes
+	st.nodeIndex = nil
 
 	// Read conflicting nodes (on heap — these are small)
 	if err := st.deserializeConflictingNodes(buf); err != nil {
@@ -970,6 +1024,8 @@ func (st *Subtree) deserializeNodesWithAllocator(buf *bufio.Reader, alloc NodeAl
 		st.Nodes = make([]Node, numLeaves)
 	}
 
+	st.nodeIndex = nil
+
 	bytes48 := make([]byte, 48)
 	for i := uint64(0); i < numLeaves; i++ {
 		// read all the node data in 1 go
@@ -998,6 +1054,7 @@ func (st *Subtree) deserializeConflictingNodes(buf *bufio.Reader) error {
 
 	// read conflicting nodes
 	st.ConflictingNodes = make([]chainhash.Hash, numConflictingLeaves)
+	st.conflicting = nil
 
 	for i := uint64(0); i < numConflictingLeaves; i++ {
 		if _, err := io.ReadFull(buf, st.ConflictingNodes[i][:]); err != nil {
@@ -1008,6 +1065,21 @@ func (st *Subtree) deserializeConflictingNodes(buf *bufio.Reader) error {
 	return nil
 }
 
+// conflictingSetLocked returns the set of ConflictingNodes, building it when it has been
+// reset. The caller must hold the write lock of mu.
+func (st *Subtree) conflictingSetLocked() map[chainhash.Hash]struct{} {
+	if st.conflicting != nil {
+		return st.conflicting
+	}
+
+	st.conflicting = make(map[chainhash.Hash]struct{}, len(st.ConflictingNodes))
+	for _, hash := range st.ConflictingNodes {
+		st.conflicting[hash] = struct{}{}
+	}
+
+	return st.conflicting
+}
+
 // DeserializeSubtreeConflictingFromReader deserializes the conflicting nodes from the provided reader.
 func DeserializeSubtreeConflictingFromReader(reader io.Reader) (conflictingNodes []chainhash.Hash, err error) {
 	defer func() {
@@ -0,0 +1,404 @@
+package subtree
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+)
+
+// ConflictContext gives a ConflictPolicy access to the subtrees the conflicts are
+// resolved for.
+type ConflictContext struct {
+	// Metas are the Meta objects of the subtrees, in block order
+	Metas []*Meta
+	// Graph is the dependency graph of all transactions in the subtrees
+	Graph *DependencyGraph
+}
+
+// Node returns the subtree node of the spender.
+func (c *ConflictContext) Node(s Spender) Node {
+	return c.Metas[s.Subtree].Subtree.Nodes[s.Index]
+}
+
+// ConflictPolicy decides which transactions of a conflict group are kept.
+type ConflictPolicy interface {
+	// Rank returns the spenders of the group in order of preference. The spenders are
+	// kept in that order, as long as they do not spend an outpoint already spent by a
+	// spender that is kept. Spenders that are not returned are removed.
+	Rank(ctx *ConflictContext, group ConflictGroup) []Spender
+}
+
+// FirstSeenConflictPolicy keeps the transaction that comes first in the block.
+type FirstSeenConflictPolicy struct{}
+
+// Rank returns the spenders in block order.
+func (FirstSeenConflictPolicy) Rank(_ *ConflictContext, group ConflictGroup) []Spender {
+	ranked := slices.Clone(group.Spenders)
+	slices.SortFunc(ranked, compareSpenders)
+
+	return ranked
+}
+
+// FeeRateConflictPolicy keeps the transaction with the highest fee rate, from the Fee and
+// SizeInBytes of its node. Equal fee rates are ranked in block order.
+type FeeRateConflictPolicy struct{}
+
+// Rank returns the spenders by descending fee rate.
+func (FeeRateConflictPolicy) Rank(ctx *ConflictContext, group ConflictGroup) []Spender {
+	ranked := slices.Clone(group.Spenders)
+
+	slices.SortFunc(ranked, func(a, b Spender) int {
+		nodeA, nodeB := ctx.Node(a), ctx.Node(b)
+
+		rateA := PackageFee{Fee: nodeA.Fee, SizeInBytes: nodeA.SizeInBytes, Count: 1}.FeeRate()
+		rateB := PackageFee{Fee: nodeB.Fee, SizeInBytes: nodeB.SizeInBytes, Count: 1}.FeeRate()
+
+		if c := cmp.Compare(rateB, rateA); c != 0 {
+			return c
+		}
+
+		return compareSpenders(a, b)
+	})
+
+	return ranked
+}
+
+// PackageConflictPolicy keeps the transaction with the largest dependent package, the
+// transaction and all its descendants in the subtrees, which is the package that would
+// be dropped with it. Packages are compared by their number of transactions, then by
+// their fee, and are ranked in block order when equal.
+type PackageConflictPolicy struct{}
+
+// Rank returns the spenders by descending package size.
+func (PackageConflictPolicy) Rank(ctx *ConflictContext, group ConflictGroup) []Spender {
+	packages := make(map[Spender]PackageFee, len(group.Spenders))
+
+	for _, s := range group.Spenders {
+		// every spender is in the graph, it was built from the same metas
+		packages[s], _ = ctx.Graph.DescendantPackage(s.TxHash)
+	}
+
+	ranked := slices.Clone(group.Spenders)
+
+	slices.SortFunc(ranked, func(a, b Spender) int {
+		if c := cmp.Compare(packages[b].Count, packages[a].Count); c != 0 {
+			return c
+		}
+
+		if c := cmp.Compare(packages[b].Fee, packages[a].Fee); c != 0 {
+			return c
+		}
+
+		return compareSpenders(a, b)
+	})
+
+	return ranked
+}
+
+// ConflictResolution is the outcome of resolving the conflicts in a set of subtrees.
+type ConflictResolution struct {
+	// Groups are the conflict groups that were resolved
+	Groups []ConflictGroup
+	// Winners are the conflicting transactions that are kept, in block order
+	Winners []Spender
+	// Losers are the conflicting transactions that are removed, in block order
+	Losers []Spender
+	// Removed are all transactions to remove, the losers and all their descendants in the
+	// subtrees, in block order
+	Removed []Spender
+}
+
+// ResolveConflicts finds the transactions of the subtrees of the metas that spend the
+// same outpoints and decides, with the policy, which of them are removed. Removing a
+// transaction also removes all transactions depending on it. Groups are resolved after
+// the groups they depend on, so a transaction removed with a loser of another group
+// leaves its outpoints to the other transactions of its own group. The subtrees are not
+// changed, see ApplyConflictResolution.
+//
+// Parameters:
+//   - policy: The policy deciding which transactions to keep
+//   - metas: The Meta objects of the subtrees, in block order
+//
+// Returns:
+//   - *ConflictResolution: The transactions to keep and to remove, empty when there are no conflicts
+//   - error: An error if a meta or its subtree is not set
+func ResolveConflicts(policy ConflictPolicy, metas ...*Meta) (*ConflictResolution, error) {
+	si, err := NewSpentIndex(metas...)
+	if err != nil {
+		return nil, err
+	}
+
+	resolution := &ConflictResolution{
+		Groups: si.ConflictGroups(),
+	}
+
+	if len(resolution.Groups) == 0 {
+		return resolution, nil
+	}
+
+	ctx := &ConflictContext{Metas: metas}
+
+	if ctx.Graph, err = NewDependencyGraph(metas...); err != nil {
+		return nil, err
+	}
+
+	var winners, losers []Spender
+
+	removed := make(map[Spender]struct{})
+
+	// a group is resolved after the groups its spenders depend on, so a spender that is
+	// removed with a loser of another group does not keep the other spenders of its group
+	for _, groupIdx := range conflictGroupOrder(ctx.Graph, resolution.Groups) {
+		group := resolution.Groups[groupIdx]
+
+		if winners, losers, err = resolveGroup(ctx, policy, group, removed); err != nil {
+			return nil, err
+		}
+
+		resolution.Winners = append(resolution.Winners, winners...)
+		resolution.Losers = append(resolution.Losers, losers...)
+
+		for _, loser := range losers {
+			removed[loser] = struct{}{}
+
+			descendants, _ := ctx.Graph.Descendants(loser.TxHash)
+			for _, hash := range descendants {
+				subtreeIdx, nodeIdx, _ := ctx.Graph.Position(hash)
+				removed[Spender{TxHash: hash, Subtree: subtreeIdx, Index: nodeIdx}] = struct{}{}
+			}
+		}
+	}
+
+	// a winner depending on a loser of a group it also is an ancestor of is removed with it
+	resolution.Winners = slices.DeleteFunc(resolution.Winners, func(s Spender) bool {
+		_, ok := removed[s]
+		return ok
+	})
+
+	resolution.Removed = make([]Spender, 0, len(removed))
+	for s := range removed {
+		resolution.Removed = append(resolution.Removed, s)
+	}
+
+	slices.SortFunc(resolution.Winners, compareSpenders)
+	slices.SortFunc(resolution.Losers, compareSpenders)
+	slices.SortFunc(resolution.Removed, compareSpenders)
+
+	return resolution, nil
+}
+
+// ApplyConflictResolution removes the transactions in resolution.Removed from the
+// subtrees of the metas, and their TxInpoints from the metas, in a single compaction
+// pass per subtree. The metas must be the ones the resolution was made for. The fees,
+// sizes and root hashes of the subtrees are updated, and removed transactions are
+// dropped from ConflictingNodes.
+//
+// Parameters:
+//   - resolution: The resolution returned by ResolveConflicts
+//   - metas: The Meta objects of the subtrees, in block order
+//
+// Returns:
+//   - error: An error if a removed transaction is not at its position, in which case no subtree is changed
+func ApplyConflictResolution(resolution *ConflictResolution, metas ...*Meta) error {
+	removed := make([]map[int]struct{}, len(metas))
+
+	for _, s := range resolution.Removed {
+		if s.Subtree < 0 || s.Subtree >= len(metas) || metas[s.Subtree] == nil || metas[s.Subtree].Subtree == nil {
+			return fmt.Errorf("%w: subtree %d", ErrIndexOutOfRange, s.Subtree)
+		}
+
+		st := metas[s.Subtree].Subtree
+		if s.Index < 0 || s.Index >= len(st.Nodes) || !st.Nodes[s.Index].Hash.Equal(s.TxHash) {
+			return fmt.Errorf("%w: %s at %d:%d", ErrNodeNotFound, s.TxHash.String(), s.Subtree, s.Index)
+		}
+
+		if removed[s.Subtree] == nil {
+			removed[s.Subtree] = make(map[int]struct{})
+		}
+
+		removed[s.Subtree][s.Index] = struct{}{}
+	}
+
+	for i, indices := range removed {
+		if len(indices) > 0 {
+			metas[i].removeNodes(indices)
+		}
+	}
+
+	return nil
+}
+
+// resolveGroup ranks the spenders of the group with the policy and returns the spenders
+// that are kept and the spenders that are removed. Spenders that are already removed,
+// with a loser of another group, are losers and do not claim their inpoints.
+func resolveGroup(ctx *ConflictContext, policy ConflictPolicy, group ConflictGroup, removed map[Spender]struct{}) (winners, losers []Spender, err error) {
+	var inpoints []Inpoint
+
+	contested := make(map[Inpoint]struct{}, len(group.Inpoints))
+	for _, inpoint := range group.Inpoints {
+		contested[inpoint] = struct{}{}
+	}
+
+	claimed := make(map[Inpoint]struct{}, len(group.Inpoints))
+	ranked := make(map[Spender]struct{}, len(group.Spenders))
+
+	for _, s := range policy.Rank(ctx, group) {
+		if _, ok := ranked[s]; ok {
+			continue
+		}
+
+		ranked[s] = struct{}{}
+
+		if _, ok := removed[s]; ok {
+			losers = append(losers, s)
+			continue
+		}
+
+		if inpoints, err = ctx.Metas[s.Subtree].GetTxInpoints(s.Index); err != nil {
+			return nil, nil, err
+		}
+
+		inpoints = slices.DeleteFunc(inpoints, func(inpoint Inpoint) bool {
+			_, ok := contested[inpoint]
+			return !ok
+		})
+
+		if slices.ContainsFunc(inpoints, func(inpoint Inpoint) bool {
+			_, ok := claimed[inpoint]
+			return ok
+		}) {
+			losers = append(losers, s)
+			continue
+		}
+
+		for _, inpoint := range inpoints {
+			claimed[inpoint] = struct{}{}
+		}
+
+		winners = append(winners, s)
+	}
+
+	for _, s := range group.Spenders {
+		if _, ok := ranked[s]; !ok {
+			losers = append(losers, s)
+		}
+	}
+
+	return winners, losers, nil
+}
+
+// conflictGroupOrder returns the indices of the groups in the order they are resolved: a
+// group after every group with a spender that one of its spenders depends on. Groups
+// depending on each other are resolved in their original order.
+func conflictGroupOrder(graph *DependencyGraph, groups []ConflictGroup) []int {
+	groupOf := make(map[chainhash.Hash]int)
+
+	for i, group := range groups {
+		for _, s := range group.Spenders {
+			groupOf[s.TxHash] = i
+		}
+	}
+
+	// dependents[i] are the groups depending on group i, pending[i] the number of groups group i depends on
+	dependents := make([]map[int]struct{}, len(groups))
+	pending := make([]int, len(groups))
+
+	for i, group := range groups {
+		dependencies := make(map[int]struct{})
+
+		for _, s := range group.Spenders {
+			ancestors, _ := graph.Ancestors(s.TxHash)
+			for _, hash := range ancestors {
+				if j, ok := groupOf[hash]; ok && j != i {
+					dependencies[j] = struct{}{}
+				}
+			}
+		}
+
+		for j := range dependencies {
+			if dependents[j] == nil {
+				dependents[j] = make(map[int]struct{})
+			}
+
+			dependents[j][i] = struct{}{}
+		}
+
+		pending[i] = len(dependencies)
+	}
+
+	order := make([]int, 0, len(groups))
+	done := make([]bool, len(groups))
+
+	for len(order) < len(groups) {
+		// the first group without unresolved dependencies, or the first unresolved group of a cycle
+		next := -1
+
+		for i := range groups {
+			if !done[i] && pending[i] == 0 {
+				next = i
+				break
+			}
+		}
+
+		if next == -1 {
+			next = slices.Index(done, false)
+		}
+
+		done[next] = true
+		order = append(order, next)
+
+		for i := range dependents[next] {
+			if !done[i] {
+				pending[i]--
+			}
+		}
+	}
+
+	return order
+}
+
+// removeNodes removes the nodes at the given indices from the subtree, and their
+// TxInpoints from the meta, moving the remaining nodes forward.
+func (s *Meta) removeNodes(indices map[int]struct{}) {
+	st := s.Subtree
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	removedHashes := make(map[chainhash.Hash]struct{}, len(indices))
+	kept := 0
+
+	for i := range st.Nodes {
+		if _, ok := indices[i]; ok {
+			removedHashes[st.Nodes[i].Hash] = struct{}{}
+			st.Fees -= st.Nodes[i].Fee
+			st.SizeInBytes -= st.Nodes[i].SizeInBytes
+
+			continue
+		}
+
+		st.Nodes[kept] = st.Nodes[i]
+
+		if i < len(s.TxInpoints) {
+			s.TxInpoints[kept] = s.TxInpoints[i]
+		}
+
+		kept++
+	}
+
+	if kept < len(s.TxInpoints) {
+		clear(s.TxInpoints[kept:Min(len(st.Nodes), len(s.TxInpoints))])
+	}
+
+	st.Nodes = st.Nodes[:kept]
+	st.rootHash = nil
+	st.nodeIndex = nil
+
+	st.ConflictingNodes = slices.DeleteFunc(st.ConflictingNodes, func(hash chainhash.Hash) bool {
+		_, ok := removedHashes[hash]
+		return ok
+	})
+	st.conflicting = nil
+}
@@ -0,0 +1,273 @@
+package subtree
+
+import (
+	"testing"
+
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildConflictMeta creates a meta for a subtree with the given nodes, in which node i
+// spends the given inpoints.
+func buildConflictMeta(t *testing.T, nodes []Node, inpoints [][]Inpoint) *Meta {
+	t.Helper()
+
+	st, err := NewTreeByLeafCount(CeilPowerOfTwo(len(nodes)))
+	require.NoError(t, err)
+
+	for _, node := range nodes {
+		require.NoError(t, st.AddSubtreeNode(node))
+	}
+
+	meta := NewSubtreeMeta(st)
+
+	for i := range nodes {
+		p := NewTxInpoints()
+		for _, inpoint := range inpoints[i] {
+			p.appendInput(inpoint.Hash, inpoint.Index)
+		}
+
+		require.NoError(t, meta.SetTxInpoints(i, p))
+	}
+
+	return meta
+}
+
+// lastOnlyPolicy only ranks the last spender of every group.
+type lastOnlyPolicy struct{}
+
+func (lastOnlyPolicy) Rank(_ *ConflictContext, group ConflictGroup) []Spender {
+	return group.Spenders[len(group.Spenders)-1:]
+}
+
+func TestResolveConflicts(t *testing.T) {
+	h := make([]chainhash.Hash, 8)
+	for i := range h {
+		h[i] = chainhash.HashH([]byte{byte(i), 'r'})
+	}
+
+	e := make([]chainhash.Hash, 4)
+	for i := range e {
+		e[i] = chainhash.HashH([]byte{byte(i), 'e'})
+	}
+
+	// h0 and h1 spend e0, h2 spends h0 and h3 spends h2, h4 and h5 do not conflict
+	buildMeta := func(t *testing.T) *Meta {
+		return buildConflictMeta(t, []Node{
+			{Hash: h[0], Fee: 10, SizeInBytes: 100},
+			{Hash: h[1], Fee: 50, SizeInBytes: 100},
+			{Hash: h[2], Fee: 20, SizeInBytes: 100},
+			{Hash: h[3], Fee: 30, SizeInBytes: 100},
+			{Hash: h[4], Fee: 40, SizeInBytes: 100},
+			{Hash: h[5], Fee: 60, SizeInBytes: 100},
+		}, [][]Inpoint{
+			{{Hash: e[0]}},
+			{{Hash: e[0]}, {Hash: e[1], Index: 1}},
+			{{Hash: h[0]}},
+			{{Hash: h[2]}},
+			{{Hash: e[2]}},
+			{{Hash: e[3]}},
+		})
+	}
+
+	spender := func(i int) Spender {
+		return Spender{TxHash: h[i], Subtree: 0, Index: i}
+	}
+
+	t.Run("first seen", func(t *testing.T) {
+		resolution, err := ResolveConflicts(FirstSeenConflictPolicy{}, buildMeta(t))
+		require.NoError(t, err)
+		require.Len(t, resolution.Groups, 1)
+		assert.Equal(t, []Spender{spender(0)}, resolution.Winners)
+		assert.Equal(t, []Spender{spender(1)}, resolution.Losers)
+		assert.Equal(t, []Spender{spender(1)}, resolution.Removed)
+	})
+
+	t.Run("fee rate", func(t *testing.T) {
+		resolution, err := ResolveConflicts(FeeRateConflictPolicy{}, buildMeta(t))
+		require.NoError(t, err)
+		assert.Equal(t, []Spender{spender(1)}, resolution.Winners)
+		assert.Equal(t, []Spender{spender(0)}, resolution.Losers)
+		assert.Equal(t, []Spender{spender(0), spender(2), spender(3)}, resolution.Removed)
+	})
+
+	t.Run("largest package", func(t *testing.T) {
+		resolution, err := ResolveConflicts(PackageConflictPolicy{}, buildMeta(t))
+		require.NoError(t, err)
+		assert.Equal(t, []Spender{spender(0)}, resolution.Winners)
+		assert.Equal(t, []Spender{spender(1)}, resolution.Removed)
+	})
+
+	t.Run("equal fee rates are ranked in block order", func(t *testing.T) {
+		meta := buildConflictMeta(t, []Node{
+			{Hash: h[0], Fee: 10, SizeInBytes: 100},
+			{Hash: h[1], Fee: 20, SizeInBytes: 200},
+		}, [][]Inpoint{{{Hash: e[0]}}, {{Hash: e[0]}}})
+
+		resolution, err := ResolveConflicts(FeeRateConflictPolicy{}, meta)
+		require.NoError(t, err)
+		assert.Equal(t, []Spender{spender(0)}, resolution.Winners)
+	})
+
+	t.Run("chained conflicts", func(t *testing.T) {
+		// h0 and h1 spend e0, h1 and h2 spend e1: removing h1 resolves both
+		meta := buildConflictMeta(t, []Node{
+			{Hash: h[0], Fee: 1, SizeInBytes: 1},
+			{Hash: h[1], Fee: 1, SizeInBytes: 1},
+			{Hash: h[2], Fee: 1, SizeInBytes: 1},
+		}, [][]Inpoint{{{Hash: e[0]}}, {{Hash: e[0]}, {Hash: e[1]}}, {{Hash: e[1]}}})
+
+		resolution, err := ResolveConflicts(FirstSeenConflictPolicy{}, meta)
+		require.NoError(t, err)
+		require.Len(t, resolution.Groups, 1)
+		assert.Equal(t, []Spender{spender(0), spender(2)}, resolution.Winners)
+		assert.Equal(t, []Spender{spender(1)}, resolution.Removed)
+	})
+
+	t.Run("winner depending on a loser", func(t *testing.T) {
+		// h0 and h1 spend e0, h2 spends h0 and conflicts with h3 on e1
+		meta := buildConflictMeta(t, []Node{
+			{Hash: h[0], Fee: 1, SizeInBytes: 1},
+			{Hash: h[1], Fee: 1, SizeInBytes: 1},
+			{Hash: h[2], Fee: 1, SizeInBytes: 1},
+			{Hash: h[3], Fee: 1, SizeInBytes: 1},
+		}, [][]Inpoint{{{Hash: e[0]}}, {{Hash: e[0]}}, {{Hash: h[0]}, {Hash: e[1]}}, {{Hash: e[1]}}})
+
+		resolution, err := ResolveConflicts(lastOnlyPolicy{}, meta)
+		require.NoError(t, err)
+		require.Len(t, resolution.Groups, 2)
+		assert.Equal(t, []Spender{spender(1), spender(3)}, resolution.Winners)
+		assert.Equal(t, []Spender{spender(0), spender(2)}, resolution.Losers)
+		assert.Equal(t, []Spender{spender(0), spender(2)}, resolution.Removed)
+	})
+
+	t.Run("group resolved after the group it depends on", func(t *testing.T) {
+		// h0 and h3 spend e1, h1 and h2 spend e0, h3 also spends h1: h1 loses to h2, which
+		// removes h3, so h0 is kept although h3 pays the higher fee rate in its group
+		meta := buildConflictMeta(t, []Node{
+			{Hash: h[0], Fee: 10, SizeInBytes: 100},
+			{Hash: h[1], Fee: 10, SizeInBytes: 100},
+			{Hash: h[2], Fee: 50, SizeInBytes: 100},
+			{Hash: h[3], Fee: 40, SizeInBytes: 100},
+		}, [][]Inpoint{{{Hash: e[1]}}, {{Hash: e[0]}}, {{Hash: e[0]}}, {{Hash: h[1]}, {Hash: e[1]}}})
+
+		resolution, err := ResolveConflicts(FeeRateConflictPolicy{}, meta)
+		require.NoError(t, err)
+		require.Len(t, resolution.Groups, 2)
+		assert.Equal(t, []Spender{spender(0), spender(2)}, resolution.Winners)
+		assert.Equal(t, []Spender{spender(1), spender(3)}, resolution.Losers)
+		assert.Equal(t, []Spender{spender(1), spender(3)}, resolution.Removed)
+	})
+
+	t.Run("no conflicts", func(t *testing.T) {
+		meta := buildConflictMeta(t, []Node{{Hash: h[0], Fee: 1, SizeInBytes: 1}}, [][]Inpoint{{{Hash: e[0]}}})
+
+		resolution, err := ResolveConflicts(FirstSeenConflictPolicy{}, meta)
+		require.NoError(t, err)
+		assert.Empty(t, resolution.Groups)
+		assert.Empty(t, resolution.Removed)
+	})
+
+	t.Run("invalid metas", func(t *testing.T) {
+		_, err := ResolveConflicts(FirstSeenConflictPolicy{}, nil)
+		require.ErrorIs(t, err, ErrSubtreeMetaNil)
+	})
+}
+
+func TestApplyConflictResolution(t *testing.T) {
+	h := make([]chainhash.Hash, 6)
+	for i := range h {
+		h[i] = chainhash.HashH([]byte{byte(i), 'a'})
+	}
+
+	e := chainhash.HashH([]byte("e"))
+
+	// the coinbase placeholder, h1 and h2 spend e, h3 spends h1, h4 does not conflict
+	buildMetas := func(t *testing.T) []*Meta {
+		st, err := NewTreeByLeafCount(8)
+		require.NoError(t, err)
+		require.NoError(t, st.AddCoinbaseNode())
+
+		for i := 1; i < 5; i++ {
+			require.NoError(t, st.AddNode(h[i], uint64(i*10), uint64(i*100))) //nolint:gosec // G115: test data
+		}
+
+		meta := NewSubtreeMeta(st)
+		parents := []Inpoint{{}, {Hash: e}, {Hash: e}, {Hash: h[1]}, {Hash: h[5]}}
+
+		for i := 1; i < 5; i++ {
+			p := NewTxInpoints()
+			p.appendInput(parents[i].Hash, parents[i].Index)
+			require.NoError(t, meta.SetTxInpoints(i, p))
+		}
+
+		other := buildChainMeta(t, 2, []chainhash.Hash{h[0]}, [][]chainhash.Hash{{h[4]}})
+
+		return []*Meta{meta, other}
+	}
+
+	t.Run("compaction", func(t *testing.T) {
+		metas := buildMetas(t)
+		meta := metas[0]
+		st := meta.Subtree
+
+		_, err := MarkConflictingNodes(metas...)
+		require.NoError(t, err)
+		assert.Equal(t, []chainhash.Hash{h[1], h[2]}, st.ConflictingNodes)
+		assert.True(t, st.IsConflicting(h[1]))
+
+		// keep h2, which removes h1 and h3
+		resolution, err := ResolveConflicts(lastOnlyPolicy{}, metas...)
+		require.NoError(t, err)
+		require.Len(t, resolution.Removed, 2)
+
+		expectedInpoints := []TxInpoints{meta.TxInpoints[0], meta.TxInpoints[2], meta.TxInpoints[4]}
+
+		require.NoError(t, ApplyConflictResolution(resolution, metas...))
+
+		require.Equal(t, 3, st.Length())
+		assert.Equal(t, []chainhash.Hash{CoinbasePlaceholderHashValue, h[2], h[4]}, []chainhash.Hash{st.Nodes[0].Hash, st.Nodes[1].Hash, st.Nodes[2].Hash})
+		assert.Equal(t, uint64(60), st.Fees)
+		assert.Equal(t, uint64(600), st.SizeInBytes)
+		assert.Equal(t, expectedInpoints, meta.TxInpoints[:3])
+		assert.Equal(t, TxInpoints{}, meta.TxInpoints[3])
+		assert.Equal(t, TxInpoints{}, meta.TxInpoints[4])
+		assert.Equal(t, []chainhash.Hash{h[2]}, st.ConflictingNodes)
+		assert.False(t, st.IsConflicting(h[1]))
+		assert.True(t, st.IsConflicting(h[2]))
+		assert.Equal(t, 1, st.NodeIndex(h[2]))
+		assert.Equal(t, -1, st.NodeIndex(h[1]))
+
+		expected, err := NewTreeByLeafCount(8)
+		require.NoError(t, err)
+		require.NoError(t, expected.AddCoinbaseNode())
+		require.NoError(t, expected.AddNode(h[2], 20, 200))
+		require.NoError(t, expected.AddNode(h[4], 40, 400))
+		assert.Equal(t, expected.RootHash(), st.RootHash())
+
+		// the other subtree is not changed
+		assert.Equal(t, 1, metas[1].Subtree.Length())
+
+		// the resolved subtrees no longer conflict
+		resolution, err = ResolveConflicts(FirstSeenConflictPolicy{}, metas...)
+		require.NoError(t, err)
+		assert.Empty(t, resolution.Removed)
+	})
+
+	t.Run("resolution for other subtrees", func(t *testing.T) {
+		metas := buildMetas(t)
+
+		resolution, err := ResolveConflicts(FirstSeenConflictPolicy{}, metas...)
+		require.NoError(t, err)
+
+		resolution.Removed = append(resolution.Removed, Spender{TxHash: h[5], Subtree: 0, Index: 4})
+
+		require.ErrorIs(t, ApplyConflictResolution(resolution, metas...), ErrNodeNotFound)
+		assert.Equal(t, 5, metas[0].Subtree.Length())
+
+		require.ErrorIs(t, ApplyConflictResolution(resolution, metas[1]), ErrNodeNotFound)
+		require.ErrorIs(t, ApplyConflictResolution(resolution), ErrIndexOutOfRange)
+		assert.Equal(t, 5, metas[0].Subtree.Length())
+	})
+}
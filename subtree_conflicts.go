@@ -0,0 +1,142 @@
+package subtree
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"slices"
+)
+
+// ConflictGroup is a set of transactions connected by the outpoints they spend: every
+// transaction in the group spends at least one outpoint that is also spent by another
+// transaction in the group. At most one transaction of every contested outpoint can be
+// mined, block assembly has to choose the winners.
+type ConflictGroup struct {
+	// Spenders are the transactions in the group, in block order
+	Spenders []Spender
+	// Inpoints are the outpoints spent by more than one transaction of the group, sorted
+	// by hash and index
+	Inpoints []Inpoint
+}
+
+// ConflictGroups returns the groups of transactions spending the same outpoints, built
+// from all conflicts found since the index was created. The groups are sorted by the
+// position of their first transaction, so the result is deterministic for the same
+// subtrees.
+func (si *SpentIndex) ConflictGroups() []ConflictGroup {
+	if len(si.conflicts) == 0 {
+		return nil
+	}
+
+	// union-find over the positions of the spenders
+	ids := make(map[nodePosition]int, len(si.conflicts)*2)
+	spenders := make([]Spender, 0, len(si.conflicts)*2)
+	parent := make([]int, 0, len(si.conflicts)*2)
+
+	id := func(s Spender) int {
+		pos := nodePosition{subtree: s.Subtree, index: s.Index}
+		if i, ok := ids[pos]; ok {
+			return i
+		}
+
+		ids[pos] = len(spenders)
+		spenders = append(spenders, s)
+		parent = append(parent, len(parent))
+
+		return len(spenders) - 1
+	}
+
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+
+		return i
+	}
+
+	for _, conflict := range si.conflicts {
+		parent[find(id(conflict.Second))] = find(id(conflict.First))
+	}
+
+	groupIdx := make(map[int]int)
+	groups := make([]ConflictGroup, 0)
+
+	for i := range spenders {
+		root := find(i)
+
+		g, ok := groupIdx[root]
+		if !ok {
+			g = len(groups)
+			groupIdx[root] = g
+			groups = append(groups, ConflictGroup{})
+		}
+
+		groups[g].Spenders = append(groups[g].Spenders, spenders[i])
+	}
+
+	for _, conflict := range si.conflicts {
+		g := groupIdx[find(ids[nodePosition{subtree: conflict.First.Subtree, index: conflict.First.Index}])]
+		groups[g].Inpoints = append(groups[g].Inpoints, conflict.Inpoint)
+	}
+
+	for i := range groups {
+		slices.SortFunc(groups[i].Spenders, compareSpenders)
+
+		slices.SortFunc(groups[i].Inpoints, compareInpoints)
+		groups[i].Inpoints = slices.Compact(groups[i].Inpoints)
+	}
+
+	slices.SortFunc(groups, func(a, b ConflictGroup) int {
+		return compareSpenders(a.Spenders[0], b.Spenders[0])
+	})
+
+	return groups
+}
+
+// MarkConflictingNodes finds all transactions of the subtrees of the metas that spend an
+// outpoint that is also spent by another transaction in the subtrees, and marks each of
+// them as conflicting on its subtree with AddConflictingNode.
+//
+// Parameters:
+//   - metas: The Meta objects of the subtrees, in block order
+//
+// Returns:
+//   - []ConflictGroup: The groups of conflicting transactions, see SpentIndex.ConflictGroups
+//   - error: An error if a meta or its subtree is not set
+func MarkConflictingNodes(metas ...*Meta) ([]ConflictGroup, error) {
+	si, err := NewSpentIndex(metas...)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := si.ConflictGroups()
+
+	for _, group := range groups {
+		for _, spender := range group.Spenders {
+			if err = metas[spender.Subtree].Subtree.AddConflictingNode(spender.TxHash); err != nil {
+				return nil, fmt.Errorf("meta %d: %w", spender.Subtree, err)
+			}
+		}
+	}
+
+	return groups, nil
+}
+
+// compareSpenders orders spenders by their position in the block.
+func compareSpenders(a, b Spender) int {
+	if c := cmp.Compare(a.Subtree, b.Subtree); c != 0 {
+		return c
+	}
+
+	return cmp.Compare(a.Index, b.Index)
+}
+
+// compareInpoints orders inpoints by hash and index.
+func compareInpoints(a, b Inpoint) int {
+	if c := bytes.Compare(a.Hash[:], b.Hash[:]); c != 0 {
+		return c
+	}
+
+	return cmp.Compare(a.Index, b.Index)
+}
@@ -0,0 +1,97 @@
+package subtree
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarkConflictingNodes(t *testing.T) {
+	h := make([]chainhash.Hash, 8)
+	for i := range h {
+		h[i] = chainhash.HashH([]byte{byte(i), 'c'})
+	}
+
+	e := make([]chainhash.Hash, 4)
+	for i := range e {
+		e[i] = chainhash.HashH([]byte{byte(i), 'e'})
+	}
+
+	// h0 and h2 spend e0, h2 and h3 spend e1: one group of three transactions
+	// h1 and h5 spend e2, across the subtrees
+	// h4, h6 and h7 do not conflict
+	buildMetas := func(t *testing.T) []*Meta {
+		return []*Meta{
+			buildChainMeta(t, 4, h[:4], [][]chainhash.Hash{{e[0]}, {e[2]}, {e[1], e[0]}, {e[1]}}),
+			buildChainMeta(t, 4, h[4:], [][]chainhash.Hash{{h[0]}, {e[2]}, {e[3]}, {h[6]}}),
+		}
+	}
+
+	t.Run("groups", func(t *testing.T) {
+		metas := buildMetas(t)
+
+		groups, err := MarkConflictingNodes(metas...)
+		require.NoError(t, err)
+		require.Len(t, groups, 2)
+
+		assert.Equal(t, []Spender{
+			{TxHash: h[0], Subtree: 0, Index: 0},
+			{TxHash: h[2], Subtree: 0, Index: 2},
+			{TxHash: h[3], Subtree: 0, Index: 3},
+		}, groups[0].Spenders)
+
+		expected := []Inpoint{{Hash: e[0]}, {Hash: e[1]}}
+		slices.SortFunc(expected, compareInpoints)
+		assert.Equal(t, expected, groups[0].Inpoints)
+
+		assert.Equal(t, []Spender{
+			{TxHash: h[1], Subtree: 0, Index: 1},
+			{TxHash: h[5], Subtree: 1, Index: 1},
+		}, groups[1].Spenders)
+		assert.Equal(t, []Inpoint{{Hash: e[2]}}, groups[1].Inpoints)
+
+		for i, conflicting := range []bool{true, true, true, true, false, true, false, false} {
+			st := metas[i/4].Subtree
+			assert.Equal(t, conflicting, st.IsConflicting(h[i]), "tx %d", i)
+		}
+
+		assert.Len(t, metas[0].Subtree.ConflictingNodes, 4)
+		assert.Equal(t, []chainhash.Hash{h[5]}, metas[1].Subtree.ConflictingNodes)
+
+		// marking again does not add duplicates, and gives the same groups
+		groups2, err := MarkConflictingNodes(metas...)
+		require.NoError(t, err)
+		assert.Equal(t, groups, groups2)
+		assert.Len(t, metas[0].Subtree.ConflictingNodes, 4)
+	})
+
+	t.Run("groups are merged", func(t *testing.T) {
+		// h3 conflicts with h0 and with h1, which do not conflict with each other
+		meta := buildChainMeta(t, 4, h[:4], [][]chainhash.Hash{{e[0]}, {e[1]}, {e[3]}, {e[1], e[0]}})
+
+		si, err := NewSpentIndex(meta)
+		require.NoError(t, err)
+
+		groups := si.ConflictGroups()
+		require.Len(t, groups, 1)
+		assert.Len(t, groups[0].Spenders, 3)
+		assert.Len(t, groups[0].Inpoints, 2)
+	})
+
+	t.Run("no conflicts", func(t *testing.T) {
+		meta := buildChainMeta(t, 4, h[:4], [][]chainhash.Hash{{e[0]}, {e[1]}, {e[2]}, {e[3]}})
+
+		groups, err := MarkConflictingNodes(meta)
+		require.NoError(t, err)
+		assert.Empty(t, groups)
+		assert.Empty(t, meta.Subtree.ConflictingNodes)
+	})
+
+	t.Run("invalid metas", func(t *testing.T) {
+		_, err := MarkConflictingNodes(buildMetas(t)[0], nil)
+		require.ErrorIs(t, err, ErrSubtreeMetaNil)
+	})
+}
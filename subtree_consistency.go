@@ -0,0 +1,174 @@
+package subtree
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+)
+
+// DiscrepancyKind is the kind of inconsistency found between subtree data and meta.
+type DiscrepancyKind uint8
+
+const (
+	// DiscrepancyTxMissing indicates that the data has no transaction at the index
+	DiscrepancyTxMissing DiscrepancyKind = iota + 1
+	// DiscrepancyTxIDMismatch indicates that the txid of the transaction in the data does not match the subtree node
+	DiscrepancyTxIDMismatch
+	// DiscrepancyInpointsMissing indicates that the meta has no inpoints set at the index
+	DiscrepancyInpointsMissing
+	// DiscrepancyInpointsMismatch indicates that the inpoints in the meta differ from the inpoints of the transaction
+	DiscrepancyInpointsMismatch
+)
+
+// String returns a string representation of the discrepancy kind.
+func (k DiscrepancyKind) String() string {
+	switch k {
+	case DiscrepancyTxMissing:
+		return "tx missing"
+	case DiscrepancyTxIDMismatch:
+		return "txid mismatch"
+	case DiscrepancyInpointsMissing:
+		return "inpoints missing"
+	case DiscrepancyInpointsMismatch:
+		return "inpoints mismatch"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(k))
+	}
+}
+
+// Discrepancy describes an inconsistency between the subtree, its data and its meta
+// at a single index.
+type Discrepancy struct {
+	// Kind is the kind of inconsistency
+	Kind DiscrepancyKind
+	// Index is the index of the node in the subtree
+	Index int
+	// TxID is the txid of the node in the subtree
+	TxID chainhash.Hash
+	// ActualTxID is the txid of the transaction in the data, only set for DiscrepancyTxIDMismatch
+	ActualTxID chainhash.Hash
+	// Expected are the inpoints computed from the transaction in the data, only set for DiscrepancyInpointsMismatch
+	Expected TxInpoints
+	// Actual are the inpoints stored in the meta, only set for DiscrepancyInpointsMismatch
+	Actual TxInpoints
+}
+
+// String returns a string representation of the discrepancy.
+func (d Discrepancy) String() string {
+	switch d.Kind {
+	case DiscrepancyTxIDMismatch:
+		return fmt.Sprintf("%s at index %d: expected %s, got %s", d.Kind, d.Index, d.TxID.String(), d.ActualTxID.String())
+	case DiscrepancyInpointsMismatch:
+		return fmt.Sprintf("%s at index %d for %s: expected %s, got %s", d.Kind, d.Index, d.TxID.String(), d.Expected.String(), d.Actual.String())
+	default:
+		return fmt.Sprintf("%s at index %d for %s", d.Kind, d.Index, d.TxID.String())
+	}
+}
+
+// ValidateDataAgainstMeta cross-checks the subtree data with the subtree meta. For every
+// node in the subtree it checks that the data holds the transaction with the txid of the
+// node, and that the inpoints stored in the meta match the inpoints computed from that
+// transaction with NewTxInpointsFromTx, as a set, see TxInpoints.Equal. The coinbase
+// placeholder is not checked.
+//
+// Parameters:
+//   - data: The subtree data holding the transactions
+//   - meta: The subtree meta holding the inpoints, for the same subtree as the data
+//
+// Returns:
+//   - []Discrepancy: Every discrepancy found, ordered by index, empty when the data and meta are consistent
+//   - error: An error if the data, meta or their subtrees are not set, or if they are for different subtrees
+func ValidateDataAgainstMeta(data *Data, meta *Meta) ([]Discrepancy, error) {
+	if data == nil || data.Subtree == nil {
+		return nil, ErrSubtreeNil
+	}
+
+	if meta == nil || meta.Subtree == nil {
+		return nil, ErrSubtreeMetaNil
+	}
+
+	if data.Subtree != meta.Subtree && !data.Subtree.RootHash().Equal(*meta.Subtree.RootHash()) {
+		return nil, fmt.Errorf("%w: data is for %s, meta is for %s", ErrSubtreeRootMismatch,
+			data.Subtree.RootHash().String(), meta.Subtree.RootHash().String())
+	}
+
+	length := data.Subtree.Length()
+
+	var start int
+	if data.Subtree.HasCoinbasePlaceholder() {
+		start = 1
+	}
+
+	if length-start <= setOperationSplitSize {
+		discrepancies := validateDataAgainstMetaRange(data, meta, start, length)
+		if discrepancies == nil {
+			discrepancies = []Discrepancy{}
+		}
+
+		return discrepancies, nil
+	}
+
+	chunks := splitRange(length - start)
+	results := make([][]Discrepancy, len(chunks))
+
+	var wg sync.WaitGroup
+
+	for i, chunk := range chunks {
+		wg.Add(1)
+
+		go func(i, from, to int) {
+			defer wg.Done()
+
+			results[i] = validateDataAgainstMetaRange(data, meta, from, to)
+		}(i, start+chunk[0], start+chunk[1])
+	}
+
+	wg.Wait()
+
+	discrepancies := make([]Discrepancy, 0)
+	for _, result := range results {
+		discrepancies = append(discrepancies, result...)
+	}
+
+	return discrepancies, nil
+}
+
+// validateDataAgainstMetaRange returns the discrepancies for the nodes in [from, to).
+func validateDataAgainstMetaRange(data *Data, meta *Meta, from, to int) []Discrepancy {
+	var discrepancies []Discrepancy
+
+	for i := from; i < to; i++ {
+		txID := data.Subtree.Nodes[i].Hash
+
+		if i >= len(data.Txs) || data.Txs[i] == nil {
+			discrepancies = append(discrepancies, Discrepancy{Kind: DiscrepancyTxMissing, Index: i, TxID: txID})
+			continue
+		}
+
+		tx := data.Txs[i]
+		if actual := *tx.TxIDChainHash(); !actual.Equal(txID) {
+			discrepancies = append(discrepancies, Discrepancy{Kind: DiscrepancyTxIDMismatch, Index: i, TxID: txID, ActualTxID: actual})
+			continue
+		}
+
+		// nil parent tx hashes indicate the inpoints have not been set, see NewTxInpoints
+		if i >= len(meta.TxInpoints) || meta.TxInpoints[i].ParentTxHashes == nil {
+			discrepancies = append(discrepancies, Discrepancy{Kind: DiscrepancyInpointsMissing, Index: i, TxID: txID})
+			continue
+		}
+
+		expected, err := NewTxInpointsFromTx(tx)
+		if err != nil || !expected.Equal(&meta.TxInpoints[i]) {
+			discrepancies = append(discrepancies, Discrepancy{
+				Kind:     DiscrepancyInpointsMismatch,
+				Index:    i,
+				TxID:     txID,
+				Expected: expected,
+				Actual:   meta.TxInpoints[i],
+			})
+		}
+	}
+
+	return discrepancies
+}
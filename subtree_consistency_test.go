@@ -0,0 +1,166 @@
+package subtree
+
+import (
+	"testing"
+
+	"github.com/bsv-blockchain/go-bt/v2"
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupConsistencyTest(t *testing.T) ([]*bt.Tx, *Data, *Meta) {
+	t.Helper()
+
+	txs, subtree, meta := initMeta(t)
+
+	data := NewSubtreeData(subtree)
+	for i, tx := range txs {
+		require.NoError(t, data.AddTx(tx, i))
+	}
+
+	return txs, data, meta
+}
+
+func TestValidateDataAgainstMeta(t *testing.T) {
+	t.Run("consistent", func(t *testing.T) {
+		_, data, meta := setupConsistencyTest(t)
+
+		discrepancies, err := ValidateDataAgainstMeta(data, meta)
+		require.NoError(t, err)
+		assert.Empty(t, discrepancies)
+	})
+
+	t.Run("inpoints in a different order", func(t *testing.T) {
+		_, data, meta := setupConsistencyTest(t)
+
+		multiTx := data.Txs[1]
+		parent := chainhash.HashH([]byte("parent"))
+
+		input := &bt.Input{PreviousTxOutIndex: 7, SequenceNumber: 0xffffffff}
+		require.NoError(t, input.PreviousTxIDAdd(&parent))
+		multiTx.Inputs = append(multiTx.Inputs, input)
+
+		expected, err := NewTxInpointsFromTx(multiTx)
+		require.NoError(t, err)
+
+		data.Subtree.Nodes[1].Hash = *multiTx.TxIDChainHash()
+		require.NoError(t, meta.SetTxInpoints(1, expected.Canonical()))
+
+		discrepancies, err := ValidateDataAgainstMeta(data, meta)
+		require.NoError(t, err)
+		assert.Empty(t, discrepancies)
+	})
+
+	t.Run("reports every discrepancy in order", func(t *testing.T) {
+		txs, data, meta := setupConsistencyTest(t)
+
+		data.Txs[0] = nil
+		data.Txs[1] = txs[2]
+		meta.TxInpoints[2] = TxInpoints{}
+
+		staleInpoints := txInpointsFromParentVouts(chainhash.HashH([]byte("stale")), 7)
+		require.NoError(t, meta.SetTxInpoints(3, staleInpoints))
+
+		discrepancies, err := ValidateDataAgainstMeta(data, meta)
+		require.NoError(t, err)
+		require.Len(t, discrepancies, 4)
+
+		assert.Equal(t, Discrepancy{Kind: DiscrepancyTxMissing, Index: 0, TxID: *txs[0].TxIDChainHash()}, discrepancies[0])
+		assert.Equal(t, Discrepancy{
+			Kind:       DiscrepancyTxIDMismatch,
+			Index:      1,
+			TxID:       *txs[1].TxIDChainHash(),
+			ActualTxID: *txs[2].TxIDChainHash(),
+		}, discrepancies[1])
+		assert.Equal(t, Discrepancy{Kind: DiscrepancyInpointsMissing, Index: 2, TxID: *txs[2].TxIDChainHash()}, discrepancies[2])
+
+		expected, err := NewTxInpointsFromTx(txs[3])
+		require.NoError(t, err)
+
+		assert.Equal(t, DiscrepancyInpointsMismatch, discrepancies[3].Kind)
+		assert.Equal(t, 3, discrepancies[3].Index)
+		assert.Equal(t, expected, discrepancies[3].Expected)
+		assert.Equal(t, staleInpoints, discrepancies[3].Actual)
+
+		assert.Contains(t, discrepancies[1].String(), "txid mismatch at index 1")
+		assert.Contains(t, discrepancies[3].String(), "inpoints mismatch at index 3")
+	})
+
+	t.Run("meta shorter than the subtree", func(t *testing.T) {
+		txs, data, meta := setupConsistencyTest(t)
+
+		meta.TxInpoints = meta.TxInpoints[:3]
+
+		discrepancies, err := ValidateDataAgainstMeta(data, meta)
+		require.NoError(t, err)
+		assert.Equal(t, []Discrepancy{{Kind: DiscrepancyInpointsMissing, Index: 3, TxID: *txs[3].TxIDChainHash()}}, discrepancies)
+	})
+
+	t.Run("coinbase placeholder is skipped", func(t *testing.T) {
+		subtree, data, txs := setupCoinbaseTestSubtreeData(t)
+
+		meta := NewSubtreeMeta(subtree)
+		for _, tx := range txs {
+			require.NoError(t, meta.SetTxInpointsFromTx(tx))
+		}
+
+		discrepancies, err := ValidateDataAgainstMeta(data, meta)
+		require.NoError(t, err)
+		assert.Empty(t, discrepancies)
+	})
+
+	t.Run("different subtrees", func(t *testing.T) {
+		_, data, _ := setupConsistencyTest(t)
+		_, _, otherMeta := setupConsistencyTest(t)
+
+		// same nodes, different subtree objects
+		discrepancies, err := ValidateDataAgainstMeta(data, otherMeta)
+		require.NoError(t, err)
+		assert.Empty(t, discrepancies)
+
+		subtree, _, _ := setupCoinbaseTestSubtreeData(t)
+
+		_, err = ValidateDataAgainstMeta(data, NewSubtreeMeta(subtree))
+		require.ErrorIs(t, err, ErrSubtreeRootMismatch)
+	})
+
+	t.Run("nil data or meta", func(t *testing.T) {
+		_, data, meta := setupConsistencyTest(t)
+
+		_, err := ValidateDataAgainstMeta(nil, meta)
+		require.ErrorIs(t, err, ErrSubtreeNil)
+
+		_, err = ValidateDataAgainstMeta(data, nil)
+		require.ErrorIs(t, err, ErrSubtreeMetaNil)
+	})
+
+	t.Run("large subtree", func(t *testing.T) {
+		subtree, dataBytes := buildLargeTestData(t, setOperationSplitSize+10)
+
+		data, err := NewSubtreeDataFromBytes(subtree, dataBytes)
+		require.NoError(t, err)
+
+		meta := NewSubtreeMeta(subtree)
+		for _, tx := range data.Txs {
+			require.NoError(t, meta.SetTxInpointsFromTx(tx))
+		}
+
+		meta.TxInpoints[5] = TxInpoints{}
+		meta.TxInpoints[setOperationSplitSize+5] = TxInpoints{}
+
+		discrepancies, err := ValidateDataAgainstMeta(data, meta)
+		require.NoError(t, err)
+		require.Len(t, discrepancies, 2)
+		assert.Equal(t, 5, discrepancies[0].Index)
+		assert.Equal(t, setOperationSplitSize+5, discrepancies[1].Index)
+	})
+}
+
+func TestDiscrepancyKindString(t *testing.T) {
+	assert.Equal(t, "tx missing", DiscrepancyTxMissing.String())
+	assert.Equal(t, "txid mismatch", DiscrepancyTxIDMismatch.String())
+	assert.Equal(t, "inpoints missing", DiscrepancyInpointsMissing.String())
+	assert.Equal(t, "inpoints mismatch", DiscrepancyInpointsMismatch.String())
+	assert.Equal(t, "unknown(0)", DiscrepancyKind(0).String())
+}
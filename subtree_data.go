@@ -2,7 +2,6 @@ package subtree
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	"io"
 
@@ -14,6 +13,22 @@ import (
 type Data struct {
 	Subtree *Subtree
 	Txs     []*bt.Tx
+
+	// Encoding is the encoding used when writing the transactions. When it is not set,
+	// the readers set it to the encoding of the transactions read, or leave it at
+	// DataEncodingAuto when the data holds both encodings, so data is written back in
+	// the encoding it was read in.
+	Encoding DataEncoding
+
+	// CoinbasePolicy determines whether the coinbase transaction is written in place of
+	// the coinbase placeholder. The readers set it to CoinbaseInclude when the data they
+	// read starts with the coinbase transaction.
+	CoinbasePolicy CoinbasePolicy
+
+	fill dataFill
+
+	// encodingDetected is set when Encoding has been set by a reader, see detectEncoding
+	encodingDetected bool
 }
 
 // NewSubtreeData creates a new Data object
@@ -26,6 +41,15 @@ func NewSubtreeData(subtree *Subtree) *Data {
 	}
 }
 
+// NewSubtreeDataWithEncoding creates a new Data object that writes its transactions
+// in the given encoding.
+func NewSubtreeDataWithEncoding(subtree *Subtree, encoding DataEncoding) *Data {
+	s := NewSubtreeData(subtree)
+	s.Encoding = encoding
+
+	return s
+}
+
 // NewSubtreeDataFromBytes creates a new Data object from the provided byte slice.
 func NewSubtreeDataFromBytes(subtree *Subtree, dataBytes []byte) (*Data, error) {
 	s := &Data{
@@ -56,59 +80,50 @@ func (s *Data) RootHash() *chainhash.Hash {
 }
 
 // AddTx adds a transaction to the subtree data at the specified index.
+//
+// Transactions can be added in any order and concurrently from multiple goroutines,
+// see Missing and IsComplete to find out which transactions are still needed. Adding
+// the same transaction again keeps the transaction that was set first and returns nil.
+// Only a different coinbase transaction added in place of the coinbase placeholder
+// returns ErrTxAlreadySet, it must not be added concurrently with another one. The Txs
+// slice should only be read once all concurrent calls to AddTx have returned.
 func (s *Data) AddTx(tx *bt.Tx, index int) error {
-	if index == 0 && tx.IsCoinbase() && s.Subtree.Nodes[index].Hash.Equal(CoinbasePlaceholderHashValue) {
-		// we got the coinbase tx as the first tx, we need to add it as the first tx and stop further processing
-		s.Txs[index] = tx
-
-		return nil
+	if index < 0 || index >= len(s.Txs) || index >= len(s.Subtree.Nodes) {
+		return fmt.Errorf("%w: %d", ErrTxIndexOutOfBounds, index)
 	}
 
-	// check whether this is set in the main subtree
-	if !s.Subtree.Nodes[index].Hash.Equal(*tx.TxIDChainHash()) {
+	// the coinbase tx of the block is added in place of the coinbase placeholder
+	if !isCoinbaseAt(s.Subtree, index, tx) && !s.Subtree.Nodes[index].Hash.Equal(*tx.TxIDChainHash()) {
 		return ErrTxHashMismatch
 	}
 
+	if !s.claim(index) {
+		// the node hash commits to the transaction, only the coinbase tx in place of the
+		// placeholder can differ from the transaction that was set before
+		if isCoinbaseAt(s.Subtree, index, tx) && s.Txs[index] != nil && !s.Txs[index].TxIDChainHash().Equal(*tx.TxIDChainHash()) {
+			return fmt.Errorf("%w at index %d", ErrTxAlreadySet, index)
+		}
+
+		return nil
+	}
+
 	s.Txs[index] = tx
+	s.countFilled(index)
 
 	return nil
 }
 
 // Serialize returns the serialized form of the subtree meta
 func (s *Data) Serialize() ([]byte, error) {
-	var err error
-
-	// only serialize when we have the matching subtree
-	if s.Subtree == nil {
-		return nil, ErrCannotSerializeSubtreeNotSet
-	}
-
-	var txStartIndex int
-	if s.Subtree.Nodes[0].Hash.Equal(*CoinbasePlaceholderHash) {
-		txStartIndex = 1
-	}
+	b, _, err := s.serialize(false)
 
-	// check the data in the subtree matches the data in the tx data
-	subtreeLen := s.Subtree.Length()
-	for i := txStartIndex; i < subtreeLen; i++ {
-		if s.Txs[i] == nil && i != 0 {
-			return nil, ErrSubtreeLengthMismatch
-		}
-	}
-
-	bufBytes := make([]byte, 0, 32*1024) // 16MB (arbitrary size, should be enough for most cases)
-	buf := bytes.NewBuffer(bufBytes)
-
-	for i := txStartIndex; i < subtreeLen; i++ {
-		b := s.Txs[i].SerializeBytes()
-
-		_, err = buf.Write(b)
-		if err != nil {
-			return nil, fmt.Errorf("error writing tx data: %w", err)
-		}
-	}
+	return b, err
+}
 
-	return buf.Bytes(), nil
+// SerializeWithIndex returns the serialized form of the subtree data, together with
+// a DataIndex holding the offset and length of every transaction in the returned bytes.
+func (s *Data) SerializeWithIndex() ([]byte, *DataIndex, error) {
+	return s.serialize(true)
 }
 
 // WriteTransactionsToWriter writes a range of transactions directly to a writer.
@@ -124,24 +139,43 @@ func (s *Data) Serialize() ([]byte, error) {
 //
 // Returns an error if writing fails or if required transactions are missing (nil).
 func (s *Data) WriteTransactionsToWriter(w io.Writer, startIdx, endIdx int) error {
+	return s.WriteTransactionsToWriterWithIndex(w, startIdx, endIdx, nil)
+}
+
+// WriteTransactionsToWriterWithIndex is identical to WriteTransactionsToWriter, but also
+// records the offset and length of every written transaction in index. Offsets continue
+// from the previous call with the same index, so consecutive ranges written to the same
+// writer produce the index of the complete data file. A nil index records nothing.
+func (s *Data) WriteTransactionsToWriterWithIndex(w io.Writer, startIdx, endIdx int, index *DataIndex) error {
 	if s.Subtree == nil {
 		return ErrCannotSerializeSubtreeNotSet
 	}
 
 	for i := startIdx; i < endIdx; i++ {
 		// Skip coinbase placeholder if it's the first transaction
-		if i == 0 && s.Subtree.Nodes[0].Hash.Equal(*CoinbasePlaceholderHash) {
+		if s.omitsTx(i) {
 			continue
 		}
 
 		if s.Txs[i] == nil {
+			if i == 0 && s.Subtree.HasCoinbasePlaceholder() {
+				return ErrCoinbaseTxMissing
+			}
+
 			return ErrTransactionNil
 		}
 
 		// Stream transaction directly to writer without intermediate allocation
-		if _, err := s.Txs[i].SerializeTo(w); err != nil {
+		n, err := writeTxWithEncoding(w, s.Txs[i], s.Encoding)
+		if err != nil {
 			return fmt.Errorf("%w at index %d: %w", ErrTransactionWrite, i, err)
 		}
+
+		if index != nil {
+			if err = index.record(i, n); err != nil {
+				return fmt.Errorf("unable to record index entry %d: %w", i, err)
+			}
+		}
 	}
 
 	return nil
@@ -159,18 +193,7 @@ func (s *Data) WriteTransactionsToWriter(w io.Writer, startIdx, endIdx int) erro
 //
 // Returns an error if writing fails.
 func WriteTransactionChunk(w io.Writer, txs []*bt.Tx) error {
-	for _, tx := range txs {
-		if tx == nil {
-			continue // Skip nil transactions
-		}
-
-		txBytes := tx.SerializeBytes()
-		if _, err := w.Write(txBytes); err != nil {
-			return fmt.Errorf("%w: %w", ErrTransactionWrite, err)
-		}
-	}
-
-	return nil
+	return WriteTransactionChunkWithEncoding(w, txs, DataEncodingAuto)
 }
 
 // ReadTransactionChunk reads and validates a chunk of transactions from a reader.
@@ -180,6 +203,10 @@ func WriteTransactionChunk(w io.Writer, txs []*bt.Tx) error {
 // memory-efficient than ReadTransactionsFromReader for processing workflows where the SubtreeData
 // array is not needed.
 //
+// The coinbase placeholder is handled the same way as by DataReader: when the chunk starts at
+// index 0 or 1 and the stream starts with the coinbase transaction, it is returned as the first
+// transaction of the chunk.
+//
 // Parameters:
 //   - r: Reader to read transactions from
 //   - subtree: Subtree structure for hash validation
@@ -193,29 +220,17 @@ func ReadTransactionChunk(r io.Reader, subtree *Subtree, startIdx, count int) ([
 	}
 
 	txs := make([]*bt.Tx, 0, count)
+	reader := newDataReaderAt(subtree, r, startIdx)
+	endIdx := Min(startIdx+count, len(subtree.Nodes))
 
-	for i := 0; i < count; i++ {
-		idx := startIdx + i
-		if idx >= len(subtree.Nodes) {
-			break // Reached end of subtree
-		}
-
-		// Skip coinbase placeholder
-		if idx == 0 && subtree.Nodes[0].Hash.Equal(CoinbasePlaceholderHashValue) {
-			continue
-		}
-
-		tx := &bt.Tx{}
-		if _, err := tx.ReadFrom(r); err != nil {
-			if errors.Is(err, io.EOF) {
+	for reader.index < endIdx {
+		_, tx, err := reader.Next()
+		if err != nil {
+			if err == io.EOF { //nolint:errorlint // a truncated transaction is not the end of the stream
 				break
 			}
-			return txs, fmt.Errorf("%w at index %d: %w", ErrTransactionRead, idx, err)
-		}
 
-		// Validate tx hash matches expected
-		if !subtree.Nodes[idx].Hash.Equal(*tx.TxIDChainHash()) {
-			return txs, ErrTxHashMismatch
+			return txs, err
 		}
 
 		txs = append(txs, tx)
@@ -229,6 +244,9 @@ func ReadTransactionChunk(r io.Reader, subtree *Subtree, startIdx, count int) ([
 // This enables memory-efficient deserialization by reading only a chunk of transactions
 // from disk at a time, rather than loading all transactions into memory.
 //
+// The coinbase placeholder is handled the same way as by DataReader: when the range starts at
+// index 0 or 1 and the stream starts with the coinbase transaction, it is stored at index 0.
+//
 // Parameters:
 //   - r: Reader to read transactions from
 //   - startIdx: Starting index (inclusive) where transactions should be stored
@@ -241,26 +259,22 @@ func (s *Data) ReadTransactionsFromReader(r io.Reader, startIdx, endIdx int) (in
 	}
 
 	txsRead := 0
-	for i := startIdx; i < endIdx; i++ {
-		// Skip coinbase placeholder
-		if i == 0 && s.Subtree.Nodes[0].Hash.Equal(CoinbasePlaceholderHashValue) {
-			continue
-		}
+	reader := newDataReaderAt(s.Subtree, r, startIdx)
+	endIdx = Min(endIdx, len(s.Subtree.Nodes))
 
-		tx := &bt.Tx{}
-		if _, err := tx.ReadFrom(r); err != nil {
-			if errors.Is(err, io.EOF) {
+	for reader.index < endIdx {
+		idx, tx, err := reader.Next()
+		if err != nil {
+			if err == io.EOF { //nolint:errorlint // a truncated transaction is not the end of the stream
 				break
 			}
-			return txsRead, fmt.Errorf("%w at index %d: %w", ErrTransactionRead, i, err)
-		}
 
-		// Validate tx hash matches expected
-		if !s.Subtree.Nodes[i].Hash.Equal(*tx.TxIDChainHash()) {
-			return txsRead, ErrTxHashMismatch
+			return txsRead, err
 		}
 
-		s.Txs[i] = tx
+		s.Txs[idx] = tx
+		s.markFilled(idx)
+		s.detectTx(idx, tx)
 		txsRead++
 	}
 
@@ -269,52 +283,108 @@ func (s *Data) ReadTransactionsFromReader(r io.Reader, startIdx, endIdx int) (in
 
 // serializeFromReader reads transactions from the provided reader and populates the Txs field.
 func (s *Data) serializeFromReader(buf io.Reader) error {
+	dataReader, err := NewDataReader(s.Subtree, buf)
+	if err != nil {
+		return err
+	}
+
+	// initialize the txs array
+	s.Txs = make([]*bt.Tx, s.Subtree.Length())
+
+	for idx, tx := range dataReader.All() {
+		s.Txs[idx] = tx
+		s.detectTx(idx, tx)
+	}
+
+	if err = dataReader.Err(); err != nil {
+		return fmt.Errorf("error reading transaction: %w", err)
+	}
+
+	return nil
+}
+
+// serialize returns the serialized transactions, and the DataIndex of the returned
+// bytes when withIndex is set.
+func (s *Data) serialize(withIndex bool) ([]byte, *DataIndex, error) {
 	var (
 		err     error
-		txIndex int
+		txBytes []byte
 	)
 
-	if s.Subtree == nil || len(s.Subtree.Nodes) == 0 {
-		return ErrSubtreeNodesEmpty
+	// only serialize when we have the matching subtree
+	if s.Subtree == nil {
+		return nil, nil, ErrCannotSerializeSubtreeNotSet
 	}
 
-	if s.Subtree.Nodes[0].Hash.Equal(CoinbasePlaceholderHashValue) {
-		txIndex = 1
+	var txStartIndex int
+	if s.omitsTx(0) {
+		txStartIndex = 1
 	}
 
-	// initialize the txs array
-	s.Txs = make([]*bt.Tx, s.Subtree.Length())
-
-	for {
-		tx := &bt.Tx{}
-
-		_, err = tx.ReadFrom(buf)
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break
+	// check the data in the subtree matches the data in the tx data
+	subtreeLen := s.Subtree.Length()
+	for i := txStartIndex; i < subtreeLen; i++ {
+		if s.Txs[i] == nil {
+			if i == 0 && s.Subtree.HasCoinbasePlaceholder() {
+				return nil, nil, ErrCoinbaseTxMissing
 			}
 
-			return fmt.Errorf("error reading transaction: %w", err)
+			return nil, nil, ErrSubtreeLengthMismatch
 		}
+	}
 
-		if txIndex == 1 && tx.IsCoinbase() {
-			// we got the coinbase tx as the first tx, we need to add it as the first tx and continue
-			s.Txs[0] = tx
+	var index *DataIndex
+	if withIndex {
+		index = NewDataIndex(subtreeLen)
+	}
 
-			continue
+	bufBytes := make([]byte, 0, 32*1024) // 16MB (arbitrary size, should be enough for most cases)
+	buf := bytes.NewBuffer(bufBytes)
+
+	for i := txStartIndex; i < subtreeLen; i++ {
+		txBytes, err = serializeTxWithEncoding(s.Txs[i], s.Encoding)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error writing tx data: %w", err)
 		}
 
-		if txIndex >= len(s.Subtree.Nodes) {
-			return ErrTxIndexOutOfBounds
+		_, err = buf.Write(txBytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error writing tx data: %w", err)
 		}
 
-		if !s.Subtree.Nodes[txIndex].Hash.Equal(*tx.TxIDChainHash()) {
-			return ErrTxHashMismatch
+		if index != nil {
+			if err = index.record(i, int64(len(txBytes))); err != nil {
+				return nil, nil, fmt.Errorf("unable to record index entry %d: %w", i, err)
+			}
 		}
+	}
 
-		s.Txs[txIndex] = tx
-		txIndex++
+	return buf.Bytes(), index, nil
+}
+
+// detectTx sets the coinbase policy and encoding of the data from a transaction read
+// at index.
+func (s *Data) detectTx(idx int, tx *bt.Tx) {
+	if isCoinbaseAt(s.Subtree, idx, tx) {
+		s.CoinbasePolicy = CoinbaseInclude
+		return
 	}
 
-	return nil
+	s.detectEncoding(tx)
+}
+
+// detectEncoding sets the encoding of the data to the encoding of tx, if it has not
+// been set yet. When a later transaction was read in another encoding, the data holds
+// both encodings and the encoding is reset to DataEncodingAuto, which writes every
+// transaction back in the encoding it has. An encoding set by the caller is kept.
+func (s *Data) detectEncoding(tx *bt.Tx) {
+	encoding := encodingOf(tx)
+
+	switch {
+	case s.Encoding == DataEncodingAuto && !s.encodingDetected:
+		s.Encoding = encoding
+		s.encodingDetected = true
+	case s.encodingDetected && s.Encoding != encoding:
+		s.Encoding = DataEncodingAuto
+	}
 }
@@ -0,0 +1,108 @@
+package subtree
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/bsv-blockchain/go-bt/v2"
+)
+
+// DataEncoding is the encoding of the transactions in a subtree data file.
+//
+// Transactions in the Extended Format (BIP-239) carry the satoshis and locking script
+// of the outputs they spend, which allows script validation directly from a subtree
+// data file. Every extended transaction starts with the EF marker, so readers detect
+// the encoding per transaction and handle both encodings transparently.
+type DataEncoding uint8
+
+const (
+	// DataEncodingAuto writes every transaction in the format it has, extended when
+	// the transaction is extended and standard otherwise. This is the zero value.
+	DataEncodingAuto DataEncoding = iota
+	// DataEncodingStandard writes all transactions in the standard format.
+	DataEncodingStandard
+	// DataEncodingExtended writes all transactions in the Extended Format, all
+	// transactions must be extended. The coinbase transaction, which does not spend
+	// any outputs, is always written in the standard format.
+	DataEncodingExtended
+)
+
+// String returns the name of the encoding.
+func (e DataEncoding) String() string {
+	switch e {
+	case DataEncodingAuto:
+		return "auto"
+	case DataEncodingStandard:
+		return "standard"
+	case DataEncodingExtended:
+		return "extended"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(e))
+	}
+}
+
+// WriteTransactionChunkWithEncoding writes a slice of transactions directly to a
+// writer in the given encoding, skipping nil transactions. It is identical to
+// WriteTransactionChunk for DataEncodingAuto.
+func WriteTransactionChunkWithEncoding(w io.Writer, txs []*bt.Tx, encoding DataEncoding) error {
+	for _, tx := range txs {
+		if tx == nil {
+			continue // Skip nil transactions
+		}
+
+		if _, err := writeTxWithEncoding(w, tx, encoding); err != nil {
+			return fmt.Errorf("%w: %w", ErrTransactionWrite, err)
+		}
+	}
+
+	return nil
+}
+
+// serializeTxWithEncoding returns the serialized transaction in the given encoding.
+func serializeTxWithEncoding(tx *bt.Tx, encoding DataEncoding) ([]byte, error) {
+	switch encoding {
+	case DataEncodingStandard:
+		return tx.Bytes(), nil
+	case DataEncodingExtended:
+		if tx.IsCoinbase() {
+			return tx.Bytes(), nil
+		}
+
+		if !tx.IsExtended() {
+			return nil, fmt.Errorf("%w: %s", ErrTxNotExtended, tx.TxID())
+		}
+
+		return tx.ExtendedBytes(), nil
+	default:
+		return tx.SerializeBytes(), nil
+	}
+}
+
+// writeTxWithEncoding writes the transaction to w in the given encoding.
+func writeTxWithEncoding(w io.Writer, tx *bt.Tx, encoding DataEncoding) (int64, error) {
+	switch encoding {
+	case DataEncodingStandard:
+		return tx.WriteTo(w)
+	case DataEncodingExtended:
+		if tx.IsCoinbase() {
+			return tx.WriteTo(w)
+		}
+
+		if !tx.IsExtended() {
+			return 0, fmt.Errorf("%w: %s", ErrTxNotExtended, tx.TxID())
+		}
+
+		return tx.WriteExtendedTo(w)
+	default:
+		return tx.SerializeTo(w)
+	}
+}
+
+// encodingOf returns the encoding a transaction was read in.
+func encodingOf(tx *bt.Tx) DataEncoding {
+	if tx.IsExtended() {
+		return DataEncodingExtended
+	}
+
+	return DataEncodingStandard
+}
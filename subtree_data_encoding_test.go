@@ -0,0 +1,149 @@
+package subtree
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bsv-blockchain/go-bt/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataEncoding(t *testing.T) {
+	t.Run("string", func(t *testing.T) {
+		assert.Equal(t, "auto", DataEncodingAuto.String())
+		assert.Equal(t, "standard", DataEncodingStandard.String())
+		assert.Equal(t, "extended", DataEncodingExtended.String())
+		assert.Equal(t, "unknown(9)", DataEncoding(9).String())
+	})
+
+	tests := []struct {
+		name      string
+		encoding  DataEncoding
+		serialize func(tx *bt.Tx) []byte
+	}{
+		{name: "standard", encoding: DataEncodingStandard, serialize: (*bt.Tx).Bytes},
+		{name: "extended", encoding: DataEncodingExtended, serialize: (*bt.Tx).ExtendedBytes},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+" round trip", func(t *testing.T) {
+			subtree, subtreeData, txs := setupTestSubtreeData(t)
+			subtreeData.Encoding = tt.encoding
+
+			b, err := subtreeData.Serialize()
+			require.NoError(t, err)
+
+			var expected []byte
+			for _, tx := range txs {
+				expected = append(expected, tt.serialize(tx)...)
+			}
+
+			assert.Equal(t, expected, b)
+
+			buf := &bytes.Buffer{}
+			require.NoError(t, subtreeData.WriteTransactionsToWriter(buf, 0, len(txs)))
+			assert.Equal(t, expected, buf.Bytes())
+
+			buf.Reset()
+			require.NoError(t, WriteTransactionChunkWithEncoding(buf, txs, tt.encoding))
+			assert.Equal(t, expected, buf.Bytes())
+
+			readData, err := NewSubtreeDataFromBytes(subtree, b)
+			require.NoError(t, err)
+			assert.Equal(t, tt.encoding, readData.Encoding)
+			assert.Equal(t, tt.encoding == DataEncodingExtended, readData.Txs[0].IsExtended())
+
+			parallelData, err := NewSubtreeDataFromBytesParallel(subtree, b, 2)
+			require.NoError(t, err)
+			assert.Equal(t, tt.encoding, parallelData.Encoding)
+
+			// re-serializing the read data results in the same encoding
+			b2, err := readData.Serialize()
+			require.NoError(t, err)
+			assert.Equal(t, b, b2)
+
+			chunk, err := ReadTransactionChunk(bytes.NewReader(b), subtree, 0, len(txs))
+			require.NoError(t, err)
+			require.Len(t, chunk, len(txs))
+			assert.Equal(t, tt.encoding == DataEncodingExtended, chunk[3].IsExtended())
+
+			chunkData := NewSubtreeData(subtree)
+			n, err := chunkData.ReadTransactionsFromReader(bytes.NewReader(b), 0, len(txs))
+			require.NoError(t, err)
+			assert.Equal(t, len(txs), n)
+			assert.Equal(t, tt.encoding, chunkData.Encoding)
+		})
+	}
+
+	t.Run("extended encoding requires extended txs", func(t *testing.T) {
+		subtree, err := NewTree(1)
+		require.NoError(t, err)
+
+		standardTx, err := bt.NewTxFromBytes(tx.Bytes())
+		require.NoError(t, err)
+		require.False(t, standardTx.IsExtended())
+		require.NoError(t, subtree.AddNode(*standardTx.TxIDChainHash(), 1, 1))
+
+		subtreeData := NewSubtreeDataWithEncoding(subtree, DataEncodingExtended)
+		require.NoError(t, subtreeData.AddTx(standardTx, 0))
+
+		_, err = subtreeData.Serialize()
+		require.ErrorIs(t, err, ErrTxNotExtended)
+
+		err = subtreeData.WriteTransactionsToWriter(&bytes.Buffer{}, 0, 1)
+		require.ErrorIs(t, err, ErrTxNotExtended)
+
+		err = WriteTransactionChunkWithEncoding(&bytes.Buffer{}, []*bt.Tx{standardTx}, DataEncodingExtended)
+		require.ErrorIs(t, err, ErrTxNotExtended)
+	})
+
+	t.Run("mixed encodings are read transparently", func(t *testing.T) {
+		subtree, _, txs := setupTestSubtreeData(t)
+
+		b := append(txs[0].Bytes(), txs[1].ExtendedBytes()...)
+		b = append(b, txs[2].Bytes()...)
+		b = append(b, txs[3].ExtendedBytes()...)
+
+		readData, err := NewSubtreeDataFromBytes(subtree, b)
+		require.NoError(t, err)
+		assert.Equal(t, DataEncodingAuto, readData.Encoding)
+		assert.True(t, readData.Txs[1].IsExtended())
+		assert.False(t, readData.Txs[2].IsExtended())
+
+		// written back without losing or requiring extended data
+		written, err := readData.Serialize()
+		require.NoError(t, err)
+		assert.Equal(t, b, written)
+
+		// the same when the first transaction is extended
+		b = append(txs[0].ExtendedBytes(), txs[1].Bytes()...)
+		b = append(b, txs[2].ExtendedBytes()...)
+		b = append(b, txs[3].Bytes()...)
+
+		readData, err = NewSubtreeDataFromBytes(subtree, b)
+		require.NoError(t, err)
+		assert.Equal(t, DataEncodingAuto, readData.Encoding)
+
+		written, err = readData.Serialize()
+		require.NoError(t, err)
+		assert.Equal(t, b, written)
+
+		readData, err = NewSubtreeDataFromBytesParallel(subtree, b, 2)
+		require.NoError(t, err)
+		assert.Equal(t, DataEncodingAuto, readData.Encoding)
+	})
+
+	t.Run("encoding set by the caller is kept", func(t *testing.T) {
+		subtree, _, txs := setupTestSubtreeData(t)
+
+		b := append(txs[0].Bytes(), txs[1].ExtendedBytes()...)
+
+		readData := NewSubtreeDataWithEncoding(subtree, DataEncodingStandard)
+
+		n, err := readData.ReadTransactionsFromReader(bytes.NewReader(b), 0, 2)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.Equal(t, DataEncodingStandard, readData.Encoding)
+	})
+}
@@ -0,0 +1,178 @@
+package subtree
+
+import (
+	"math/bits"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+)
+
+// dataFill tracks which transactions of a Data object have been set, so partially
+// filled subtree data can report the gaps that still need to be fetched.
+//
+// The bitmap is created lazily from the Txs slice on first use. After that it is
+// updated by AddTx and the readers, so transactions must not be assigned to Txs
+// directly once any of the fill methods has been called.
+type dataFill struct {
+	once  sync.Once
+	bits  []atomic.Uint64
+	count atomic.Int64 // number of set transactions, not counting the coinbase placeholder
+}
+
+// Has returns whether the transaction at index has been set.
+func (s *Data) Has(index int) bool {
+	if index < 0 || index >= len(s.Txs) {
+		return false
+	}
+
+	f := s.fillState()
+
+	return f.bits[index/64].Load()&(uint64(1)<<(uint(index)%64)) != 0
+}
+
+// Missing returns the indices of the transactions in the subtree that have not been
+// set yet, in ascending order. The coinbase placeholder is only reported as missing when
+// CoinbasePolicy is CoinbaseInclude and the coinbase transaction has not been attached.
+func (s *Data) Missing() []int {
+	f := s.fillState()
+	length := Min(s.Subtree.Length(), len(s.Txs))
+
+	missing := make([]int, 0, Max(0, s.MissingCount()))
+
+	if s.coinbaseMissing() {
+		missing = append(missing, 0)
+	}
+
+	for i := s.firstCountedIndex(); i < length; i++ {
+		word := f.bits[i/64].Load()
+		if word == ^uint64(0) && i%64 == 0 && i+64 <= length {
+			// skip fully filled words
+			i += 63
+			continue
+		}
+
+		if word&(uint64(1)<<(uint(i)%64)) == 0 {
+			missing = append(missing, i)
+		}
+	}
+
+	return missing
+}
+
+// MissingTxIDs returns the transaction IDs of the transactions returned by Missing,
+// in the same order.
+func (s *Data) MissingTxIDs() []chainhash.Hash {
+	missing := s.Missing()
+	txIDs := make([]chainhash.Hash, 0, len(missing))
+
+	for _, idx := range missing {
+		txIDs = append(txIDs, s.Subtree.Nodes[idx].Hash)
+	}
+
+	return txIDs
+}
+
+// MissingCount returns the number of transactions that have not been set yet.
+func (s *Data) MissingCount() int {
+	missing := s.countedLength() - int(s.fillState().count.Load())
+
+	if s.coinbaseMissing() {
+		missing++
+	}
+
+	return missing
+}
+
+// IsComplete returns whether all transactions of the subtree have been set, in which
+// case the data can be serialized.
+func (s *Data) IsComplete() bool {
+	return s.MissingCount() <= 0
+}
+
+// fillState returns the fill bitmap of the data, creating it from Txs on first use.
+func (s *Data) fillState() *dataFill {
+	s.fill.once.Do(func() {
+		s.fill.bits = make([]atomic.Uint64, (len(s.Txs)+63)/64)
+
+		for i, tx := range s.Txs {
+			if tx != nil {
+				s.fill.bits[i/64].Or(uint64(1) << (uint(i) % 64))
+			}
+		}
+
+		s.fill.count.Store(int64(s.countFilledRequired()))
+	})
+
+	return &s.fill
+}
+
+// claim marks the transaction at index as set, returning false when it was already set.
+func (s *Data) claim(index int) bool {
+	bit := uint64(1) << (uint(index) % 64)
+
+	return s.fillState().bits[index/64].Or(bit)&bit == 0
+}
+
+// markFilled marks the transaction at index as set and counts it when it is required.
+func (s *Data) markFilled(index int) {
+	if s.claim(index) {
+		s.countFilled(index)
+	}
+}
+
+// countFilled counts a newly set transaction towards completion.
+func (s *Data) countFilled(index int) {
+	if index >= s.firstCountedIndex() {
+		s.fill.count.Add(1)
+	}
+}
+
+// countFilledRequired counts the set bits of the transactions after the coinbase
+// placeholder.
+func (s *Data) countFilledRequired() int {
+	first := s.firstCountedIndex()
+	length := Min(s.Subtree.Length(), len(s.Txs))
+
+	count := 0
+
+	for i := first; i < length; {
+		if i%64 == 0 && i+64 <= length {
+			count += bits.OnesCount64(s.fill.bits[i/64].Load())
+			i += 64
+
+			continue
+		}
+
+		if s.fill.bits[i/64].Load()&(uint64(1)<<(uint(i)%64)) != 0 {
+			count++
+		}
+
+		i++
+	}
+
+	return count
+}
+
+// countedLength returns the number of transactions tracked by the fill count.
+func (s *Data) countedLength() int {
+	return Max(0, Min(s.Subtree.Length(), len(s.Txs))-s.firstCountedIndex())
+}
+
+// firstCountedIndex returns 1 when the subtree starts with the coinbase placeholder,
+// which is not tracked by the fill count, and 0 otherwise. Whether the placeholder
+// needs a transaction depends on CoinbasePolicy, see coinbaseMissing.
+func (s *Data) firstCountedIndex() int {
+	if s.Subtree.HasCoinbasePlaceholder() {
+		return 1
+	}
+
+	return 0
+}
+
+// coinbaseMissing returns whether the coinbase transaction must be written in place of
+// the coinbase placeholder, but has not been attached.
+func (s *Data) coinbaseMissing() bool {
+	return s.CoinbasePolicy == CoinbaseInclude && s.Subtree.HasCoinbasePlaceholder() &&
+		len(s.Txs) > 0 && !s.Has(0)
+}
@@ -0,0 +1,223 @@
+package subtree
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/bsv-blockchain/go-bt/v2"
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataMissing(t *testing.T) {
+	t.Run("tracks missing transactions", func(t *testing.T) {
+		subtree, _, txs := setupTestSubtreeData(t)
+		data := NewSubtreeData(subtree)
+
+		assert.Equal(t, []int{0, 1, 2, 3}, data.Missing())
+		assert.Equal(t, 4, data.MissingCount())
+		assert.False(t, data.IsComplete())
+
+		require.NoError(t, data.AddTx(txs[2], 2))
+		require.NoError(t, data.AddTx(txs[0], 0))
+
+		assert.True(t, data.Has(0))
+		assert.False(t, data.Has(1))
+		assert.Equal(t, []int{1, 3}, data.Missing())
+		assert.Equal(t, []chainhash.Hash{*txs[1].TxIDChainHash(), *txs[3].TxIDChainHash()}, data.MissingTxIDs())
+
+		_, err := data.Serialize()
+		require.ErrorIs(t, err, ErrSubtreeLengthMismatch)
+
+		require.NoError(t, data.AddTx(txs[3], 3))
+		require.NoError(t, data.AddTx(txs[1], 1))
+
+		assert.Empty(t, data.Missing())
+		assert.Empty(t, data.MissingTxIDs())
+		assert.True(t, data.IsComplete())
+
+		_, err = data.Serialize()
+		require.NoError(t, err)
+	})
+
+	t.Run("adding a transaction twice is counted once", func(t *testing.T) {
+		subtree, _, txs := setupTestSubtreeData(t)
+		data := NewSubtreeData(subtree)
+
+		require.NoError(t, data.AddTx(txs[1], 1))
+		require.NoError(t, data.AddTx(txs[1].Clone(), 1))
+
+		assert.Same(t, txs[1], data.Txs[1])
+		assert.Equal(t, 3, data.MissingCount())
+	})
+
+	t.Run("adding a different coinbase tx", func(t *testing.T) {
+		subtree, _, _ := setupCoinbaseTestSubtreeData(t)
+		data := NewSubtreeData(subtree)
+
+		require.NoError(t, data.AddTx(coinbaseTx, 0))
+		require.NoError(t, data.AddTx(coinbaseTx.Clone(), 0))
+
+		err := data.AddTx(sequenceCoinbaseTx, 0)
+		require.ErrorIs(t, err, ErrTxAlreadySet)
+		assert.Contains(t, err.Error(), "at index 0")
+
+		assert.Same(t, coinbaseTx, data.Txs[0])
+	})
+
+	t.Run("coinbase placeholder is not missing", func(t *testing.T) {
+		subtree, _, txs := setupCoinbaseTestSubtreeData(t)
+		data := NewSubtreeData(subtree)
+
+		assert.Equal(t, []int{1, 2, 3}, data.Missing())
+
+		for i, tx := range txs {
+			require.NoError(t, data.AddTx(tx, i+1))
+		}
+
+		assert.True(t, data.IsComplete())
+
+		require.NoError(t, data.AddTx(coinbaseTx, 0))
+		assert.True(t, data.Has(0))
+		assert.True(t, data.IsComplete())
+		assert.Equal(t, 0, data.MissingCount())
+	})
+
+	t.Run("coinbase is missing when it is included", func(t *testing.T) {
+		subtree, _, txs := setupCoinbaseTestSubtreeData(t)
+		data := NewSubtreeData(subtree)
+
+		for i, tx := range txs {
+			require.NoError(t, data.AddTx(tx, i+1))
+		}
+
+		data.CoinbasePolicy = CoinbaseInclude
+
+		assert.Equal(t, []int{0}, data.Missing())
+		assert.Equal(t, 1, data.MissingCount())
+		assert.False(t, data.IsComplete())
+
+		_, err := data.Serialize()
+		require.ErrorIs(t, err, ErrCoinbaseTxMissing)
+
+		require.NoError(t, data.SetCoinbaseTx(coinbaseTx))
+		assert.Empty(t, data.Missing())
+		assert.True(t, data.IsComplete())
+
+		_, err = data.Serialize()
+		require.NoError(t, err)
+
+		// the policy can change after the transactions have been counted
+		data.CoinbasePolicy = CoinbaseOmit
+		assert.True(t, data.IsComplete())
+	})
+
+	t.Run("only nodes in the subtree are required", func(t *testing.T) {
+		subtree, err := NewTree(4)
+		require.NoError(t, err)
+		require.NoError(t, subtree.AddNode(*tx.TxIDChainHash(), 1, 1))
+
+		data := NewSubtreeData(subtree)
+		assert.Equal(t, []int{0}, data.Missing())
+
+		require.NoError(t, data.AddTx(tx, 0))
+		assert.True(t, data.IsComplete())
+	})
+
+	t.Run("index out of bounds", func(t *testing.T) {
+		subtree, _, txs := setupTestSubtreeData(t)
+		data := NewSubtreeData(subtree)
+
+		require.ErrorIs(t, data.AddTx(txs[0], -1), ErrTxIndexOutOfBounds)
+		require.ErrorIs(t, data.AddTx(txs[0], 4), ErrTxIndexOutOfBounds)
+		assert.False(t, data.Has(4))
+	})
+
+	t.Run("hash mismatch is not marked", func(t *testing.T) {
+		subtree, _, txs := setupTestSubtreeData(t)
+		data := NewSubtreeData(subtree)
+
+		require.ErrorIs(t, data.AddTx(txs[0], 1), ErrTxHashMismatch)
+		assert.False(t, data.Has(1))
+	})
+
+	t.Run("data read from bytes is complete", func(t *testing.T) {
+		subtree, subtreeData, _ := setupTestSubtreeData(t)
+
+		b, err := subtreeData.Serialize()
+		require.NoError(t, err)
+
+		data, err := NewSubtreeDataFromBytes(subtree, b)
+		require.NoError(t, err)
+		assert.True(t, data.IsComplete())
+
+		parallelData, err := NewSubtreeDataFromBytesParallel(subtree, b, 2)
+		require.NoError(t, err)
+		assert.True(t, parallelData.IsComplete())
+	})
+
+	t.Run("read transactions from reader fill the bitmap", func(t *testing.T) {
+		subtree, subtreeData, _ := setupTestSubtreeData(t)
+
+		buf := &bytes.Buffer{}
+		require.NoError(t, subtreeData.WriteTransactionsToWriter(buf, 0, 2))
+
+		data := NewSubtreeData(subtree)
+		assert.Equal(t, 4, data.MissingCount())
+
+		n, err := data.ReadTransactionsFromReader(buf, 0, 2)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.Equal(t, []int{2, 3}, data.Missing())
+	})
+
+	t.Run("bitmap is created from existing transactions", func(t *testing.T) {
+		subtree, _, txs := setupTestSubtreeData(t)
+
+		data := &Data{
+			Subtree: subtree,
+			Txs:     []*bt.Tx{txs[0], nil, txs[2], nil},
+		}
+
+		assert.Equal(t, []int{1, 3}, data.Missing())
+	})
+
+	t.Run("concurrent out of order adds", func(t *testing.T) {
+		subtree, dataBytes := buildLargeTestData(t, 1000)
+
+		full, err := NewSubtreeDataFromBytes(subtree, dataBytes)
+		require.NoError(t, err)
+
+		data := NewSubtreeData(subtree)
+
+		var wg sync.WaitGroup
+
+		for worker := 0; worker < 8; worker++ {
+			wg.Add(1)
+
+			go func(worker int) {
+				defer wg.Done()
+
+				// every worker adds all transactions in a different order, so every index is added concurrently
+				for i := range full.Txs {
+					idx := (i*7 + worker*131) % len(full.Txs)
+
+					assert.NoError(t, data.AddTx(full.Txs[idx], idx))
+				}
+			}(worker)
+		}
+
+		wg.Wait()
+
+		// every index is counted once
+		assert.Equal(t, 0, data.MissingCount())
+		assert.True(t, data.IsComplete())
+		assert.Empty(t, data.Missing())
+
+		b, err := data.Serialize()
+		require.NoError(t, err)
+		assert.Equal(t, dataBytes, b)
+	})
+}
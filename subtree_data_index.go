@@ -0,0 +1,311 @@
+package subtree
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/bsv-blockchain/go-bt/v2"
+	safe "github.com/bsv-blockchain/go-safe-conversion"
+)
+
+// dataIndexEntrySize is the serialized size of a DataIndex entry, 8 bytes offset and 4 bytes length.
+const dataIndexEntrySize = 12
+
+// DataIndex is a sidecar index for a subtree data file. It records the byte offset
+// and length of the serialized transaction of every node index, which allows a
+// single transaction to be read from the file without parsing the transactions
+// before it. Nodes that are not in the data file, like the coinbase placeholder,
+// have a length of 0.
+type DataIndex struct {
+	Offsets []uint64
+	Lengths []uint32
+
+	// end is the offset directly after the last written transaction
+	end uint64
+}
+
+// NewDataIndex creates a new, empty DataIndex for a subtree with length nodes.
+func NewDataIndex(length int) *DataIndex {
+	return &DataIndex{
+		Offsets: make([]uint64, length),
+		Lengths: make([]uint32, length),
+	}
+}
+
+// NewDataIndexFromBytes creates a new DataIndex from the provided byte slice.
+func NewDataIndexFromBytes(b []byte) (*DataIndex, error) {
+	index, err := NewDataIndexFromReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create data index from bytes: %w", err)
+	}
+
+	return index, nil
+}
+
+// NewDataIndexFromReader creates a new DataIndex from the provided reader.
+func NewDataIndexFromReader(reader io.Reader) (*DataIndex, error) {
+	buf := bufio.NewReaderSize(reader, 32*1024) // 32KB buffer
+
+	var bytes8 [8]byte
+
+	if _, err := io.ReadFull(buf, bytes8[:]); err != nil {
+		return nil, fmt.Errorf("unable to read number of index entries: %w", err)
+	}
+
+	length, err := safe.Uint64ToInt(binary.LittleEndian.Uint64(bytes8[:]))
+	if err != nil {
+		return nil, err
+	}
+
+	index := &DataIndex{
+		Offsets: make([]uint64, 0, Min(length, 1024*1024)),
+		Lengths: make([]uint32, 0, Min(length, 1024*1024)),
+	}
+
+	var entry [dataIndexEntrySize]byte
+
+	for i := 0; i < length; i++ {
+		if _, err = io.ReadFull(buf, entry[:]); err != nil {
+			return nil, fmt.Errorf("unable to read index entry %d: %w", i, err)
+		}
+
+		index.Offsets = append(index.Offsets, binary.LittleEndian.Uint64(entry[0:8]))
+		index.Lengths = append(index.Lengths, binary.LittleEndian.Uint32(entry[8:12]))
+	}
+
+	if err = index.validate(); err != nil {
+		return nil, err
+	}
+
+	return index, nil
+}
+
+// Len returns the number of node indices in the index.
+func (i *DataIndex) Len() int {
+	return len(i.Offsets)
+}
+
+// Entry returns the byte offset and length of the transaction at the node index.
+// A length of 0 means the transaction is not in the data file.
+func (i *DataIndex) Entry(idx int) (offset uint64, length uint32, err error) {
+	if idx < 0 || idx >= len(i.Offsets) {
+		return 0, 0, ErrIndexOutOfRange
+	}
+
+	return i.Offsets[idx], i.Lengths[idx], nil
+}
+
+// Serialize returns the serialized form of the index: the number of entries as
+// uint64, followed by the offset (uint64) and length (uint32) of every entry.
+func (i *DataIndex) Serialize() ([]byte, error) {
+	if len(i.Offsets) != len(i.Lengths) {
+		return nil, ErrSubtreeLengthMismatch
+	}
+
+	b := make([]byte, 8, 8+len(i.Offsets)*dataIndexEntrySize)
+	binary.LittleEndian.PutUint64(b, uint64(len(i.Offsets)))
+
+	for idx, offset := range i.Offsets {
+		b = binary.LittleEndian.AppendUint64(b, offset)
+		b = binary.LittleEndian.AppendUint32(b, i.Lengths[idx])
+	}
+
+	return b, nil
+}
+
+// validate checks that the transactions of the entries follow each other in node index
+// order without overlapping, as they are written to a data file, and sets the end of the
+// index. Entries with a length of 0 are not checked.
+func (i *DataIndex) validate() error {
+	if len(i.Offsets) != len(i.Lengths) {
+		return ErrSubtreeLengthMismatch
+	}
+
+	var end uint64
+
+	for idx, offset := range i.Offsets {
+		if i.Lengths[idx] == 0 {
+			continue
+		}
+
+		if offset < end || offset > math.MaxInt64-uint64(i.Lengths[idx]) {
+			return fmt.Errorf("%w at index %d", ErrDataIndexCorrupt, idx)
+		}
+
+		end = offset + uint64(i.Lengths[idx])
+	}
+
+	i.end = end
+
+	return nil
+}
+
+// record sets the entry for the node index to the next length bytes of the data file.
+func (i *DataIndex) record(idx int, length int64) error {
+	if idx >= len(i.Offsets) {
+		i.Offsets = append(i.Offsets, make([]uint64, idx+1-len(i.Offsets))...)
+		i.Lengths = append(i.Lengths, make([]uint32, idx+1-len(i.Lengths))...)
+	}
+
+	length32, err := safe.Int64ToUint32(length)
+	if err != nil {
+		return err
+	}
+
+	i.Offsets[idx] = i.end
+	i.Lengths[idx] = length32
+	i.end += uint64(length32)
+
+	return nil
+}
+
+// IndexedDataReader reads single transactions, or ranges of transactions, from a
+// subtree data file using its DataIndex. Every transaction read is validated against
+// the subtree. It is safe for concurrent use when the underlying io.ReaderAt is.
+type IndexedDataReader struct {
+	subtree *Subtree
+	reader  io.ReaderAt
+	index   *DataIndex
+}
+
+// NewIndexedDataReader creates a new IndexedDataReader.
+//
+// Parameters:
+//   - subtree: The subtree the data file belongs to
+//   - reader: The data file
+//   - index: The index of the data file, must have an entry for every node of the subtree
+//
+// Returns:
+//   - *IndexedDataReader: A new IndexedDataReader
+//   - error: An error if the subtree is empty or the index does not match the subtree
+func NewIndexedDataReader(subtree *Subtree, reader io.ReaderAt, index *DataIndex) (*IndexedDataReader, error) {
+	if subtree == nil || len(subtree.Nodes) == 0 {
+		return nil, ErrSubtreeNodesEmpty
+	}
+
+	if index == nil || index.Len() != subtree.Length() {
+		return nil, ErrSubtreeLengthMismatch
+	}
+
+	if err := index.validate(); err != nil {
+		return nil, err
+	}
+
+	return &IndexedDataReader{
+		subtree: subtree,
+		reader:  reader,
+		index:   index,
+	}, nil
+}
+
+// TxAt reads the transaction at the node index from the data file.
+func (r *IndexedDataReader) TxAt(idx int) (*bt.Tx, error) {
+	offset, length, err := r.index.Entry(idx)
+	if err != nil {
+		return nil, err
+	}
+
+	if length == 0 {
+		return nil, fmt.Errorf("%w at index %d", ErrTxNotInData, idx)
+	}
+
+	b := make([]byte, length)
+	if err = readFullAt(r.reader, b, int64(offset)); err != nil { //nolint:gosec // G115: offsets are validated to fit in an int64
+		return nil, fmt.Errorf("%w at index %d: %w", ErrTransactionRead, idx, err)
+	}
+
+	return r.parseTx(idx, b)
+}
+
+// TxRange reads the transactions with node index in [startIdx, endIdx) from the data
+// file with a single read. Nodes that are not in the data file, like the coinbase
+// placeholder, are returned as nil.
+func (r *IndexedDataReader) TxRange(startIdx, endIdx int) ([]*bt.Tx, error) {
+	if startIdx < 0 || endIdx > r.index.Len() || startIdx > endIdx {
+		return nil, ErrIndexOutOfRange
+	}
+
+	var (
+		from, to uint64
+		found    bool
+	)
+
+	for i := startIdx; i < endIdx; i++ {
+		if r.index.Lengths[i] == 0 {
+			continue
+		}
+
+		if !found {
+			from = r.index.Offsets[i]
+			found = true
+		}
+
+		to = r.index.Offsets[i] + uint64(r.index.Lengths[i])
+	}
+
+	txs := make([]*bt.Tx, endIdx-startIdx)
+	if !found {
+		return txs, nil
+	}
+
+	b := make([]byte, to-from)
+	if err := readFullAt(r.reader, b, int64(from)); err != nil { //nolint:gosec // G115: offsets are validated to fit in an int64
+		return nil, fmt.Errorf("%w at index %d: %w", ErrTransactionRead, startIdx, err)
+	}
+
+	for i := startIdx; i < endIdx; i++ {
+		length := uint64(r.index.Lengths[i])
+		if length == 0 {
+			continue
+		}
+
+		start := r.index.Offsets[i] - from
+
+		tx, err := r.parseTx(i, b[start:start+length])
+		if err != nil {
+			return nil, err
+		}
+
+		txs[i-startIdx] = tx
+	}
+
+	return txs, nil
+}
+
+// parseTx parses the transaction bytes of the node index and validates the txid.
+func (r *IndexedDataReader) parseTx(idx int, b []byte) (*bt.Tx, error) {
+	tx, err := bt.NewTxFromBytes(b)
+	if err != nil {
+		return nil, fmt.Errorf("%w at index %d: %w", ErrTransactionRead, idx, err)
+	}
+
+	if isCoinbaseAt(r.subtree, idx, tx) {
+		return tx, nil
+	}
+
+	if !r.subtree.Nodes[idx].Hash.Equal(*tx.TxIDChainHash()) {
+		return nil, fmt.Errorf("%w at index %d", ErrTxHashMismatch, idx)
+	}
+
+	return tx, nil
+}
+
+// readFullAt reads len(b) bytes at offset off. An io.EOF together with a full read, which
+// io.ReaderAt allows at the end of the input, is not an error.
+func readFullAt(r io.ReaderAt, b []byte, off int64) error {
+	n, err := r.ReadAt(b, off)
+	if n == len(b) {
+		return nil
+	}
+
+	if err == nil || errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
@@ -0,0 +1,198 @@
+package subtree
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/bsv-blockchain/go-bt/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// eofReaderAt returns io.EOF together with a full read at the end of the input, which
+// io.ReaderAt allows.
+type eofReaderAt struct {
+	r *bytes.Reader
+}
+
+func (e eofReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	n, err := e.r.ReadAt(b, off)
+	if err == nil && off+int64(n) == e.r.Size() {
+		return n, io.EOF
+	}
+
+	return n, err
+}
+
+func TestDataSerializeWithIndex(t *testing.T) {
+	t.Run("index matches serialized bytes", func(t *testing.T) {
+		_, subtreeData, txs := setupTestSubtreeData(t)
+
+		b, index, err := subtreeData.SerializeWithIndex()
+		require.NoError(t, err)
+
+		plain, err := subtreeData.Serialize()
+		require.NoError(t, err)
+		assert.Equal(t, plain, b)
+
+		require.Equal(t, len(txs), index.Len())
+
+		for i, expected := range txs {
+			offset, length, err := index.Entry(i)
+			require.NoError(t, err)
+			assert.Equal(t, expected.SerializeBytes(), b[offset:offset+uint64(length)])
+		}
+
+		_, _, err = index.Entry(len(txs))
+		require.ErrorIs(t, err, ErrIndexOutOfRange)
+	})
+
+	t.Run("chunked writes produce the same index", func(t *testing.T) {
+		_, subtreeData, _ := setupCoinbaseTestSubtreeData(t)
+
+		b, expectedIndex, err := subtreeData.SerializeWithIndex()
+		require.NoError(t, err)
+
+		index := NewDataIndex(subtreeData.Subtree.Length())
+		buf := &bytes.Buffer{}
+
+		require.NoError(t, subtreeData.WriteTransactionsToWriterWithIndex(buf, 0, 2, index))
+		require.NoError(t, subtreeData.WriteTransactionsToWriterWithIndex(buf, 2, 4, index))
+
+		assert.Equal(t, b, buf.Bytes())
+		assert.Equal(t, expectedIndex.Offsets, index.Offsets)
+		assert.Equal(t, expectedIndex.Lengths, index.Lengths)
+		assert.Zero(t, index.Lengths[0])
+	})
+
+	t.Run("serialize round trip", func(t *testing.T) {
+		_, subtreeData, _ := setupCoinbaseTestSubtreeData(t)
+
+		_, index, err := subtreeData.SerializeWithIndex()
+		require.NoError(t, err)
+
+		indexBytes, err := index.Serialize()
+		require.NoError(t, err)
+		assert.Len(t, indexBytes, 8+index.Len()*dataIndexEntrySize)
+
+		index2, err := NewDataIndexFromBytes(indexBytes)
+		require.NoError(t, err)
+		assert.Equal(t, index, index2)
+
+		_, err = NewDataIndexFromBytes(indexBytes[:len(indexBytes)-1])
+		require.Error(t, err)
+
+		_, err = NewDataIndexFromBytes(nil)
+		require.Error(t, err)
+	})
+}
+
+func TestIndexedDataReader(t *testing.T) {
+	subtree, subtreeData, txs := setupCoinbaseTestSubtreeData(t)
+
+	b, index, err := subtreeData.SerializeWithIndex()
+	require.NoError(t, err)
+
+	reader, err := NewIndexedDataReader(subtree, bytes.NewReader(b), index)
+	require.NoError(t, err)
+
+	t.Run("tx at index", func(t *testing.T) {
+		for i, expected := range txs {
+			readTx, err := reader.TxAt(i + 1)
+			require.NoError(t, err)
+			assert.Equal(t, expected.TxID(), readTx.TxID())
+		}
+
+		_, err = reader.TxAt(0)
+		require.ErrorIs(t, err, ErrTxNotInData)
+
+		_, err = reader.TxAt(4)
+		require.ErrorIs(t, err, ErrIndexOutOfRange)
+	})
+
+	t.Run("tx range", func(t *testing.T) {
+		readTxs, err := reader.TxRange(0, 4)
+		require.NoError(t, err)
+		require.Len(t, readTxs, 4)
+		assert.Nil(t, readTxs[0])
+
+		for i, expected := range txs {
+			assert.Equal(t, expected.TxID(), readTxs[i+1].TxID())
+		}
+
+		readTxs, err = reader.TxRange(2, 3)
+		require.NoError(t, err)
+		require.Len(t, readTxs, 1)
+		assert.Equal(t, txs[1].TxID(), readTxs[0].TxID())
+
+		readTxs, err = reader.TxRange(0, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []*bt.Tx{nil}, readTxs)
+
+		_, err = reader.TxRange(3, 5)
+		require.ErrorIs(t, err, ErrIndexOutOfRange)
+	})
+
+	t.Run("hash mismatch", func(t *testing.T) {
+		swapped := &DataIndex{
+			Offsets: []uint64{0, index.Offsets[2], 0, 0},
+			Lengths: []uint32{0, index.Lengths[2], 0, 0},
+		}
+
+		swappedReader, err := NewIndexedDataReader(subtree, bytes.NewReader(b), swapped)
+		require.NoError(t, err)
+
+		_, err = swappedReader.TxAt(1)
+		require.ErrorIs(t, err, ErrTxHashMismatch)
+	})
+
+	t.Run("corrupt index", func(t *testing.T) {
+		for _, corrupt := range []*DataIndex{
+			// out of order
+			{Offsets: []uint64{0, index.Offsets[2], index.Offsets[1], index.Offsets[3]}, Lengths: index.Lengths},
+			// overlapping
+			{Offsets: []uint64{0, 0, 10, index.Offsets[3]}, Lengths: index.Lengths},
+			// beyond an int64 offset
+			{Offsets: []uint64{0, 0, 0, 1 << 63}, Lengths: index.Lengths},
+		} {
+			_, err := NewIndexedDataReader(subtree, bytes.NewReader(b), corrupt)
+			require.ErrorIs(t, err, ErrDataIndexCorrupt)
+
+			indexBytes, err := corrupt.Serialize()
+			require.NoError(t, err)
+
+			_, err = NewDataIndexFromBytes(indexBytes)
+			require.ErrorIs(t, err, ErrDataIndexCorrupt)
+		}
+	})
+
+	t.Run("eof with full read", func(t *testing.T) {
+		eofReader, err := NewIndexedDataReader(subtree, eofReaderAt{bytes.NewReader(b)}, index)
+		require.NoError(t, err)
+
+		readTx, err := eofReader.TxAt(3)
+		require.NoError(t, err)
+		assert.Equal(t, txs[2].TxID(), readTx.TxID())
+
+		readTxs, err := eofReader.TxRange(0, 4)
+		require.NoError(t, err)
+		assert.Equal(t, txs[2].TxID(), readTxs[3].TxID())
+	})
+
+	t.Run("read beyond data", func(t *testing.T) {
+		truncatedReader, err := NewIndexedDataReader(subtree, bytes.NewReader(b[:10]), index)
+		require.NoError(t, err)
+
+		_, err = truncatedReader.TxAt(2)
+		require.ErrorIs(t, err, ErrTransactionRead)
+	})
+
+	t.Run("index does not match subtree", func(t *testing.T) {
+		_, err := NewIndexedDataReader(subtree, bytes.NewReader(b), NewDataIndex(2))
+		require.ErrorIs(t, err, ErrSubtreeLengthMismatch)
+
+		_, err = NewIndexedDataReader(nil, bytes.NewReader(b), index)
+		require.ErrorIs(t, err, ErrSubtreeNodesEmpty)
+	})
+}
@@ -0,0 +1,210 @@
+package subtree
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/bsv-blockchain/go-bt/v2"
+)
+
+// txSpan is the byte range of the serialized transaction of a node index.
+type txSpan struct {
+	index int
+	start int
+	end   int
+}
+
+// NewSubtreeDataFromBytesParallel creates a new Data object from the provided byte
+// slice, parsing and hashing the transactions concurrently. The transaction
+// boundaries are found with a fast scan over the bytes, after which the
+// transactions are parsed by concurrency goroutines and stored in order.
+//
+// The result is identical to NewSubtreeDataFromBytes. When the data contains
+// errors, the error of the transaction with the lowest index is returned, regardless
+// of the order in which the goroutines finish.
+//
+// Parameters:
+//   - subtree: The subtree the data belongs to
+//   - dataBytes: The complete subtree data file
+//   - concurrency: The number of goroutines to use, runtime.NumCPU() when <= 0
+//
+// Returns:
+//   - *Data: A new Data object with all transactions
+//   - error: An error if the data does not match the subtree
+func NewSubtreeDataFromBytesParallel(subtree *Subtree, dataBytes []byte, concurrency int) (*Data, error) {
+	if subtree == nil || len(subtree.Nodes) == 0 {
+		return nil, ErrSubtreeNodesEmpty
+	}
+
+	spans, scanErr := scanTxSpans(subtree, dataBytes)
+
+	s, err := decodeParallel(subtree, dataBytes, spans, concurrency)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create subtree data from bytes: %w", err)
+	}
+
+	if scanErr != nil {
+		return nil, fmt.Errorf("unable to create subtree data from bytes: %w", scanErr)
+	}
+
+	return s, nil
+}
+
+// NewSubtreeDataFromBytesWithIndex creates a new Data object from the provided byte
+// slice, using the DataIndex of the data to find the transactions, which are then
+// parsed and hashed concurrently. Errors are reported for the lowest failing index.
+//
+// Parameters:
+//   - subtree: The subtree the data belongs to
+//   - dataBytes: The complete subtree data file
+//   - index: The index of the data file
+//   - concurrency: The number of goroutines to use, runtime.NumCPU() when <= 0
+//
+// Returns:
+//   - *Data: A new Data object with all transactions in the index
+//   - error: An error if the index or the data does not match the subtree
+func NewSubtreeDataFromBytesWithIndex(subtree *Subtree, dataBytes []byte, index *DataIndex, concurrency int) (*Data, error) {
+	if subtree == nil || len(subtree.Nodes) == 0 {
+		return nil, ErrSubtreeNodesEmpty
+	}
+
+	if index == nil || index.Len() != subtree.Length() {
+		return nil, ErrSubtreeLengthMismatch
+	}
+
+	if err := index.validate(); err != nil {
+		return nil, err
+	}
+
+	spans := make([]txSpan, 0, index.Len())
+
+	for i := range index.Offsets {
+		if index.Lengths[i] == 0 {
+			continue
+		}
+
+		end := index.Offsets[i] + uint64(index.Lengths[i])
+		if end > uint64(len(dataBytes)) {
+			return nil, fmt.Errorf("%w at index %d: index entry beyond end of data", ErrTransactionRead, i)
+		}
+
+		spans = append(spans, txSpan{
+			index: i,
+			start: int(index.Offsets[i]), //nolint:gosec // G115: bounded by len(dataBytes)
+			end:   int(end),              //nolint:gosec // G115: bounded by len(dataBytes)
+		})
+	}
+
+	s, err := decodeParallel(subtree, dataBytes, spans, concurrency)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create subtree data from bytes: %w", err)
+	}
+
+	return s, nil
+}
+
+// scanTxSpans finds the byte ranges of the transactions in dataBytes and assigns them
+// to node indices, following the same rules as DataReader. On error, the spans found
+// before the failing transaction are returned together with the error.
+func scanTxSpans(subtree *Subtree, dataBytes []byte) ([]txSpan, error) {
+	spans := make([]txSpan, 0, subtree.Length())
+
+	index := 0
+	if subtree.HasCoinbasePlaceholder() {
+		index = 1
+	}
+
+	for pos := 0; pos < len(dataBytes); {
+		length, err := scanTxLength(dataBytes[pos:])
+		if err != nil {
+			return spans, fmt.Errorf("%w at index %d: %w", ErrTransactionRead, index, err)
+		}
+
+		span := txSpan{index: index, start: pos, end: pos + length}
+		pos += length
+
+		if span.start == 0 && index == 1 {
+			// check whether the coinbase tx of the block has been written in place of the placeholder
+			if tx, err := bt.NewTxFromBytes(dataBytes[span.start:span.end]); err == nil && tx.IsCoinbase() {
+				span.index = 0
+				spans = append(spans, span)
+
+				continue
+			}
+		}
+
+		if index >= len(subtree.Nodes) {
+			return spans, fmt.Errorf("%w at index %d", ErrTxIndexOutOfBounds, index)
+		}
+
+		spans = append(spans, span)
+		index++
+	}
+
+	return spans, nil
+}
+
+// decodeParallel parses the transactions in the spans concurrently, validates them
+// against the subtree and returns the filled Data. The spans are divided in
+// contiguous chunks, one per goroutine, so the first error of every chunk is the
+// lowest failing index of that chunk, and the first failing chunk holds the lowest
+// failing index overall.
+func decodeParallel(subtree *Subtree, dataBytes []byte, spans []txSpan, concurrency int) (*Data, error) {
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+
+	s := &Data{
+		Subtree: subtree,
+		Txs:     make([]*bt.Tx, subtree.Length()),
+	}
+
+	chunkSize := (len(spans) + concurrency - 1) / concurrency
+	if chunkSize == 0 {
+		return s, nil
+	}
+
+	errs := make([]error, (len(spans)+chunkSize-1)/chunkSize)
+	coinbase := subtree.HasCoinbasePlaceholder()
+
+	var wg sync.WaitGroup
+
+	for chunk := range errs {
+		wg.Add(1)
+
+		go func(chunk int) {
+			defer wg.Done()
+
+			for _, span := range spans[chunk*chunkSize : Min((chunk+1)*chunkSize, len(spans))] {
+				tx, err := bt.NewTxFromBytes(dataBytes[span.start:span.end])
+				if err != nil {
+					errs[chunk] = fmt.Errorf("%w at index %d: %w", ErrTransactionRead, span.index, err)
+					return
+				}
+
+				if !subtree.Nodes[span.index].Hash.Equal(*tx.TxIDChainHash()) && !(span.index == 0 && coinbase && tx.IsCoinbase()) {
+					errs[chunk] = fmt.Errorf("%w at index %d", ErrTxHashMismatch, span.index)
+					return
+				}
+
+				s.Txs[span.index] = tx
+			}
+		}(chunk)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the coinbase policy and encoding follow from the transactions, see detectTx
+	for _, span := range spans {
+		s.detectTx(span.index, s.Txs[span.index])
+	}
+
+	return s, nil
+}
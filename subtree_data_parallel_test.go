@@ -0,0 +1,160 @@
+package subtree
+
+import (
+	"bytes"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/bsv-blockchain/go-bt/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildLargeTestData creates subtree data with count versioned transactions.
+func buildLargeTestData(t testing.TB, count int) (*Subtree, []byte) {
+	st, err := NewTreeByLeafCount(CeilPowerOfTwo(count))
+	require.NoError(t, err)
+
+	txs := make([]*bt.Tx, count)
+
+	for i := range txs {
+		txs[i] = tx.Clone()
+		txs[i].Version = uint32(i + 1) //nolint:gosec // G115: test data
+		require.NoError(t, st.AddNode(*txs[i].TxIDChainHash(), 1, 1))
+	}
+
+	data := NewSubtreeData(st)
+	for i, tx := range txs {
+		require.NoError(t, data.AddTx(tx, i))
+	}
+
+	b, err := data.Serialize()
+	require.NoError(t, err)
+
+	return st, b
+}
+
+func TestNewSubtreeDataFromBytesParallel(t *testing.T) {
+	t.Run("matches sequential decoding", func(t *testing.T) {
+		st, b := buildLargeTestData(t, 100)
+
+		expected, err := NewSubtreeDataFromBytes(st, b)
+		require.NoError(t, err)
+
+		for _, concurrency := range []int{0, 1, 3, 8, 200} {
+			data, err := NewSubtreeDataFromBytesParallel(st, b, concurrency)
+			require.NoError(t, err)
+			require.Len(t, data.Txs, len(expected.Txs))
+
+			for i := range expected.Txs {
+				assert.Equal(t, expected.Txs[i].TxID(), data.Txs[i].TxID())
+			}
+		}
+	})
+
+	t.Run("leading coinbase tx", func(t *testing.T) {
+		st, subtreeData, txs := setupCoinbaseTestSubtreeData(t)
+
+		b, err := subtreeData.Serialize()
+		require.NoError(t, err)
+
+		data, err := NewSubtreeDataFromBytesParallel(st, append(coinbaseTx.Bytes(), b...), 2)
+		require.NoError(t, err)
+		assert.Equal(t, coinbaseTx.TxID(), data.Txs[0].TxID())
+		assert.Equal(t, txs[2].TxID(), data.Txs[3].TxID())
+	})
+
+	t.Run("reports lowest failing index", func(t *testing.T) {
+		st, b := buildLargeTestData(t, 64)
+
+		// swap the txs at index 10 and 11, and 40 and 41
+		st.Nodes[10], st.Nodes[11] = st.Nodes[11], st.Nodes[10]
+		st.Nodes[40], st.Nodes[41] = st.Nodes[41], st.Nodes[40]
+
+		for i := 0; i < 10; i++ {
+			_, err := NewSubtreeDataFromBytesParallel(st, b, 8)
+			require.ErrorIs(t, err, ErrTxHashMismatch)
+			assert.Contains(t, err.Error(), "at index 10")
+		}
+	})
+
+	t.Run("parse error before scan error", func(t *testing.T) {
+		st, b := buildLargeTestData(t, 8)
+
+		_, err := NewSubtreeDataFromBytesParallel(st, b[:len(b)-1], 4)
+		require.ErrorIs(t, err, ErrTransactionRead)
+		assert.Contains(t, err.Error(), "at index 7")
+
+		st.Nodes[2].Hash = st.Nodes[3].Hash
+
+		_, err = NewSubtreeDataFromBytesParallel(st, b[:len(b)-1], 4)
+		require.ErrorIs(t, err, ErrTxHashMismatch)
+		assert.Contains(t, err.Error(), "at index 2")
+	})
+
+	t.Run("too many transactions", func(t *testing.T) {
+		st, b := buildLargeTestData(t, 4)
+
+		_, err := NewSubtreeDataFromBytesParallel(st, append(b, tx.Bytes()...), 2)
+		require.ErrorIs(t, err, ErrTxIndexOutOfBounds)
+	})
+
+	t.Run("empty subtree", func(t *testing.T) {
+		_, err := NewSubtreeDataFromBytesParallel(nil, nil, 2)
+		require.ErrorIs(t, err, ErrSubtreeNodesEmpty)
+	})
+}
+
+func TestNewSubtreeDataFromBytesWithIndex(t *testing.T) {
+	st, subtreeData, txs := setupCoinbaseTestSubtreeData(t)
+
+	b, index, err := subtreeData.SerializeWithIndex()
+	require.NoError(t, err)
+
+	data, err := NewSubtreeDataFromBytesWithIndex(st, b, index, 2)
+	require.NoError(t, err)
+	assert.Nil(t, data.Txs[0])
+
+	for i, expected := range txs {
+		assert.Equal(t, expected.TxID(), data.Txs[i+1].TxID())
+	}
+
+	_, err = NewSubtreeDataFromBytesWithIndex(st, b[:len(b)-1], index, 2)
+	require.ErrorIs(t, err, ErrTransactionRead)
+
+	_, err = NewSubtreeDataFromBytesWithIndex(st, b, NewDataIndex(1), 2)
+	require.ErrorIs(t, err, ErrSubtreeLengthMismatch)
+
+	// overlapping entries and an offset overflowing the end of the entry
+	for _, offset := range []uint64{index.Offsets[1], math.MaxUint64 - 1} {
+		corrupt := &DataIndex{Offsets: slices.Clone(index.Offsets), Lengths: slices.Clone(index.Lengths)}
+		corrupt.Offsets[2] = offset
+
+		_, err = NewSubtreeDataFromBytesWithIndex(st, b, corrupt, 2)
+		require.ErrorIs(t, err, ErrDataIndexCorrupt)
+	}
+
+	_, err = NewSubtreeDataFromBytesWithIndex(nil, b, index, 2)
+	require.ErrorIs(t, err, ErrSubtreeNodesEmpty)
+}
+
+func BenchmarkNewSubtreeDataFromBytes(b *testing.B) {
+	st, dataBytes := buildLargeTestData(b, 16*1024)
+
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := NewSubtreeDataFromReader(st, bytes.NewReader(dataBytes)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("parallel", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := NewSubtreeDataFromBytesParallel(st, dataBytes, 0); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,195 @@
+package subtree
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+
+	"github.com/bsv-blockchain/go-bt/v2"
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+)
+
+// DataReader reads the transactions of a subtree data stream one at a time, without
+// holding all transactions in memory. Every transaction is validated against the
+// node at the same index in the subtree.
+//
+// When the subtree starts with the coinbase placeholder, the stream normally starts
+// at index 1. A coinbase transaction at the start of the stream is accepted and
+// returned for index 0, the same way NewSubtreeDataFromReader handles it.
+//
+// A DataReader is not safe for concurrent use.
+type DataReader struct {
+	subtree *Subtree
+	reader  io.Reader
+	index   int
+	first   bool
+	err     error
+
+	// raw is set when the transactions are read without parsing them, see nextTxInpoints
+	raw *rawTxReader
+}
+
+// NewDataReader creates a new DataReader for the subtree data in reader.
+//
+// Parameters:
+//   - subtree: The subtree the data belongs to
+//   - reader: The reader with the serialized transactions
+//
+// Returns:
+//   - *DataReader: A new DataReader positioned at the first transaction
+//   - error: An error if the subtree is nil or has no nodes
+func NewDataReader(subtree *Subtree, reader io.Reader) (*DataReader, error) {
+	if subtree == nil || len(subtree.Nodes) == 0 {
+		return nil, ErrSubtreeNodesEmpty
+	}
+
+	return newDataReaderAt(subtree, reader, 0), nil
+}
+
+// Next reads the next transaction from the stream and returns it with its index in
+// the subtree. At the end of the stream io.EOF is returned, a stream ending within a
+// transaction results in an error wrapping io.ErrUnexpectedEOF. On any other error the
+// returned index is the index the failing transaction was expected at, and all
+// following calls return the same error.
+func (d *DataReader) Next() (int, *bt.Tx, error) {
+	if d.err != nil {
+		return d.index, nil, d.err
+	}
+
+	tx := &bt.Tx{}
+
+	n, err := tx.ReadFrom(d.reader)
+	if err != nil {
+		switch {
+		case n == 0 && errors.Is(err, io.EOF):
+			d.err = io.EOF
+		case errors.Is(err, io.EOF):
+			// the stream ends within the transaction
+			d.err = fmt.Errorf("%w at index %d: %w", ErrTransactionRead, d.index, io.ErrUnexpectedEOF)
+		default:
+			d.err = fmt.Errorf("%w at index %d: %w", ErrTransactionRead, d.index, err)
+		}
+
+		return d.index, nil, d.err
+	}
+
+	idx, err := d.place(tx.TxIDChainHash(), tx.IsCoinbase())
+	if err != nil {
+		return idx, nil, err
+	}
+
+	return idx, tx, nil
+}
+
+// All returns an iterator over the remaining transactions of the stream. The
+// iteration stops at the end of the stream or at the first error, which is then
+// returned by Err.
+func (d *DataReader) All() iter.Seq2[int, *bt.Tx] {
+	return func(yield func(int, *bt.Tx) bool) {
+		for {
+			idx, tx, err := d.Next()
+			if err != nil {
+				return
+			}
+
+			if !yield(idx, tx) {
+				return
+			}
+		}
+	}
+}
+
+// Err returns the first error encountered by the reader, nil if the reader has not
+// failed or has only reached the end of the stream.
+func (d *DataReader) Err() error {
+	if d.err == io.EOF { //nolint:errorlint // io.EOF is only stored unwrapped at the end of the stream
+		return nil
+	}
+
+	return d.err
+}
+
+// nextTxInpoints reads the next transaction from the stream like Next, but only derives
+// its TxInpoints from the serialized bytes, without parsing the transaction into a
+// bt.Tx. A DataReader must be read with either Next or nextTxInpoints, not both.
+func (d *DataReader) nextTxInpoints() (int, TxInpoints, error) {
+	if d.err != nil {
+		return d.index, TxInpoints{}, d.err
+	}
+
+	if d.raw == nil {
+		d.raw = newRawTxReader(d.reader)
+	}
+
+	b, err := d.raw.next()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			d.err = io.EOF
+		} else {
+			d.err = fmt.Errorf("%w at index %d: %w", ErrTransactionRead, d.index, err)
+		}
+
+		return d.index, TxInpoints{}, d.err
+	}
+
+	tx, err := scanTx(b, true)
+	if err != nil {
+		d.err = fmt.Errorf("%w at index %d: %w", ErrTransactionRead, d.index, err)
+		return d.index, TxInpoints{}, d.err
+	}
+
+	idx, err := d.place(&tx.txid, tx.coinbase)
+	if err != nil {
+		return idx, TxInpoints{}, err
+	}
+
+	return idx, tx.inpoints, nil
+}
+
+// place validates the transaction with the txid against the subtree and returns the
+// index it is at. The coinbase transaction of the block is accepted for index 0 at the
+// start of a stream for a subtree with the coinbase placeholder.
+func (d *DataReader) place(txid *chainhash.Hash, coinbase bool) (int, error) {
+	if d.first {
+		d.first = false
+
+		if d.index == 1 && coinbase {
+			// the coinbase tx of the block has been written in place of the placeholder
+			return 0, nil
+		}
+	}
+
+	if d.index >= len(d.subtree.Nodes) {
+		d.err = fmt.Errorf("%w at index %d", ErrTxIndexOutOfBounds, d.index)
+		return d.index, d.err
+	}
+
+	if !d.subtree.Nodes[d.index].Hash.Equal(*txid) {
+		d.err = fmt.Errorf("%w at index %d", ErrTxHashMismatch, d.index)
+		return d.index, d.err
+	}
+
+	idx := d.index
+	d.index++
+
+	return idx, nil
+}
+
+// newDataReaderAt creates a new DataReader for a stream positioned at the transaction
+// for index start. When the subtree starts with the coinbase placeholder and start is
+// 0 or 1, a coinbase transaction at the start of the stream is returned for index 0.
+func newDataReaderAt(subtree *Subtree, reader io.Reader, start int) *DataReader {
+	d := &DataReader{
+		subtree: subtree,
+		reader:  reader,
+		index:   start,
+	}
+
+	if start <= 1 && subtree.HasCoinbasePlaceholder() {
+		d.index = 1
+		d.first = true
+	}
+
+	return d
+}
@@ -0,0 +1,203 @@
+package subtree
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/bsv-blockchain/go-bt/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var coinbaseTx, _ = bt.NewTxFromString("02000000010000000000000000000000000000000000000000000000000000000000000000ffffffff03510101ffffffff0100f2052a01000000232103656065e6886ca1e947de3471c9e723673ab6ba34724476417fa9fcef8bafa604ac00000000")
+
+// setupCoinbaseTestSubtreeData creates a subtree starting with the coinbase
+// placeholder, followed by 3 versioned transactions.
+func setupCoinbaseTestSubtreeData(t *testing.T) (*Subtree, *Data, []*bt.Tx) {
+	t.Helper()
+
+	txs := make([]*bt.Tx, 3)
+	for i := range txs {
+		txs[i] = tx.Clone()
+		txs[i].Version = uint32(i + 1)
+	}
+
+	subtree, err := NewTree(2)
+	require.NoError(t, err)
+	require.NoError(t, subtree.AddCoinbaseNode())
+
+	for _, tx := range txs {
+		require.NoError(t, subtree.AddNode(*tx.TxIDChainHash(), 111, 0))
+	}
+
+	subtreeData := NewSubtreeData(subtree)
+	for i, tx := range txs {
+		require.NoError(t, subtreeData.AddTx(tx, i+1))
+	}
+
+	return subtree, subtreeData, txs
+}
+
+func TestDataReader(t *testing.T) {
+	t.Run("yields all transactions in order", func(t *testing.T) {
+		subtree, subtreeData, txs := setupTestSubtreeData(t)
+
+		b, err := subtreeData.Serialize()
+		require.NoError(t, err)
+
+		reader, err := NewDataReader(subtree, bytes.NewReader(b))
+		require.NoError(t, err)
+
+		for i, expected := range txs {
+			idx, readTx, err := reader.Next()
+			require.NoError(t, err)
+			assert.Equal(t, i, idx)
+			assert.Equal(t, expected.TxID(), readTx.TxID())
+		}
+
+		_, readTx, err := reader.Next()
+		require.ErrorIs(t, err, io.EOF)
+		assert.Nil(t, readTx)
+		require.NoError(t, reader.Err())
+	})
+
+	t.Run("skips coinbase placeholder", func(t *testing.T) {
+		subtree, subtreeData, txs := setupCoinbaseTestSubtreeData(t)
+
+		b, err := subtreeData.Serialize()
+		require.NoError(t, err)
+
+		reader, err := NewDataReader(subtree, bytes.NewReader(b))
+		require.NoError(t, err)
+
+		indices := make([]int, 0, len(txs))
+		for idx, readTx := range reader.All() {
+			indices = append(indices, idx)
+			assert.Equal(t, txs[idx-1].TxID(), readTx.TxID())
+		}
+
+		require.NoError(t, reader.Err())
+		assert.Equal(t, []int{1, 2, 3}, indices)
+	})
+
+	t.Run("leading coinbase tx is returned for index 0", func(t *testing.T) {
+		subtree, subtreeData, _ := setupCoinbaseTestSubtreeData(t)
+
+		b, err := subtreeData.Serialize()
+		require.NoError(t, err)
+
+		reader, err := NewDataReader(subtree, bytes.NewReader(append(coinbaseTx.Bytes(), b...)))
+		require.NoError(t, err)
+
+		idx, readTx, err := reader.Next()
+		require.NoError(t, err)
+		assert.Equal(t, 0, idx)
+		assert.Equal(t, coinbaseTx.TxID(), readTx.TxID())
+
+		idx, _, err = reader.Next()
+		require.NoError(t, err)
+		assert.Equal(t, 1, idx)
+	})
+
+	t.Run("leading coinbase tx with only the final sequence number", func(t *testing.T) {
+		subtree, subtreeData, _ := setupCoinbaseTestSubtreeData(t)
+
+		b, err := subtreeData.Serialize()
+		require.NoError(t, err)
+
+		reader, err := NewDataReader(subtree, bytes.NewReader(append(sequenceCoinbaseTx.Bytes(), b...)))
+		require.NoError(t, err)
+
+		idx, readTx, err := reader.Next()
+		require.NoError(t, err)
+		assert.Equal(t, 0, idx)
+		assert.Equal(t, sequenceCoinbaseTx.TxID(), readTx.TxID())
+
+		// the same with the transactions read without parsing them
+		reader, err = NewDataReader(subtree, bytes.NewReader(append(sequenceCoinbaseTx.Bytes(), b...)))
+		require.NoError(t, err)
+
+		idx, _, err = reader.nextTxInpoints()
+		require.NoError(t, err)
+		assert.Equal(t, 0, idx)
+
+		idx, _, err = reader.nextTxInpoints()
+		require.NoError(t, err)
+		assert.Equal(t, 1, idx)
+	})
+
+	t.Run("reports index of mismatch", func(t *testing.T) {
+		subtree, _, txs := setupTestSubtreeData(t)
+
+		b := append(txs[0].Bytes(), txs[2].Bytes()...)
+
+		reader, err := NewDataReader(subtree, bytes.NewReader(b))
+		require.NoError(t, err)
+
+		_, _, err = reader.Next()
+		require.NoError(t, err)
+
+		idx, _, err := reader.Next()
+		require.ErrorIs(t, err, ErrTxHashMismatch)
+		assert.Equal(t, 1, idx)
+		assert.Contains(t, err.Error(), "at index 1")
+
+		// the error is sticky
+		_, _, err = reader.Next()
+		require.ErrorIs(t, err, ErrTxHashMismatch)
+		require.ErrorIs(t, reader.Err(), ErrTxHashMismatch)
+	})
+
+	t.Run("too many transactions", func(t *testing.T) {
+		subtree, subtreeData, txs := setupTestSubtreeData(t)
+
+		b, err := subtreeData.Serialize()
+		require.NoError(t, err)
+
+		reader, err := NewDataReader(subtree, bytes.NewReader(append(b, txs[0].Bytes()...)))
+		require.NoError(t, err)
+
+		count := 0
+		for range reader.All() {
+			count++
+		}
+
+		assert.Equal(t, len(txs), count)
+		require.ErrorIs(t, reader.Err(), ErrTxIndexOutOfBounds)
+	})
+
+	t.Run("truncated transaction", func(t *testing.T) {
+		subtree, _, txs := setupTestSubtreeData(t)
+
+		b := txs[0].Bytes()
+
+		reader, err := NewDataReader(subtree, bytes.NewReader(b[:len(b)-2]))
+		require.NoError(t, err)
+
+		idx, _, err := reader.Next()
+		require.ErrorIs(t, err, ErrTransactionRead)
+		assert.Equal(t, 0, idx)
+	})
+
+	t.Run("stream ends within a transaction", func(t *testing.T) {
+		subtree, _, txs := setupTestSubtreeData(t)
+
+		b := txs[0].Bytes()
+
+		for _, l := range []int{4, 5, 6, 10, 11, len(b) - 1} {
+			reader, err := NewDataReader(subtree, bytes.NewReader(b[:l]))
+			require.NoError(t, err)
+
+			idx, _, err := reader.Next()
+			require.ErrorIs(t, err, io.ErrUnexpectedEOF, "length %d", l)
+			assert.Equal(t, 0, idx)
+			require.ErrorIs(t, reader.Err(), io.ErrUnexpectedEOF)
+		}
+	})
+
+	t.Run("empty subtree", func(t *testing.T) {
+		_, err := NewDataReader(nil, bytes.NewReader(nil))
+		require.ErrorIs(t, err, ErrSubtreeNodesEmpty)
+	})
+}
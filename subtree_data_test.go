@@ -260,6 +260,21 @@ func TestNewSubtreeDataFromBytes(t *testing.T) {
 		require.Error(t, err)
 		assert.Nil(t, newData)
 	})
+
+	t.Run("truncated within a transaction", func(t *testing.T) {
+		subtree, data, _ := setupTestSubtreeData(t)
+
+		serialized, err := data.Serialize()
+		require.NoError(t, err)
+
+		for _, l := range []int{4, 5, 6, 10, 11, len(serialized) - 1} {
+			_, err = NewSubtreeDataFromBytes(subtree, serialized[:l])
+			require.ErrorIs(t, err, io.ErrUnexpectedEOF, "length %d", l)
+
+			_, err = NewSubtreeDataFromBytesParallel(subtree, serialized[:l], 2)
+			require.Error(t, err, "length %d", l)
+		}
+	})
 }
 
 func TestNewSubtreeDataFromReader(t *testing.T) {
@@ -0,0 +1,236 @@
+package subtree
+
+import (
+	"fmt"
+
+	"github.com/bsv-blockchain/go-bt/v2"
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+	safe "github.com/bsv-blockchain/go-safe-conversion"
+)
+
+// OutputValueLookup returns the value in satoshis of the output spent by inpoint, and
+// whether the output is known. It is used to recompute the fees of transactions that
+// are not in Extended Format, and whose parents are not part of the subtree. The
+// inpoints of a transaction can be taken from its Meta.
+type OutputValueLookup func(inpoint Inpoint) (satoshis uint64, ok bool)
+
+// FeeMismatchKind is the kind of mismatch found by AuditFeesAndSizes.
+type FeeMismatchKind uint8
+
+const (
+	// FeeMismatchSize indicates that the size of a node does not match the size of its transaction
+	FeeMismatchSize FeeMismatchKind = iota + 1
+	// FeeMismatchFee indicates that the fee of a node does not match the fee of its transaction
+	FeeMismatchFee
+	// FeeMismatchTotalSize indicates that Subtree.SizeInBytes does not match the total size of the transactions
+	FeeMismatchTotalSize
+	// FeeMismatchTotalFee indicates that Subtree.Fees does not match the total fee of the transactions
+	FeeMismatchTotalFee
+	// FeeMismatchNegativeFee indicates that a transaction creates more satoshis than it spends,
+	// which makes it invalid whatever fee is recorded for its node
+	FeeMismatchNegativeFee
+)
+
+// String returns a string representation of the mismatch kind.
+func (k FeeMismatchKind) String() string {
+	switch k {
+	case FeeMismatchSize:
+		return "size mismatch"
+	case FeeMismatchFee:
+		return "fee mismatch"
+	case FeeMismatchTotalSize:
+		return "total size mismatch"
+	case FeeMismatchTotalFee:
+		return "total fee mismatch"
+	case FeeMismatchNegativeFee:
+		return "negative fee"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(k))
+	}
+}
+
+// FeeMismatch describes a fee or size recorded in the subtree that does not match the
+// value recomputed from the transactions.
+type FeeMismatch struct {
+	// Kind is the kind of mismatch
+	Kind FeeMismatchKind
+	// Index is the index of the node in the subtree, -1 for the subtree totals
+	Index int
+	// TxID is the txid of the node, empty for the subtree totals
+	TxID chainhash.Hash
+	// Recorded is the value recorded in the node or subtree
+	Recorded uint64
+	// Computed is the value recomputed from the transactions, for FeeMismatchNegativeFee
+	// the number of satoshis the transaction creates in excess of the satoshis it spends
+	Computed uint64
+}
+
+// String returns a string representation of the mismatch.
+func (m FeeMismatch) String() string {
+	if m.Index == -1 {
+		return fmt.Sprintf("%s: recorded %d, computed %d", m.Kind, m.Recorded, m.Computed)
+	}
+
+	return fmt.Sprintf("%s at index %d for %s: recorded %d, computed %d", m.Kind, m.Index, m.TxID.String(), m.Recorded, m.Computed)
+}
+
+// FeeAudit is the result of AuditFeesAndSizes.
+type FeeAudit struct {
+	// Mismatches holds every mismatch found, the node mismatches ordered by index followed by the totals
+	Mismatches []FeeMismatch
+	// Fees is the total fee of the transactions whose fee could be recomputed
+	Fees uint64
+	// SizeInBytes is the total size of the transactions
+	SizeInBytes uint64
+	// Unverified holds the indices of the transactions whose fee could not be recomputed,
+	// because the value of one of the spent outputs is not known
+	Unverified []int
+}
+
+// AuditFeesAndSizes recomputes the fee and size of every transaction in the subtree data
+// and compares them with the fee and size recorded in the subtree nodes, and the totals
+// with Subtree.Fees and Subtree.SizeInBytes.
+//
+// Sizes are always recomputed. To recompute the fee of a transaction the value of every
+// spent output must be known: it is taken from the transaction itself when it is in
+// Extended Format, from the parent transaction when it is part of the same subtree, or
+// else from lookup. Transactions for which an output value is unknown are reported in
+// Unverified, and the total fee is only compared when all fees have been recomputed.
+// A transaction spending less than it creates is reported as FeeMismatchNegativeFee and
+// does not add to the total fee.
+// The coinbase placeholder is not checked. A coinbase transaction that replaced the
+// placeholder only has its size checked, it spends no outputs and has no fee.
+//
+// Parameters:
+//   - data: The subtree data holding all transactions of the subtree
+//   - lookup: An optional lookup of the values of outputs spent outside the subtree, can be nil
+//
+// Returns:
+//   - *FeeAudit: The result of the audit, without mismatches when all fees and sizes are correct
+//   - error: An error if the data is not set, or a transaction is missing or does not match the subtree
+func AuditFeesAndSizes(data *Data, lookup OutputValueLookup) (*FeeAudit, error) {
+	if data == nil || data.Subtree == nil {
+		return nil, ErrSubtreeNil
+	}
+
+	st := data.Subtree
+	length := st.Length()
+
+	var start int
+	if st.HasCoinbasePlaceholder() {
+		start = 1
+	}
+
+	audit := &FeeAudit{
+		Mismatches: []FeeMismatch{},
+		Unverified: []int{},
+	}
+
+	for i := start; i < length; i++ {
+		node := st.Nodes[i]
+
+		if i >= len(data.Txs) || data.Txs[i] == nil {
+			return nil, fmt.Errorf("%w at index %d", ErrTransactionNil, i)
+		}
+
+		tx := data.Txs[i]
+		if !node.Hash.Equal(*tx.TxIDChainHash()) {
+			return nil, fmt.Errorf("%w at index %d", ErrTxHashMismatch, i)
+		}
+
+		size, err := safe.IntToUint64(tx.Size())
+		if err != nil {
+			return nil, fmt.Errorf("unable to get size of transaction at index %d: %w", i, err)
+		}
+
+		audit.SizeInBytes += size
+
+		if size != node.SizeInBytes {
+			audit.Mismatches = append(audit.Mismatches, FeeMismatch{
+				Kind: FeeMismatchSize, Index: i, TxID: node.Hash, Recorded: node.SizeInBytes, Computed: size,
+			})
+		}
+
+		if i == 0 && tx.IsCoinbase() {
+			continue
+		}
+
+		inputs, ok := data.inputSatoshis(tx, lookup)
+		if !ok {
+			audit.Unverified = append(audit.Unverified, i)
+			continue
+		}
+
+		outputs := tx.TotalOutputSatoshis()
+		if inputs < outputs {
+			audit.Mismatches = append(audit.Mismatches, FeeMismatch{
+				Kind: FeeMismatchNegativeFee, Index: i, TxID: node.Hash, Recorded: node.Fee, Computed: outputs - inputs,
+			})
+
+			continue
+		}
+
+		fee := inputs - outputs
+		audit.Fees += fee
+
+		if fee != node.Fee {
+			audit.Mismatches = append(audit.Mismatches, FeeMismatch{
+				Kind: FeeMismatchFee, Index: i, TxID: node.Hash, Recorded: node.Fee, Computed: fee,
+			})
+		}
+	}
+
+	if audit.SizeInBytes != st.SizeInBytes {
+		audit.Mismatches = append(audit.Mismatches, FeeMismatch{
+			Kind: FeeMismatchTotalSize, Index: -1, Recorded: st.SizeInBytes, Computed: audit.SizeInBytes,
+		})
+	}
+
+	if len(audit.Unverified) == 0 && audit.Fees != st.Fees {
+		audit.Mismatches = append(audit.Mismatches, FeeMismatch{
+			Kind: FeeMismatchTotalFee, Index: -1, Recorded: st.Fees, Computed: audit.Fees,
+		})
+	}
+
+	return audit, nil
+}
+
+// inputSatoshis returns the total value of the outputs spent by tx, and false when the
+// value of one of them is not known.
+func (s *Data) inputSatoshis(tx *bt.Tx, lookup OutputValueLookup) (uint64, bool) {
+	var inputs uint64
+
+	if tx.IsExtended() {
+		inputs = tx.TotalInputSatoshis()
+	} else {
+		for _, input := range tx.Inputs {
+			satoshis, ok := s.outputValue(Inpoint{Hash: *input.PreviousTxIDChainHash(), Index: input.PreviousTxOutIndex}, lookup)
+			if !ok {
+				return 0, false
+			}
+
+			inputs += satoshis
+		}
+	}
+
+	return inputs, true
+}
+
+// outputValue returns the value of the output spent by inpoint, from a parent in the
+// subtree data or from lookup.
+func (s *Data) outputValue(inpoint Inpoint, lookup OutputValueLookup) (uint64, bool) {
+	if idx := s.Subtree.NodeIndex(inpoint.Hash); idx != -1 && idx < len(s.Txs) && s.Txs[idx] != nil {
+		parent := s.Txs[idx]
+		if inpoint.Index < len32(parent.Outputs) {
+			return parent.Outputs[inpoint.Index].Satoshis, true
+		}
+
+		return 0, false
+	}
+
+	if lookup == nil {
+		return 0, false
+	}
+
+	return lookup(inpoint)
+}
@@ -0,0 +1,214 @@
+package subtree
+
+import (
+	"testing"
+
+	"github.com/bsv-blockchain/go-bt/v2"
+	"github.com/bsv-blockchain/go-bt/v2/bscript"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildFeeAuditData returns subtree data with an extended tx, a standard child of that tx
+// paying a fee of 50, and a standard tx spending an output outside the subtree. The
+// fees and sizes of the nodes are taken from fees and sizes when set.
+func buildFeeAuditData(t *testing.T, coinbase bool, fees, sizes []uint64) (*Data, []*bt.Tx) {
+	t.Helper()
+
+	parent := tx.Clone()
+	parent.Version = 10
+
+	child := bt.NewTx()
+	input := &bt.Input{PreviousTxOutIndex: 1, SequenceNumber: 0xffffffff, UnlockingScript: &bscript.Script{}}
+	require.NoError(t, input.PreviousTxIDAdd(parent.TxIDChainHash()))
+	child.Inputs = append(child.Inputs, input)
+	child.AddOutput(&bt.Output{Satoshis: parent.Outputs[1].Satoshis - 50, LockingScript: parent.Outputs[1].LockingScript})
+
+	external, err := bt.NewTxFromBytes(tx.Bytes())
+	require.NoError(t, err)
+	external.Version = 11
+
+	txs := []*bt.Tx{parent, child, external}
+
+	if fees == nil {
+		fees = []uint64{156, 50, 156}
+	}
+
+	if sizes == nil {
+		sizes = []uint64{uint64(parent.Size()), uint64(child.Size()), uint64(external.Size())} //nolint:gosec // G115: test data
+	}
+
+	st, err := NewTreeByLeafCount(4)
+	require.NoError(t, err)
+
+	if coinbase {
+		require.NoError(t, st.AddCoinbaseNode())
+	}
+
+	for i, tx := range txs {
+		require.NoError(t, st.AddNode(*tx.TxIDChainHash(), fees[i], sizes[i]))
+	}
+
+	data := NewSubtreeData(st)
+	for i, tx := range txs {
+		idx := i
+		if coinbase {
+			idx++
+		}
+
+		require.NoError(t, data.AddTx(tx, idx))
+	}
+
+	return data, txs
+}
+
+// externalLookup returns the value of the output spent by the external test transaction.
+func externalLookup(inpoint Inpoint) (uint64, bool) {
+	if inpoint.Hash.Equal(*tx.Inputs[0].PreviousTxIDChainHash()) && inpoint.Index == tx.Inputs[0].PreviousTxOutIndex {
+		return tx.Inputs[0].PreviousTxSatoshis, true
+	}
+
+	return 0, false
+}
+
+func TestAuditFeesAndSizes(t *testing.T) {
+	t.Run("correct fees and sizes", func(t *testing.T) {
+		data, txs := buildFeeAuditData(t, false, nil, nil)
+
+		audit, err := AuditFeesAndSizes(data, externalLookup)
+		require.NoError(t, err)
+		assert.Empty(t, audit.Mismatches)
+		assert.Empty(t, audit.Unverified)
+		assert.Equal(t, uint64(156+50+156), audit.Fees)
+		assert.Equal(t, uint64(txs[0].Size()+txs[1].Size()+txs[2].Size()), audit.SizeInBytes) //nolint:gosec // G115: test data
+	})
+
+	t.Run("without lookup", func(t *testing.T) {
+		data, _ := buildFeeAuditData(t, false, nil, nil)
+
+		audit, err := AuditFeesAndSizes(data, nil)
+		require.NoError(t, err)
+		assert.Empty(t, audit.Mismatches)
+		assert.Equal(t, []int{2}, audit.Unverified)
+		assert.Equal(t, uint64(156+50), audit.Fees)
+	})
+
+	t.Run("wrong fees and sizes", func(t *testing.T) {
+		data, txs := buildFeeAuditData(t, false, []uint64{156, 60, 156}, []uint64{uint64(tx.Size()), 10, uint64(tx.Size())}) //nolint:gosec // G115: test data
+
+		audit, err := AuditFeesAndSizes(data, externalLookup)
+		require.NoError(t, err)
+
+		require.Len(t, audit.Mismatches, 4)
+		assert.Equal(t, FeeMismatch{
+			Kind: FeeMismatchSize, Index: 1, TxID: *txs[1].TxIDChainHash(), Recorded: 10, Computed: uint64(txs[1].Size()), //nolint:gosec // G115: test data
+		}, audit.Mismatches[0])
+		assert.Equal(t, FeeMismatch{
+			Kind: FeeMismatchFee, Index: 1, TxID: *txs[1].TxIDChainHash(), Recorded: 60, Computed: 50,
+		}, audit.Mismatches[1])
+		assert.Equal(t, FeeMismatchTotalSize, audit.Mismatches[2].Kind)
+		assert.Equal(t, -1, audit.Mismatches[2].Index)
+		assert.Equal(t, FeeMismatch{
+			Kind: FeeMismatchTotalFee, Index: -1, Recorded: 156 + 60 + 156, Computed: 156 + 50 + 156,
+		}, audit.Mismatches[3])
+
+		assert.Equal(t, "fee mismatch at index 1 for "+txs[1].TxID()+": recorded 60, computed 50", audit.Mismatches[1].String())
+		assert.Equal(t, "total fee mismatch: recorded 372, computed 362", audit.Mismatches[3].String())
+	})
+
+	t.Run("subtree totals out of sync with nodes", func(t *testing.T) {
+		data, _ := buildFeeAuditData(t, false, nil, nil)
+		data.Subtree.Fees++
+
+		audit, err := AuditFeesAndSizes(data, externalLookup)
+		require.NoError(t, err)
+		require.Len(t, audit.Mismatches, 1)
+		assert.Equal(t, FeeMismatchTotalFee, audit.Mismatches[0].Kind)
+
+		// the total fee is not compared when not all fees could be recomputed
+		audit, err = AuditFeesAndSizes(data, nil)
+		require.NoError(t, err)
+		assert.Empty(t, audit.Mismatches)
+	})
+
+	t.Run("coinbase placeholder", func(t *testing.T) {
+		data, _ := buildFeeAuditData(t, true, nil, nil)
+
+		audit, err := AuditFeesAndSizes(data, externalLookup)
+		require.NoError(t, err)
+		assert.Empty(t, audit.Mismatches)
+		assert.Empty(t, audit.Unverified)
+	})
+
+	t.Run("coinbase placeholder replaced by the coinbase tx", func(t *testing.T) {
+		data, txs := buildFeeAuditData(t, true, nil, nil)
+		require.NoError(t, data.Subtree.ReplaceCoinbasePlaceholder(coinbaseTx))
+		require.NoError(t, data.AddTx(coinbaseTx, 0))
+
+		audit, err := AuditFeesAndSizes(data, externalLookup)
+		require.NoError(t, err)
+		assert.Empty(t, audit.Mismatches)
+		assert.Empty(t, audit.Unverified)
+		assert.Equal(t, uint64(156+50+156), audit.Fees)
+		assert.Equal(t, uint64(coinbaseTx.Size()+txs[0].Size()+txs[1].Size()+txs[2].Size()), audit.SizeInBytes) //nolint:gosec // G115: test data
+
+		// the total fee is compared
+		data.Subtree.Fees++
+
+		audit, err = AuditFeesAndSizes(data, externalLookup)
+		require.NoError(t, err)
+		require.Len(t, audit.Mismatches, 1)
+		assert.Equal(t, FeeMismatchTotalFee, audit.Mismatches[0].Kind)
+	})
+
+	t.Run("spending more than the inputs", func(t *testing.T) {
+		data, _ := buildFeeAuditData(t, false, nil, nil)
+
+		audit, err := AuditFeesAndSizes(data, func(Inpoint) (uint64, bool) { return 1, true })
+		require.NoError(t, err)
+		require.Len(t, audit.Mismatches, 2)
+		assert.Equal(t, FeeMismatch{
+			Kind:     FeeMismatchNegativeFee,
+			Index:    2,
+			TxID:     data.Subtree.Nodes[2].Hash,
+			Recorded: 156,
+			Computed: data.Txs[2].TotalOutputSatoshis() - 1,
+		}, audit.Mismatches[0])
+		assert.Equal(t, FeeMismatchTotalFee, audit.Mismatches[1].Kind)
+		assert.Equal(t, uint64(206), audit.Fees)
+		assert.Empty(t, audit.Unverified)
+	})
+
+	t.Run("spending more than the inputs with a recorded fee of 0", func(t *testing.T) {
+		data, _ := buildFeeAuditData(t, false, []uint64{156, 50, 0}, nil)
+
+		audit, err := AuditFeesAndSizes(data, func(Inpoint) (uint64, bool) { return 1, true })
+		require.NoError(t, err)
+		require.Len(t, audit.Mismatches, 1)
+		assert.Equal(t, FeeMismatchNegativeFee, audit.Mismatches[0].Kind)
+		assert.Equal(t, 2, audit.Mismatches[0].Index)
+		assert.Contains(t, audit.Mismatches[0].String(), "negative fee at index 2")
+	})
+
+	t.Run("missing transaction", func(t *testing.T) {
+		data, _ := buildFeeAuditData(t, false, nil, nil)
+		data.Txs[1] = nil
+
+		_, err := AuditFeesAndSizes(data, externalLookup)
+		require.ErrorIs(t, err, ErrTransactionNil)
+	})
+
+	t.Run("nil data", func(t *testing.T) {
+		_, err := AuditFeesAndSizes(nil, nil)
+		require.ErrorIs(t, err, ErrSubtreeNil)
+	})
+}
+
+func TestFeeMismatchKindString(t *testing.T) {
+	assert.Equal(t, "size mismatch", FeeMismatchSize.String())
+	assert.Equal(t, "fee mismatch", FeeMismatchFee.String())
+	assert.Equal(t, "total size mismatch", FeeMismatchTotalSize.String())
+	assert.Equal(t, "total fee mismatch", FeeMismatchTotalFee.String())
+	assert.Equal(t, "negative fee", FeeMismatchNegativeFee.String())
+	assert.Equal(t, "unknown(0)", FeeMismatchKind(0).String())
+}
@@ -0,0 +1,252 @@
+package subtree
+
+import (
+	"fmt"
+
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+)
+
+// Merge combines two subtrees into a new subtree, with the nodes of a followed by the
+// nodes of b. The new subtree has the size of the largest of the two subtrees, or the
+// next power of two that fits all nodes when they do not fit. Fees, sizes and
+// conflicting nodes of both subtrees are carried over.
+//
+// The coinbase placeholder is only allowed as the first node of the merged subtree,
+// so it may be in a, but not in b.
+//
+// Parameters:
+//   - a: The subtree whose nodes come first
+//   - b: The subtree whose nodes are appended
+//
+// Returns:
+//   - *Subtree: The merged subtree
+//   - error: An error if a subtree is nil or b contains the coinbase placeholder
+func Merge(a, b *Subtree) (*Subtree, error) {
+	if a == nil || b == nil {
+		return nil, ErrSubtreeNil
+	}
+
+	if b.HasCoinbasePlaceholder() {
+		return nil, fmt.Errorf("[Merge] %w, second subtree starts with the coinbase placeholder", ErrCoinbasePlaceholderMisuse)
+	}
+
+	total := a.Length() + b.Length()
+	leafCount := CeilPowerOfTwo(Max(Max(a.Size(), b.Size()), total))
+
+	merged, err := NewTreeByLeafCount(leafCount)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = appendSubtreeNodes(merged, a.Nodes); err != nil {
+		return nil, err
+	}
+
+	if err = appendSubtreeNodes(merged, b.Nodes); err != nil {
+		return nil, err
+	}
+
+	merged.Fees = a.Fees + b.Fees
+	merged.SizeInBytes = a.SizeInBytes + b.SizeInBytes
+	merged.SetConflictingNodes(mergeConflictingNodes(a.ConflictingNodes, b.ConflictingNodes))
+
+	return merged, nil
+}
+
+// Split splits a subtree into subtrees of leafCount leaves each, keeping the order of
+// the nodes. Every subtree except the last one is complete. The coinbase placeholder,
+// if any, stays the first node of the first subtree, and conflicting nodes are
+// carried over to the subtree the node ends up in.
+//
+// Parameters:
+//   - st: The subtree to split
+//   - leafCount: The number of leaves of the new subtrees, must be a power of two
+//
+// Returns:
+//   - []*Subtree: The new subtrees, empty when st has no nodes
+//   - error: An error if the subtree is nil or leafCount is not a power of two
+func Split(st *Subtree, leafCount int) ([]*Subtree, error) {
+	if st == nil {
+		return nil, ErrSubtreeNil
+	}
+
+	if !IsPowerOfTwo(leafCount) {
+		return nil, ErrNotPowerOfTwo
+	}
+
+	length := st.Length()
+	subtrees := make([]*Subtree, 0, (length+leafCount-1)/leafCount)
+
+	conflicting := make(map[chainhash.Hash]struct{}, len(st.ConflictingNodes))
+	for _, hash := range st.ConflictingNodes {
+		conflicting[hash] = struct{}{}
+	}
+
+	for start := 0; start < length; start += leafCount {
+		part, err := NewTreeByLeafCount(leafCount)
+		if err != nil {
+			return nil, err
+		}
+
+		nodes := st.Nodes[start:Min(start+leafCount, length)]
+
+		if err = appendSubtreeNodes(part, nodes); err != nil {
+			return nil, err
+		}
+
+		var partConflicting []chainhash.Hash
+
+		for _, node := range nodes {
+			if _, ok := conflicting[node.Hash]; ok {
+				partConflicting = append(partConflicting, node.Hash)
+			}
+		}
+
+		part.SetConflictingNodes(partConflicting)
+
+		subtrees = append(subtrees, part)
+	}
+
+	return subtrees, nil
+}
+
+// MergeData merges the subtrees of a and b with Merge and combines their
+// transactions in the same order.
+func MergeData(a, b *Data) (*Data, error) {
+	if a == nil || b == nil || a.Subtree == nil || b.Subtree == nil {
+		return nil, ErrSubtreeNil
+	}
+
+	merged, err := Merge(a.Subtree, b.Subtree)
+	if err != nil {
+		return nil, err
+	}
+
+	data := NewSubtreeData(merged)
+	data.Encoding = a.Encoding
+	data.CoinbasePolicy = a.CoinbasePolicy
+
+	aLength := a.Subtree.Length()
+	copy(data.Txs, a.Txs[:Min(aLength, len(a.Txs))])
+	copy(data.Txs[aLength:], b.Txs[:Min(b.Subtree.Length(), len(b.Txs))])
+
+	return data, nil
+}
+
+// SplitData splits the subtree of the data with Split and divides the transactions
+// over the new subtrees.
+func SplitData(data *Data, leafCount int) ([]*Data, error) {
+	if data == nil || data.Subtree == nil {
+		return nil, ErrSubtreeNil
+	}
+
+	subtrees, err := Split(data.Subtree, leafCount)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([]*Data, len(subtrees))
+
+	for i, st := range subtrees {
+		parts[i] = NewSubtreeData(st)
+		parts[i].Encoding = data.Encoding
+		parts[i].CoinbasePolicy = data.CoinbasePolicy
+
+		start := i * leafCount
+		if start < len(data.Txs) {
+			copy(parts[i].Txs, data.Txs[start:Min(start+st.Length(), len(data.Txs))])
+		}
+	}
+
+	return parts, nil
+}
+
+// MergeMeta merges the subtrees of a and b with Merge and combines their
+// TxInpoints in the same order.
+func MergeMeta(a, b *Meta) (*Meta, error) {
+	if a == nil || b == nil || a.Subtree == nil || b.Subtree == nil {
+		return nil, ErrSubtreeNil
+	}
+
+	merged, err := Merge(a.Subtree, b.Subtree)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := NewSubtreeMeta(merged)
+	meta.Format = a.Format
+
+	aLength := a.Subtree.Length()
+	copy(meta.TxInpoints, a.TxInpoints[:Min(aLength, len(a.TxInpoints))])
+	copy(meta.TxInpoints[aLength:], b.TxInpoints[:Min(b.Subtree.Length(), len(b.TxInpoints))])
+
+	return meta, nil
+}
+
+// SplitMeta splits the subtree of the meta with Split and divides the TxInpoints
+// over the new subtrees.
+func SplitMeta(meta *Meta, leafCount int) ([]*Meta, error) {
+	if meta == nil || meta.Subtree == nil {
+		return nil, ErrSubtreeNil
+	}
+
+	subtrees, err := Split(meta.Subtree, leafCount)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([]*Meta, len(subtrees))
+
+	for i, st := range subtrees {
+		parts[i] = NewSubtreeMeta(st)
+		parts[i].Format = meta.Format
+
+		start := i * leafCount
+		if start < len(meta.TxInpoints) {
+			copy(parts[i].TxInpoints, meta.TxInpoints[start:Min(start+st.Length(), len(meta.TxInpoints))])
+		}
+	}
+
+	return parts, nil
+}
+
+// appendSubtreeNodes appends the nodes to the subtree, adding a leading coinbase
+// placeholder with AddCoinbaseNode.
+func appendSubtreeNodes(st *Subtree, nodes []Node) error {
+	for i, node := range nodes {
+		if i == 0 && st.Length() == 0 && node.Hash.Equal(CoinbasePlaceholderHashValue) {
+			if err := st.AddCoinbaseNode(); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := st.AddSubtreeNode(node); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergeConflictingNodes returns the union of both lists of conflicting nodes, in order.
+func mergeConflictingNodes(a, b []chainhash.Hash) []chainhash.Hash {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+
+	merged := make([]chainhash.Hash, 0, len(a)+len(b))
+	seen := make(map[chainhash.Hash]struct{}, len(a)+len(b))
+
+	for _, hash := range append(a[:len(a):len(a)], b...) {
+		if _, ok := seen[hash]; ok {
+			continue
+		}
+
+		seen[hash] = struct{}{}
+		merged = append(merged, hash)
+	}
+
+	return merged
+}
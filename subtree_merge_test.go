@@ -0,0 +1,233 @@
+package subtree
+
+import (
+	"testing"
+
+	"github.com/bsv-blockchain/go-bt/v2"
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerge(t *testing.T) {
+	h := make([]chainhash.Hash, 6)
+	for i := range h {
+		h[i] = chainhash.HashH([]byte{byte(i)})
+	}
+
+	t.Run("merge two half full subtrees", func(t *testing.T) {
+		a, err := NewTreeByLeafCount(4)
+		require.NoError(t, err)
+		require.NoError(t, a.AddCoinbaseNode())
+		require.NoError(t, a.AddNode(h[0], 1, 10))
+		require.NoError(t, a.AddConflictingNode(h[0]))
+
+		b, err := NewTreeByLeafCount(4)
+		require.NoError(t, err)
+		require.NoError(t, b.AddNode(h[1], 2, 20))
+		require.NoError(t, b.AddNode(h[2], 3, 30))
+		require.NoError(t, b.AddConflictingNode(h[2]))
+
+		merged, err := Merge(a, b)
+		require.NoError(t, err)
+
+		assert.Equal(t, 4, merged.Size())
+		assert.True(t, merged.IsComplete())
+		assert.Equal(t, []Node{
+			{Hash: CoinbasePlaceholderHashValue},
+			{Hash: h[0], Fee: 1, SizeInBytes: 10},
+			{Hash: h[1], Fee: 2, SizeInBytes: 20},
+			{Hash: h[2], Fee: 3, SizeInBytes: 30},
+		}, merged.Nodes)
+		assert.Equal(t, uint64(6), merged.Fees)
+		assert.Equal(t, uint64(60), merged.SizeInBytes)
+		assert.Equal(t, []chainhash.Hash{h[0], h[2]}, merged.ConflictingNodes)
+		assert.True(t, merged.IsConflicting(h[2]))
+		assert.False(t, merged.IsConflicting(h[1]))
+	})
+
+	t.Run("merge grows to fit", func(t *testing.T) {
+		a, err := NewTreeByLeafCount(2)
+		require.NoError(t, err)
+		require.NoError(t, a.AddNode(h[0], 1, 1))
+		require.NoError(t, a.AddNode(h[1], 1, 1))
+
+		b, err := NewTreeByLeafCount(2)
+		require.NoError(t, err)
+		require.NoError(t, b.AddNode(h[2], 1, 1))
+
+		merged, err := Merge(a, b)
+		require.NoError(t, err)
+		assert.Equal(t, 4, merged.Size())
+		assert.Equal(t, 3, merged.Length())
+		assert.Nil(t, merged.ConflictingNodes)
+	})
+
+	t.Run("coinbase placeholder in second subtree", func(t *testing.T) {
+		a, err := NewTreeByLeafCount(2)
+		require.NoError(t, err)
+
+		b, err := NewTreeByLeafCount(2)
+		require.NoError(t, err)
+		require.NoError(t, b.AddCoinbaseNode())
+
+		_, err = Merge(a, b)
+		require.ErrorIs(t, err, ErrCoinbasePlaceholderMisuse)
+	})
+
+	t.Run("nil subtree", func(t *testing.T) {
+		_, err := Merge(nil, nil)
+		require.ErrorIs(t, err, ErrSubtreeNil)
+	})
+}
+
+func TestSplit(t *testing.T) {
+	h := make([]chainhash.Hash, 6)
+	for i := range h {
+		h[i] = chainhash.HashH([]byte{byte(i)})
+	}
+
+	st, err := NewTreeByLeafCount(8)
+	require.NoError(t, err)
+	require.NoError(t, st.AddCoinbaseNode())
+
+	for i, hash := range h {
+		require.NoError(t, st.AddNode(hash, uint64(i+1), uint64(i+1)))
+	}
+
+	require.NoError(t, st.AddConflictingNode(h[4]))
+
+	t.Run("split into power of two children", func(t *testing.T) {
+		parts, err := Split(st, 2)
+		require.NoError(t, err)
+		require.Len(t, parts, 4)
+
+		assert.Equal(t, CoinbasePlaceholderHashValue, parts[0].Nodes[0].Hash)
+		assert.Equal(t, h[0], parts[0].Nodes[1].Hash)
+		assert.Equal(t, uint64(1), parts[0].Fees)
+		assert.Equal(t, []Node{{Hash: h[5], Fee: 6, SizeInBytes: 6}}, parts[3].Nodes)
+		assert.Equal(t, []chainhash.Hash{h[4]}, parts[2].ConflictingNodes)
+		assert.True(t, parts[2].IsConflicting(h[4]))
+		assert.Empty(t, parts[1].ConflictingNodes)
+
+		var fees uint64
+		for _, part := range parts {
+			assert.Equal(t, 2, part.Size())
+			fees += part.Fees
+		}
+
+		assert.Equal(t, st.Fees, fees)
+	})
+
+	t.Run("merge after split restores the subtree", func(t *testing.T) {
+		parts, err := Split(st, 4)
+		require.NoError(t, err)
+		require.Len(t, parts, 2)
+
+		merged, err := Merge(parts[0], parts[1])
+		require.NoError(t, err)
+		assert.Equal(t, st.RootHash(), merged.RootHash())
+		assert.Equal(t, st.Fees, merged.Fees)
+		assert.Equal(t, st.ConflictingNodes, merged.ConflictingNodes)
+	})
+
+	t.Run("invalid leaf count", func(t *testing.T) {
+		_, err := Split(st, 3)
+		require.ErrorIs(t, err, ErrNotPowerOfTwo)
+	})
+
+	t.Run("nil subtree", func(t *testing.T) {
+		_, err := Split(nil, 2)
+		require.ErrorIs(t, err, ErrSubtreeNil)
+	})
+}
+
+func TestMergeAndSplitData(t *testing.T) {
+	txs := make([]*bt.Tx, 4)
+	for i := range txs {
+		txs[i] = tx.Clone()
+		txs[i].Version = uint32(i + 1)
+	}
+
+	newData := func(t *testing.T, txs []*bt.Tx) *Data {
+		st, err := NewTreeByLeafCount(4)
+		require.NoError(t, err)
+
+		for _, tx := range txs {
+			require.NoError(t, st.AddNode(*tx.TxIDChainHash(), 1, 1))
+		}
+
+		data := NewSubtreeData(st)
+		for i, tx := range txs {
+			require.NoError(t, data.AddTx(tx, i))
+		}
+
+		return data
+	}
+
+	a := newData(t, txs[:1])
+	b := newData(t, txs[1:])
+
+	merged, err := MergeData(a, b)
+	require.NoError(t, err)
+	assert.Equal(t, txs, merged.Txs)
+
+	mergedBytes, err := merged.Serialize()
+	require.NoError(t, err)
+
+	parts, err := SplitData(merged, 2)
+	require.NoError(t, err)
+	require.Len(t, parts, 2)
+	assert.Equal(t, txs[:2], parts[0].Txs)
+	assert.Equal(t, txs[2:], parts[1].Txs)
+
+	var partBytes []byte
+
+	for _, part := range parts {
+		b, err := part.Serialize()
+		require.NoError(t, err)
+
+		partBytes = append(partBytes, b...)
+	}
+
+	assert.Equal(t, mergedBytes, partBytes)
+
+	_, err = MergeData(a, nil)
+	require.ErrorIs(t, err, ErrSubtreeNil)
+
+	_, err = SplitData(nil, 2)
+	require.ErrorIs(t, err, ErrSubtreeNil)
+}
+
+func TestMergeAndSplitMeta(t *testing.T) {
+	txs, _, meta := initMeta(t)
+
+	parts, err := SplitMeta(meta, 2)
+	require.NoError(t, err)
+	require.Len(t, parts, 2)
+
+	for i, part := range parts {
+		for j := 0; j < 2; j++ {
+			assert.Equal(t, meta.TxInpoints[i*2+j], part.TxInpoints[j])
+			assert.Equal(t, *txs[i*2+j].TxIDChainHash(), part.Subtree.Nodes[j].Hash)
+		}
+	}
+
+	merged, err := MergeMeta(parts[0], parts[1])
+	require.NoError(t, err)
+	assert.Equal(t, meta.TxInpoints, merged.TxInpoints)
+	assert.Equal(t, meta.Subtree.RootHash(), merged.Subtree.RootHash())
+
+	metaBytes, err := meta.Serialize()
+	require.NoError(t, err)
+
+	mergedBytes, err := merged.Serialize()
+	require.NoError(t, err)
+	assert.Equal(t, metaBytes, mergedBytes)
+
+	_, err = MergeMeta(nil, parts[0])
+	require.ErrorIs(t, err, ErrSubtreeNil)
+
+	_, err = SplitMeta(nil, 2)
+	require.ErrorIs(t, err, ErrSubtreeNil)
+}
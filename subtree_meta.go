@@ -1,8 +1,10 @@
 package subtree
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 
@@ -17,6 +19,9 @@ type Meta struct {
 	Subtree *Subtree
 	// TxInpoints is a lookup of the parent tx inpoints for each node in the subtree
 	TxInpoints []TxInpoints
+	// Format is the format used when serializing the meta. The readers set it to the
+	// format of the data they read.
+	Format MetaFormat
 
 	// RootHash is the hash of the root node of the subtree
 	rootHash chainhash.Hash
@@ -40,6 +45,7 @@ func NewSubtreeMeta(subtree *Subtree) *Meta {
 
 // NewSubtreeMetaFromBytes creates a new Meta object from the provided byte slice.
 // It reads the subtree meta data from the byte slice and populates the Meta struct.
+// The root hash stored in the data must match the root hash of the subtree.
 //
 // Parameters:
 //   - subtree: The subtree for which to create the meta
@@ -47,12 +53,29 @@ func NewSubtreeMeta(subtree *Subtree) *Meta {
 //
 // Returns:
 //   - *Meta: A new Meta object populated with data from the byte slice
-//   - error: An error if the deserialization fails
+//   - error: An error if the deserialization fails, a *RootHashMismatchError if the meta is for another subtree
 func NewSubtreeMetaFromBytes(subtree *Subtree, dataBytes []byte) (*Meta, error) {
 	s := &Meta{
 		Subtree: subtree,
 	}
-	if err := s.deserializeFromReader(bytes.NewReader(dataBytes)); err != nil {
+	if err := s.deserializeFromReader(bytes.NewReader(dataBytes), true); err != nil {
+		return nil, fmt.Errorf("unable to create subtree meta from bytes: %w", err)
+	}
+
+	return s, nil
+}
+
+// NewSubtreeMetaFromBytesLenient is identical to NewSubtreeMetaFromBytes, but does not
+// check the stored root hash against the subtree. It is meant for legacy meta files
+// that were written without a valid root hash, the stored hash is still available
+// through StoredRootHash. A meta in the dictionary format that references parents by
+// their node index can only be read when the root hash matches, those references
+// cannot be resolved against another subtree.
+func NewSubtreeMetaFromBytesLenient(subtree *Subtree, dataBytes []byte) (*Meta, error) {
+	s := &Meta{
+		Subtree: subtree,
+	}
+	if err := s.deserializeFromReader(bytes.NewReader(dataBytes), false); err != nil {
 		return nil, fmt.Errorf("unable to create subtree meta from bytes: %w", err)
 	}
 
@@ -60,6 +83,7 @@ func NewSubtreeMetaFromBytes(subtree *Subtree, dataBytes []byte) (*Meta, error)
 }
 
 // NewSubtreeMetaFromReader creates a new Meta object from the provided reader.
+// The root hash stored in the data must match the root hash of the subtree.
 //
 // Parameters:
 //   - subtree: The subtree for which to create the meta
@@ -67,20 +91,73 @@ func NewSubtreeMetaFromBytes(subtree *Subtree, dataBytes []byte) (*Meta, error)
 //
 // Returns:
 //   - *Meta: A new Meta object populated with data from the reader
-//   - error: An error if the deserialization fails
+//   - error: An error if the deserialization fails, a *RootHashMismatchError if the meta is for another subtree
 func NewSubtreeMetaFromReader(subtree *Subtree, dataReader io.Reader) (*Meta, error) {
 	s := &Meta{
 		Subtree:    subtree,
 		TxInpoints: make([]TxInpoints, subtree.Size()),
 	}
 
-	if err := s.deserializeFromReader(dataReader); err != nil {
+	if err := s.deserializeFromReader(dataReader, true); err != nil {
+		return nil, fmt.Errorf("unable to create subtree meta from reader: %w", err)
+	}
+
+	return s, nil
+}
+
+// NewSubtreeMetaFromReaderLenient is identical to NewSubtreeMetaFromReader, but does not
+// check the stored root hash against the subtree, see NewSubtreeMetaFromBytesLenient.
+func NewSubtreeMetaFromReaderLenient(subtree *Subtree, dataReader io.Reader) (*Meta, error) {
+	s := &Meta{
+		Subtree:    subtree,
+		TxInpoints: make([]TxInpoints, subtree.Size()),
+	}
+
+	if err := s.deserializeFromReader(dataReader, false); err != nil {
 		return nil, fmt.Errorf("unable to create subtree meta from reader: %w", err)
 	}
 
 	return s, nil
 }
 
+// PeekMetaRootHash returns the root hash from the start of a serialized subtree meta,
+// without consuming any data from the reader. It can be used to find the subtree a
+// meta file belongs to before loading it from the same reader.
+//
+// Parameters:
+//   - reader: The buffered reader positioned at the start of the subtree meta data
+//
+// Returns:
+//   - *chainhash.Hash: The root hash stored in the subtree meta
+//   - error: An error if the root hash cannot be read
+func PeekMetaRootHash(reader *bufio.Reader) (*chainhash.Hash, error) {
+	b, err := reader.Peek(chainhash.HashSize)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return nil, fmt.Errorf("unable to read root hash: %w", err)
+	}
+
+	hash := chainhash.Hash(b)
+
+	return &hash, nil
+}
+
+// StoredRootHash returns the root hash stored with the meta: the root hash read from
+// the serialized meta, or written by the last call to Serialize. It is nil when the
+// meta has neither been read nor serialized, or when the stored root hash is empty.
+func (s *Meta) StoredRootHash() *chainhash.Hash {
+	if s.rootHash.Equal(chainhash.Hash{}) {
+		return nil
+	}
+
+	hash := s.rootHash
+
+	return &hash
+}
+
 // GetParentTxHashes returns the unique parent transaction hashes for the specified index in the subtree meta.
 // It returns an error if the index is out of range.
 //
@@ -119,6 +196,10 @@ func (s *Meta) GetTxInpoints(index int) ([]Inpoint, error) {
 // It finds the index of the transaction in the subtree and sets the TxInpoints at that index.
 // If the transaction is not found in the subtree, it returns an error.
 //
+// It is safe to call SetTxInpointsFromTx and SetTxInpoints concurrently from multiple
+// goroutines, as long as each transaction is only set once. The TxInpoints slice should
+// only be read once all concurrent calls have returned.
+//
 // Parameters:
 //   - tx: The transaction to set the TxInpoints from
 //
@@ -143,6 +224,9 @@ func (s *Meta) SetTxInpointsFromTx(tx *bt.Tx) error {
 // SetTxInpoints sets the TxInpoints at the specified index in the subtree meta.
 // It returns an error if the index is out of range.
 //
+// It is safe to call SetTxInpoints concurrently from multiple goroutines for different
+// indices, every call only writes its own element of the TxInpoints slice.
+//
 // Parameters:
 //   - idx: The index at which to set the TxInpoints
 //   - txInpoints: The TxInpoints to set at the specified index
@@ -150,7 +234,7 @@ func (s *Meta) SetTxInpointsFromTx(tx *bt.Tx) error {
 // Returns:
 //   - error: An error if the index is out of range
 func (s *Meta) SetTxInpoints(idx int, txInpoints TxInpoints) error {
-	if idx >= len(s.TxInpoints) {
+	if idx < 0 || idx >= len(s.TxInpoints) {
 		return ErrIndexOutOfRange
 	}
 
@@ -186,7 +270,13 @@ func (s *Meta) Serialize() ([]byte, error) {
 		return nil, fmt.Errorf("cannot serialize, unable to write root hash: %w", err)
 	}
 
-	if err = s.serializeTxInpoints(buf); err != nil {
+	if s.Format != MetaFormatLegacy {
+		err = s.serializeFormatted(buf)
+	} else {
+		err = s.serializeTxInpoints(buf)
+	}
+
+	if err != nil {
 		return nil, err
 	}
 
@@ -198,10 +288,11 @@ func (s *Meta) Serialize() ([]byte, error) {
 //
 // Parameters:
 //   - buf: The reader from which to read the subtree meta data
+//   - checkRootHash: Whether the stored root hash must match the root hash of the subtree
 //
 // Returns:
 //   - error: An error if the deserialization fails
-func (s *Meta) deserializeFromReader(buf io.Reader) error {
+func (s *Meta) deserializeFromReader(buf io.Reader, checkRootHash bool) error {
 	var (
 		err       error
 		dataBytes [4]byte
@@ -215,12 +306,22 @@ func (s *Meta) deserializeFromReader(buf io.Reader) error {
 
 	s.rootHash = hashBytes
 
+	rootMismatch := checkMetaRootHash(s.Subtree, s.rootHash)
+	if checkRootHash && rootMismatch != nil {
+		return rootMismatch
+	}
+
 	// read the number of parent tx hashes
 	if _, err = io.ReadFull(buf, dataBytes[:]); err != nil {
 		return fmt.Errorf("unable to read number of parent tx hashes: %w", err)
 	}
 
 	txInpointsLen := binary.LittleEndian.Uint32(dataBytes[:])
+	if txInpointsLen == metaFormatMarker {
+		return s.deserializeFormatted(buf, rootMismatch)
+	}
+
+	s.Format = MetaFormatLegacy
 
 	// read the parent tx hashes
 	s.TxInpoints = make([]TxInpoints, s.Subtree.Size())
@@ -228,6 +329,21 @@ func (s *Meta) deserializeFromReader(buf io.Reader) error {
 	return s.deserializeTxInpointsFromReader(buf, txInpointsLen)
 }
 
+// checkMetaRootHash returns a *RootHashMismatchError when the root hash stored in a meta
+// file is not the root hash of the subtree.
+func checkMetaRootHash(subtree *Subtree, actual chainhash.Hash) error {
+	var expected chainhash.Hash
+	if rootHash := subtree.RootHash(); rootHash != nil {
+		expected = *rootHash
+	}
+
+	if !expected.Equal(actual) {
+		return &RootHashMismatchError{Expected: expected, Actual: actual}
+	}
+
+	return nil
+}
+
 // deserializeTxInpointsFromReader reads the TxInpoints from the provided reader
 // and populates the TxInpoints slice in the Meta.
 //
@@ -0,0 +1,395 @@
+package subtree
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"unsafe"
+
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+	safe "github.com/bsv-blockchain/go-safe-conversion"
+)
+
+// metaArenaEntry locates the TxInpoints of a node in the arenas of a MetaArena. It has no
+// pointer fields, so a slice of entries is never scanned by the GC and can be stored in
+// mmap'd memory.
+type metaArenaEntry struct {
+	parentStart uint32
+	parentCount uint32
+	voutStart   uint32
+	voutCount   uint32
+}
+
+// metaArenaEntrySize is the size of a metaArenaEntry in bytes.
+const metaArenaEntrySize = int(unsafe.Sizeof(metaArenaEntry{}))
+
+// MetaArena holds the same information as a Meta, but stores the parent hashes and the
+// packed vout words of all nodes in two contiguous arenas, instead of two small slices
+// per node. Building a MetaArena for a subtree of a million nodes takes a handful of
+// allocations instead of millions, and because none of the arenas contain pointers, the
+// GC does not have to scan them. The arenas can also be placed in mmap'd memory, see
+// NewMetaArenaFromReaderMmap.
+//
+// The TxInpoints of a node are handed out as views into the arenas, which must be
+// treated as read-only.
+type MetaArena struct {
+	// Subtree is the subtree this meta is for
+	Subtree *Subtree
+	// Format is the format used when serializing the meta. The readers set it to the
+	// format of the data they read.
+	Format MetaFormat
+
+	entries []metaArenaEntry
+	parents []chainhash.Hash
+	vouts   []uint32
+
+	// closer is non-nil when the arenas are backed by mmap'd memory
+	closer io.Closer
+}
+
+// NewMetaArena creates a new, empty MetaArena for the subtree.
+//
+// Parameters:
+//   - subtree: The subtree for which to create the meta
+//
+// Returns:
+//   - *MetaArena: A new MetaArena with an entry for every node the subtree has room for
+func NewMetaArena(subtree *Subtree) *MetaArena {
+	return &MetaArena{
+		Subtree: subtree,
+		entries: make([]metaArenaEntry, subtree.Size()),
+	}
+}
+
+// NewMetaArenaFromMeta creates a new MetaArena with a copy of the TxInpoints of the meta.
+//
+// Parameters:
+//   - meta: The meta to copy
+//
+// Returns:
+//   - *MetaArena: A new MetaArena with the same TxInpoints and format as the meta
+//   - error: An error if the meta is nil or holds invalid TxInpoints
+func NewMetaArenaFromMeta(meta *Meta) (*MetaArena, error) {
+	if meta == nil {
+		return nil, ErrSubtreeMetaNil
+	}
+
+	a := NewMetaArena(meta.Subtree)
+	a.Format = meta.Format
+
+	var parentCount, voutCount int
+
+	for i := range meta.TxInpoints {
+		parentCount += len(meta.TxInpoints[i].ParentTxHashes)
+		voutCount += len(meta.TxInpoints[i].voutIdxs)
+	}
+
+	a.parents = make([]chainhash.Hash, 0, parentCount)
+	a.vouts = make([]uint32, 0, voutCount)
+
+	for i := range meta.TxInpoints {
+		if len(meta.TxInpoints[i].ParentTxHashes) == 0 {
+			continue
+		}
+
+		if err := a.SetTxInpoints(i, meta.TxInpoints[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+// NewMetaArenaFromBytes creates a new MetaArena from the provided byte slice, in any of
+// the formats written by Meta.Serialize. The root hash stored in the data must match the
+// root hash of the subtree.
+//
+// Parameters:
+//   - subtree: The subtree for which to create the meta
+//   - dataBytes: The byte slice containing the serialized subtree meta data
+//
+// Returns:
+//   - *MetaArena: A new MetaArena populated with the deserialized data
+//   - error: An error if the deserialization fails, a *RootHashMismatchError if the meta is for another subtree
+func NewMetaArenaFromBytes(subtree *Subtree, dataBytes []byte) (*MetaArena, error) {
+	a := NewMetaArena(subtree)
+
+	if err := a.deserializeFromReader(bytes.NewReader(dataBytes)); err != nil {
+		return nil, fmt.Errorf("unable to create subtree meta arena from bytes: %w", err)
+	}
+
+	return a, nil
+}
+
+// NewMetaArenaFromReader creates a new MetaArena from the provided reader, in any of the
+// formats written by Meta.Serialize. The root hash stored in the data must match the
+// root hash of the subtree.
+//
+// Parameters:
+//   - subtree: The subtree for which to create the meta
+//   - dataReader: The reader from which to read the serialized subtree meta data
+//
+// Returns:
+//   - *MetaArena: A new MetaArena populated with the deserialized data
+//   - error: An error if the deserialization fails, a *RootHashMismatchError if the meta is for another subtree
+func NewMetaArenaFromReader(subtree *Subtree, dataReader io.Reader) (*MetaArena, error) {
+	a := NewMetaArena(subtree)
+
+	if err := a.deserializeFromReader(dataReader); err != nil {
+		return nil, fmt.Errorf("unable to create subtree meta arena from reader: %w", err)
+	}
+
+	return a, nil
+}
+
+// NewMetaArenaFromReaderMmap creates a new MetaArena from the provided reader, like
+// NewMetaArenaFromReader, and moves the arenas to file-backed mmap'd memory in dir,
+// which allows the OS to page them out. An mmap-backed MetaArena is read-only. Call
+// Close() when done.
+func NewMetaArenaFromReaderMmap(subtree *Subtree, dataReader io.Reader, dir string) (*MetaArena, error) {
+	a, err := NewMetaArenaFromReader(subtree, dataReader)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = a.moveToMmap(dir); err != nil {
+		return nil, fmt.Errorf("mmap allocation for subtree meta arena failed: %w", err)
+	}
+
+	return a, nil
+}
+
+// Close releases the mmap'd memory of an mmap-backed MetaArena. It is a no-op for heap
+// backed arenas. The MetaArena, and any TxInpoints handed out by it, must not be used
+// after Close.
+func (a *MetaArena) Close() error {
+	if a == nil || a.closer == nil {
+		return nil
+	}
+
+	return a.closer.Close()
+}
+
+// IsMmapBacked returns true if the arenas are backed by mmap'd memory.
+func (a *MetaArena) IsMmapBacked() bool {
+	return a != nil && a.closer != nil
+}
+
+// TxInpoints returns the TxInpoints of the node at index idx, as a read-only view into
+// the arenas. Nodes for which no TxInpoints have been set return the zero value.
+func (a *MetaArena) TxInpoints(idx int) (TxInpoints, error) {
+	if idx < 0 || idx >= len(a.entries) {
+		return TxInpoints{}, ErrIndexOutOfRange
+	}
+
+	return a.view(idx), nil
+}
+
+// GetParentTxHashes returns the parent transaction hashes of the node at index idx, as a
+// read-only view into the arena.
+func (a *MetaArena) GetParentTxHashes(idx int) ([]chainhash.Hash, error) {
+	if idx < 0 || idx >= len(a.entries) {
+		return nil, ErrIndexOutOfRange
+	}
+
+	return a.view(idx).ParentTxHashes, nil
+}
+
+// GetTxInpoints returns the inpoints of the node at index idx.
+func (a *MetaArena) GetTxInpoints(idx int) ([]Inpoint, error) {
+	if idx < 0 || idx >= len(a.entries) {
+		return nil, ErrIndexOutOfRange
+	}
+
+	p := a.view(idx)
+
+	return p.GetTxInpoints(), nil
+}
+
+// SetTxInpoints copies the TxInpoints of the node at index idx into the arenas. Setting
+// the TxInpoints of a node again leaves the previous copy unused in the arenas, views
+// handed out before keep referring to it. SetTxInpoints is not safe for concurrent use,
+// and returns ErrMetaArenaReadOnly for an mmap-backed MetaArena.
+func (a *MetaArena) SetTxInpoints(idx int, txInpoints TxInpoints) error {
+	if a.closer != nil {
+		return ErrMetaArenaReadOnly
+	}
+
+	if idx < 0 || idx >= len(a.entries) {
+		return ErrIndexOutOfRange
+	}
+
+	parentCount := len(txInpoints.ParentTxHashes)
+	if (parentCount == 0 && len(txInpoints.voutIdxs) != 0) || (parentCount > 0 && len(txInpoints.voutIdxs) < parentCount) {
+		return ErrParentTxHashesMismatch
+	}
+
+	parentStart := len(a.parents)
+	voutStart := len(a.vouts)
+
+	a.parents = append(a.parents, txInpoints.ParentTxHashes...)
+	a.vouts = append(a.vouts, txInpoints.voutIdxs...)
+
+	return a.setEntry(idx, parentStart, voutStart)
+}
+
+// ToMeta returns a Meta for the same subtree, with the TxInpoints of every node as a
+// read-only view into the arenas. The TxInpoints are not copied.
+func (a *MetaArena) ToMeta() *Meta {
+	txInpoints := make([]TxInpoints, len(a.entries))
+
+	for i := range a.entries {
+		txInpoints[i] = a.view(i)
+	}
+
+	return &Meta{
+		Subtree:    a.Subtree,
+		TxInpoints: txInpoints,
+		Format:     a.Format,
+	}
+}
+
+// Serialize returns the serialized form of the subtree meta, in the format of the
+// MetaArena. The result is identical to serializing the equivalent Meta.
+func (a *MetaArena) Serialize() ([]byte, error) {
+	return a.ToMeta().Serialize()
+}
+
+// view returns the TxInpoints of the node at index idx, aliasing the arenas. The capacity
+// of the slices is limited, so an append to the view never writes into the arenas.
+func (a *MetaArena) view(idx int) TxInpoints {
+	e := a.entries[idx]
+	if e.parentCount == 0 {
+		return TxInpoints{}
+	}
+
+	parentEnd := e.parentStart + e.parentCount
+	voutEnd := e.voutStart + e.voutCount
+
+	return NewTxInpointsFromPacked(a.parents[e.parentStart:parentEnd:parentEnd], a.vouts[e.voutStart:voutEnd:voutEnd])
+}
+
+// setEntry points the entry of the node at index idx to the data appended to the arenas
+// since parentStart and voutStart.
+func (a *MetaArena) setEntry(idx, parentStart, voutStart int) error {
+	var (
+		e   metaArenaEntry
+		err error
+	)
+
+	if e.parentStart, err = safe.IntToUint32(parentStart); err != nil {
+		return err
+	}
+
+	if e.parentCount, err = safe.IntToUint32(len(a.parents) - parentStart); err != nil {
+		return err
+	}
+
+	if e.voutStart, err = safe.IntToUint32(voutStart); err != nil {
+		return err
+	}
+
+	if e.voutCount, err = safe.IntToUint32(len(a.vouts) - voutStart); err != nil {
+		return err
+	}
+
+	a.entries[idx] = e
+
+	return nil
+}
+
+// deserializeFromReader reads a serialized meta, in any format, directly into the arenas.
+func (a *MetaArena) deserializeFromReader(reader io.Reader) error {
+	buf, ok := reader.(interface {
+		io.Reader
+		io.ByteReader
+	})
+	if !ok {
+		buf = bufio.NewReaderSize(reader, 32*1024) // 32KB buffer
+	}
+
+	var (
+		err       error
+		rootHash  chainhash.Hash
+		dataBytes [4]byte
+		records   *metaRecords
+	)
+
+	if _, err = io.ReadFull(buf, rootHash[:]); err != nil {
+		return fmt.Errorf("unable to read root hash: %w", err)
+	}
+
+	if err = checkMetaRootHash(a.Subtree, rootHash); err != nil {
+		return err
+	}
+
+	if _, err = io.ReadFull(buf, dataBytes[:]); err != nil {
+		return fmt.Errorf("unable to read number of parent tx hashes: %w", err)
+	}
+
+	if count := binary.LittleEndian.Uint32(dataBytes[:]); count != metaFormatMarker {
+		if uint64(count) > uint64(len(a.entries)) {
+			return fmt.Errorf("%w: meta has %d tx inpoints, subtree has room for %d", ErrSubtreeLengthMismatch, count, len(a.entries))
+		}
+
+		// the legacy format is the format without any flags
+		records = &metaRecords{codec: &metaCodec{subtree: a.Subtree}, count: count, buf: buf, br: buf}
+	} else if records, err = openFormattedRecords(a.Subtree, buf); err != nil {
+		return err
+	}
+
+	a.Format = records.codec.format
+
+	// most transactions have 1 or 2 parents, with a single vout each
+	a.parents = make([]chainhash.Hash, 0, records.count*2)
+	a.vouts = make([]uint32, 0, records.count*4)
+
+	for i := 0; i < int(records.count); i++ {
+		parentStart := len(a.parents)
+		voutStart := len(a.vouts)
+
+		if a.parents, err = records.codec.appendParents(records.buf, records.br, a.parents); err != nil {
+			return fmt.Errorf("unable to deserialize parent outpoints %d: %w", i, err)
+		}
+
+		if a.vouts, err = records.codec.appendVouts(records.buf, records.br, a.vouts, len(a.parents)-parentStart); err != nil {
+			return fmt.Errorf("unable to deserialize parent outpoints %d: %w", i, err)
+		}
+
+		if err = a.setEntry(i, parentStart, voutStart); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// moveToMmap copies the entries and arenas into a single file-backed mmap region in dir,
+// and releases the heap memory.
+func (a *MetaArena) moveToMmap(dir string) error {
+	entriesSize := len(a.entries) * metaArenaEntrySize
+	parentsSize := len(a.parents) * chainhash.HashSize
+	voutsSize := len(a.vouts) * 4
+
+	// a zero-sized mapping is not possible
+	data, store, err := newFileBackedMmap(Max(entriesSize+parentsSize+voutsSize, 1), dir, "subtree-meta-*")
+	if err != nil {
+		return err
+	}
+
+	// the mmap'd region is page aligned, and every section is a multiple of 4 bytes
+	entries := unsafe.Slice((*metaArenaEntry)(unsafe.Pointer(unsafe.SliceData(data))), len(a.entries))               //nolint:gosec // G103: intentional unsafe for mmap-backed arena
+	parents := unsafe.Slice((*chainhash.Hash)(unsafe.Pointer(unsafe.SliceData(data[entriesSize:]))), len(a.parents)) //nolint:gosec // G103: intentional unsafe for mmap-backed arena
+	vouts := unsafe.Slice((*uint32)(unsafe.Pointer(unsafe.SliceData(data[entriesSize+parentsSize:]))), len(a.vouts)) //nolint:gosec // G103: intentional unsafe for mmap-backed arena
+
+	copy(entries, a.entries)
+	copy(parents, a.parents)
+	copy(vouts, a.vouts)
+
+	a.entries, a.parents, a.vouts = entries, parents, vouts
+	a.closer = store
+
+	return nil
+}
@@ -0,0 +1,219 @@
+package subtree
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetaArena(t *testing.T) {
+	t.Run("from meta", func(t *testing.T) {
+		meta := buildFormatTestMeta(t, 100)
+
+		a, err := NewMetaArenaFromMeta(meta)
+		require.NoError(t, err)
+		assert.False(t, a.IsMmapBacked())
+		require.NoError(t, a.Close())
+
+		requireArenaEqual(t, meta, a)
+
+		_, err = NewMetaArenaFromMeta(nil)
+		require.ErrorIs(t, err, ErrSubtreeMetaNil)
+	})
+
+	formats := []MetaFormat{
+		MetaFormatLegacy,
+		MetaFormatVarint,
+		MetaFormatDictionary | MetaFormatOffsets,
+		MetaFormatDictionary | MetaFormatVarint | MetaFormatOffsets,
+	}
+
+	for _, format := range formats {
+		t.Run(format.String()+" from bytes", func(t *testing.T) {
+			meta := buildFormatTestMeta(t, 100)
+			meta.Format = format
+
+			b, err := meta.Serialize()
+			require.NoError(t, err)
+
+			a, err := NewMetaArenaFromBytes(meta.Subtree, b)
+			require.NoError(t, err)
+			assert.Equal(t, format, a.Format)
+
+			requireArenaEqual(t, meta, a)
+
+			b2, err := a.Serialize()
+			require.NoError(t, err)
+			assert.Equal(t, b, b2)
+
+			a, err = NewMetaArenaFromReader(meta.Subtree, bytes.NewBuffer(b))
+			require.NoError(t, err)
+
+			requireArenaEqual(t, meta, a)
+		})
+	}
+
+	t.Run("mmap", func(t *testing.T) {
+		meta := buildFormatTestMeta(t, 100)
+		meta.Format = MetaFormatDictionary | MetaFormatVarint
+
+		b, err := meta.Serialize()
+		require.NoError(t, err)
+
+		dir := t.TempDir()
+
+		a, err := NewMetaArenaFromReaderMmap(meta.Subtree, bytes.NewReader(b), dir)
+		require.NoError(t, err)
+		assert.True(t, a.IsMmapBacked())
+
+		requireArenaEqual(t, meta, a)
+
+		b2, err := a.Serialize()
+		require.NoError(t, err)
+		assert.Equal(t, b, b2)
+
+		require.ErrorIs(t, a.SetTxInpoints(1, meta.TxInpoints[1]), ErrMetaArenaReadOnly)
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+
+		require.NoError(t, a.Close())
+		require.NoError(t, a.Close())
+
+		entries, err = os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("set tx inpoints", func(t *testing.T) {
+		meta := buildFormatTestMeta(t, 8)
+		a := NewMetaArena(meta.Subtree)
+
+		for i := 1; i < 8; i++ {
+			require.NoError(t, a.SetTxInpoints(i, meta.TxInpoints[i]))
+		}
+
+		requireArenaEqual(t, meta, a)
+
+		require.ErrorIs(t, a.SetTxInpoints(-1, meta.TxInpoints[1]), ErrIndexOutOfRange)
+		require.ErrorIs(t, a.SetTxInpoints(8, meta.TxInpoints[1]), ErrIndexOutOfRange)
+		require.ErrorIs(t, a.SetTxInpoints(1, NewTxInpointsFromPacked(nil, []uint32{1})), ErrParentTxHashesMismatch)
+
+		_, err := a.TxInpoints(8)
+		require.ErrorIs(t, err, ErrIndexOutOfRange)
+
+		_, err = a.GetParentTxHashes(-1)
+		require.ErrorIs(t, err, ErrIndexOutOfRange)
+
+		_, err = a.GetTxInpoints(8)
+		require.ErrorIs(t, err, ErrIndexOutOfRange)
+
+		// views handed out before keep referring to the previous TxInpoints
+		before, err := a.TxInpoints(1)
+		require.NoError(t, err)
+
+		require.NoError(t, a.SetTxInpoints(1, meta.TxInpoints[2]))
+
+		after, err := a.TxInpoints(1)
+		require.NoError(t, err)
+		assert.Equal(t, meta.TxInpoints[1], before)
+		assert.Equal(t, meta.TxInpoints[2], after)
+	})
+
+	t.Run("appending to a view does not change the arena", func(t *testing.T) {
+		meta := buildFormatTestMeta(t, 8)
+
+		a, err := NewMetaArenaFromMeta(meta)
+		require.NoError(t, err)
+
+		p, err := a.TxInpoints(1)
+		require.NoError(t, err)
+
+		p.appendInput(chainhash.HashH([]byte("new parent")), 0)
+
+		requireArenaEqual(t, meta, a)
+	})
+
+	t.Run("invalid data", func(t *testing.T) {
+		meta := buildFormatTestMeta(t, 8)
+
+		b, err := meta.Serialize()
+		require.NoError(t, err)
+
+		other := buildFormatTestMeta(t, 7)
+
+		_, err = NewMetaArenaFromBytes(other.Subtree, b)
+		require.ErrorIs(t, err, ErrSubtreeRootMismatch)
+
+		_, err = NewMetaArenaFromBytes(meta.Subtree, b[:len(b)-1])
+		require.Error(t, err)
+
+		_, err = NewMetaArenaFromReaderMmap(meta.Subtree, bytes.NewReader(b[:len(b)-1]), t.TempDir())
+		require.Error(t, err)
+	})
+
+	t.Run("few allocations", func(t *testing.T) {
+		meta := buildFormatTestMeta(t, 1000)
+
+		b, err := meta.Serialize()
+		require.NoError(t, err)
+
+		allocs := testing.AllocsPerRun(5, func() {
+			_, _ = NewMetaArenaFromBytes(meta.Subtree, b)
+		})
+		assert.Less(t, allocs, float64(20))
+	})
+}
+
+// requireArenaEqual checks that the arena holds the same TxInpoints as the meta.
+func requireArenaEqual(t *testing.T, meta *Meta, a *MetaArena) {
+	t.Helper()
+
+	for i := range meta.TxInpoints {
+		p, err := a.TxInpoints(i)
+		require.NoError(t, err)
+		require.Equal(t, meta.TxInpoints[i], p, "index %d", i)
+
+		parents, err := a.GetParentTxHashes(i)
+		require.NoError(t, err)
+		require.Equal(t, meta.TxInpoints[i].ParentTxHashes, parents, "index %d", i)
+
+		inpoints, err := a.GetTxInpoints(i)
+		require.NoError(t, err)
+		require.Equal(t, meta.TxInpoints[i].GetTxInpoints(), inpoints, "index %d", i)
+	}
+}
+
+// BenchmarkMetaArenaDeserialize compares deserializing a meta into a MetaArena with
+// deserializing it into a Meta.
+func BenchmarkMetaArenaDeserialize(b *testing.B) {
+	meta := buildFormatBenchMeta(b, 8192, formatBenchDistributions[0].inpoints)
+
+	serialized, err := meta.Serialize()
+	require.NoError(b, err)
+
+	b.Run("Meta", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			if _, err := NewSubtreeMetaFromBytes(meta.Subtree, serialized); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("MetaArena", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			if _, err := NewMetaArenaFromBytes(meta.Subtree, serialized); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
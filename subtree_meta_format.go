@@ -0,0 +1,476 @@
+package subtree
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+	safe "github.com/bsv-blockchain/go-safe-conversion"
+)
+
+// metaFormatMarker is written in place of the node count of the legacy format, to
+// signal a meta file in one of the newer formats. A legacy file can never hold this
+// many nodes.
+const metaFormatMarker = math.MaxUint32
+
+// MetaFormat is a set of flags selecting the optional encodings of a serialized
+// subtree meta. The zero value is the legacy format, which every version of this
+// package can read.
+//
+// Meta files in any other format start with the root hash, followed by a marker in
+// place of the legacy node count and a byte holding the format flags.
+type MetaFormat uint8
+
+const (
+	// MetaFormatLegacy is the original format: every TxInpoints is serialized in full.
+	MetaFormatLegacy MetaFormat = 0
+	// MetaFormatDictionary stores the unique parent hashes in a table at the start of the
+	// file. Parents are referenced by their index in that table, or by their node index
+	// when the parent is itself in the subtree.
+	MetaFormatDictionary MetaFormat = 1 << 0
+	// MetaFormatVarint writes the parent counts, vout counts and vouts of every TxInpoints
+	// as unsigned varints instead of fixed 4-byte integers. Almost all vouts are below 128,
+	// so most of them take a single byte.
+	MetaFormatVarint MetaFormat = 1 << 1
+	// MetaFormatOffsets adds a table with the offset of every TxInpoints record, which
+	// allows a MetaReader to decode the record of a single node without reading the
+	// records before it.
+	MetaFormatOffsets MetaFormat = 1 << 2
+
+	// metaFormatKnown holds all flags known to this version of the package
+	metaFormatKnown = MetaFormatDictionary | MetaFormatVarint | MetaFormatOffsets
+)
+
+// String returns the names of the flags of the format, separated by a "+".
+func (f MetaFormat) String() string {
+	if f == MetaFormatLegacy {
+		return "legacy"
+	}
+
+	names := make([]string, 0, 3)
+
+	if f&MetaFormatDictionary != 0 {
+		names = append(names, "dictionary")
+	}
+
+	if f&MetaFormatVarint != 0 {
+		names = append(names, "varint")
+	}
+
+	if f&MetaFormatOffsets != 0 {
+		names = append(names, "offsets")
+	}
+
+	if unknown := f &^ metaFormatKnown; unknown != 0 {
+		names = append(names, fmt.Sprintf("unknown(%d)", uint8(unknown)))
+	}
+
+	return strings.Join(names, "+")
+}
+
+// metaCodec encodes and decodes the TxInpoints records of a meta file in a non-legacy format.
+type metaCodec struct {
+	format  MetaFormat
+	subtree *Subtree
+
+	// dictionary of the parent hashes that are not in the subtree
+	dictHashes []chainhash.Hash
+	dictIndex  map[chainhash.Hash]uint64
+
+	// nodeIndex maps the hashes of the subtree nodes to their index when writing,
+	// built from the nodes themselves so it always matches the current node order
+	nodeIndex map[chainhash.Hash]int
+
+	// rootMismatch is set when reading a meta stored for another subtree, parents
+	// referenced by their node index cannot be resolved against the subtree then
+	rootMismatch error
+
+	// scratch is used to encode and decode single fields without allocating, which
+	// makes a metaCodec unsafe for concurrent use
+	scratch [chainhash.HashSize]byte
+}
+
+// serializeFormatted serializes the TxInpoints of the Meta in the format of the meta
+// into the provided buffer, following the root hash.
+func (s *Meta) serializeFormatted(buf *bytes.Buffer) error {
+	if unknown := s.Format &^ metaFormatKnown; unknown != 0 {
+		return fmt.Errorf("%w: %s", ErrUnknownMetaFormat, s.Format)
+	}
+
+	length32, err := safe.IntToUint32(s.Subtree.Length())
+	if err != nil {
+		return fmt.Errorf("cannot serialize, unable to get safe uint32: %w", err)
+	}
+
+	codec := &metaCodec{format: s.Format, subtree: s.Subtree}
+
+	buf.Write(binary.LittleEndian.AppendUint32(codec.scratch[:0], metaFormatMarker))
+	buf.WriteByte(byte(s.Format))
+	buf.Write(binary.LittleEndian.AppendUint32(codec.scratch[:0], length32))
+
+	if s.Format&MetaFormatDictionary != 0 {
+		codec.buildDictionary(s.TxInpoints[:length32])
+		codec.writeDictionary(buf)
+	}
+
+	if s.Format&MetaFormatOffsets == 0 {
+		for i := range s.TxInpoints[:length32] {
+			if err = codec.writeTxInpoints(buf, &s.TxInpoints[i]); err != nil {
+				return fmt.Errorf("cannot serialize, unable to write tx inpoints %d: %w", i, err)
+			}
+		}
+
+		return nil
+	}
+
+	// the records are written to a separate buffer first, to know their offsets
+	records := &bytes.Buffer{}
+	offsets := make([]uint64, 0, length32+1)
+
+	for i := range s.TxInpoints[:length32] {
+		offsets = append(offsets, uint64(records.Len())) //nolint:gosec // G115: buffer lengths are never negative
+
+		if err = codec.writeTxInpoints(records, &s.TxInpoints[i]); err != nil {
+			return fmt.Errorf("cannot serialize, unable to write tx inpoints %d: %w", i, err)
+		}
+	}
+
+	offsets = append(offsets, uint64(records.Len())) //nolint:gosec // G115: buffer lengths are never negative
+
+	buf.Grow(len(offsets)*8 + records.Len())
+
+	for _, offset := range offsets {
+		buf.Write(binary.LittleEndian.AppendUint64(codec.scratch[:0], offset))
+	}
+
+	buf.Write(records.Bytes())
+
+	return nil
+}
+
+// deserializeFormatted reads the TxInpoints of a meta file in a non-legacy format, from
+// just after the format marker. rootMismatch is the error of the root hash check of a
+// meta read leniently, nil when the meta is for the subtree.
+func (s *Meta) deserializeFormatted(buf io.Reader, rootMismatch error) error {
+	records, err := openFormattedRecords(s.Subtree, buf)
+	if err != nil {
+		return err
+	}
+
+	records.codec.rootMismatch = rootMismatch
+
+	s.Format = records.codec.format
+	s.TxInpoints = make([]TxInpoints, s.Subtree.Size())
+
+	for i := uint32(0); i < records.count; i++ {
+		if err = records.codec.readTxInpoints(records.buf, records.br, &s.TxInpoints[i]); err != nil {
+			return fmt.Errorf("unable to deserialize parent outpoints %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// metaRecords is a serialized meta, positioned at its first TxInpoints record.
+type metaRecords struct {
+	codec *metaCodec
+	count uint32
+	buf   io.Reader
+	br    io.ByteReader
+}
+
+// openFormattedRecords reads the header of a meta file in a non-legacy format, from just
+// after the format marker up to the first TxInpoints record.
+func openFormattedRecords(subtree *Subtree, buf io.Reader) (*metaRecords, error) {
+	br, ok := buf.(io.ByteReader)
+	if !ok {
+		bufReader := bufio.NewReaderSize(buf, 32*1024) // 32KB buffer
+		buf, br = bufReader, bufReader
+	}
+
+	formatByte, err := br.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read meta format: %w", err)
+	}
+
+	format := MetaFormat(formatByte)
+	if unknown := format &^ metaFormatKnown; unknown != 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMetaFormat, format)
+	}
+
+	var bytesUint32 [4]byte
+
+	if _, err = io.ReadFull(buf, bytesUint32[:]); err != nil {
+		return nil, fmt.Errorf("unable to read number of parent tx hashes: %w", err)
+	}
+
+	count := binary.LittleEndian.Uint32(bytesUint32[:])
+	if uint64(count) > uint64(subtree.Size()) { //nolint:gosec // G115: size is never negative
+		return nil, fmt.Errorf("%w: meta has %d tx inpoints, subtree has room for %d", ErrSubtreeLengthMismatch, count, subtree.Size())
+	}
+
+	codec := &metaCodec{format: format, subtree: subtree}
+
+	if format&MetaFormatDictionary != 0 {
+		if err = codec.readDictionary(buf); err != nil {
+			return nil, err
+		}
+	}
+
+	if format&MetaFormatOffsets != 0 {
+		// the offset table is only needed for random access, see MetaReader
+		if _, err = io.CopyN(io.Discard, buf, (int64(count)+1)*8); err != nil {
+			return nil, fmt.Errorf("unable to read offset table: %w", err)
+		}
+	}
+
+	return &metaRecords{codec: codec, count: count, buf: buf, br: br}, nil
+}
+
+// buildDictionary collects the unique parent hashes that are not in the subtree, in
+// the order they are first referenced.
+func (c *metaCodec) buildDictionary(txInpoints []TxInpoints) {
+	c.dictIndex = make(map[chainhash.Hash]uint64)
+	c.nodeIndex = make(map[chainhash.Hash]int, len(c.subtree.Nodes))
+
+	for idx, node := range c.subtree.Nodes {
+		c.nodeIndex[node.Hash] = idx
+	}
+
+	for i := range txInpoints {
+		for _, hash := range txInpoints[i].ParentTxHashes {
+			if _, ok := c.dictIndex[hash]; ok {
+				continue
+			}
+
+			if _, ok := c.nodeIndex[hash]; ok {
+				continue
+			}
+
+			c.dictIndex[hash] = uint64(len(c.dictHashes))
+			c.dictHashes = append(c.dictHashes, hash)
+		}
+	}
+}
+
+// writeDictionary writes the number of hashes in the dictionary, followed by the hashes.
+func (c *metaCodec) writeDictionary(buf *bytes.Buffer) {
+	buf.Write(binary.LittleEndian.AppendUint32(c.scratch[:0], len32(c.dictHashes)))
+
+	for i := range c.dictHashes {
+		buf.Write(c.dictHashes[i][:])
+	}
+}
+
+// readDictionary reads the dictionary of parent hashes.
+func (c *metaCodec) readDictionary(buf io.Reader) error {
+	var bytesUint32 [4]byte
+
+	if _, err := io.ReadFull(buf, bytesUint32[:]); err != nil {
+		return fmt.Errorf("unable to read number of dictionary hashes: %w", err)
+	}
+
+	count := binary.LittleEndian.Uint32(bytesUint32[:])
+
+	// the count is not trusted, grow the dictionary while reading
+	c.dictHashes = make([]chainhash.Hash, 0, Min(count, 64*1024))
+
+	var hash chainhash.Hash
+
+	for i := uint32(0); i < count; i++ {
+		if _, err := io.ReadFull(buf, hash[:]); err != nil {
+			return fmt.Errorf("unable to read dictionary hash: %w", err)
+		}
+
+		c.dictHashes = append(c.dictHashes, hash)
+	}
+
+	return nil
+}
+
+// writeTxInpoints writes a single TxInpoints record: the number of parents, the parents
+// and the packed vout words.
+func (c *metaCodec) writeTxInpoints(buf *bytes.Buffer, p *TxInpoints) error {
+	parentCount := len(p.ParentTxHashes)
+	if (parentCount == 0 && len(p.voutIdxs) != 0) || (parentCount > 0 && len(p.voutIdxs) < parentCount) {
+		return ErrParentTxHashesMismatch
+	}
+
+	c.writeUint32(buf, len32(p.ParentTxHashes))
+
+	for _, hash := range p.ParentTxHashes {
+		c.writeParent(buf, hash)
+	}
+
+	for _, v := range p.voutIdxs {
+		c.writeUint32(buf, v)
+	}
+
+	return nil
+}
+
+// readTxInpoints reads a single TxInpoints record into p. Records without parents are
+// left as the zero value, the same as in the legacy format.
+func (c *metaCodec) readTxInpoints(buf io.Reader, br io.ByteReader, p *TxInpoints) error {
+	parents, err := c.appendParents(buf, br, nil)
+	if err != nil || len(parents) == 0 {
+		return err
+	}
+
+	voutIdxs, err := c.appendVouts(buf, br, make([]uint32, 0, len(parents)*2), len(parents))
+	if err != nil {
+		return err
+	}
+
+	*p = NewTxInpointsFromPacked(parents, voutIdxs)
+
+	return nil
+}
+
+// appendParents reads the number of parents and the parents at the start of a TxInpoints
+// record, and appends the parents to parents.
+func (c *metaCodec) appendParents(buf io.Reader, br io.ByteReader, parents []chainhash.Hash) ([]chainhash.Hash, error) {
+	var (
+		err         error
+		hash        chainhash.Hash
+		parentCount uint32
+	)
+
+	if parentCount, err = c.readUint32(buf, br); err != nil {
+		return parents, fmt.Errorf("unable to read number of parent inpoints: %w", err)
+	}
+
+	if parentCount == 0 {
+		return parents, nil
+	}
+
+	parents = slices.Grow(parents, int(Min(parentCount, 1024)))
+
+	for i := uint32(0); i < parentCount; i++ {
+		if hash, err = c.readParent(buf, br); err != nil {
+			return parents, err
+		}
+
+		parents = append(parents, hash)
+	}
+
+	return parents, nil
+}
+
+// appendVouts reads the packed vout words of parentCount parents of a TxInpoints record,
+// and appends them to voutIdxs.
+func (c *metaCodec) appendVouts(buf io.Reader, br io.ByteReader, voutIdxs []uint32, parentCount int) ([]uint32, error) {
+	var (
+		err   error
+		count uint32
+		vout  uint32
+	)
+
+	for range parentCount {
+		if count, err = c.readUint32(buf, br); err != nil {
+			return voutIdxs, fmt.Errorf("unable to read number of parent indexes: %w", err)
+		}
+
+		voutIdxs = append(voutIdxs, count)
+
+		for j := uint32(0); j < count; j++ {
+			if vout, err = c.readUint32(buf, br); err != nil {
+				return voutIdxs, fmt.Errorf("unable to read parent index: %w", err)
+			}
+
+			voutIdxs = append(voutIdxs, vout)
+		}
+	}
+
+	return voutIdxs, nil
+}
+
+// writeParent writes a parent hash, as a reference into the subtree or dictionary when
+// the dictionary is used. A reference is a varint holding the index shifted left by one,
+// with the lowest bit set for node indices in the subtree.
+func (c *metaCodec) writeParent(buf *bytes.Buffer, hash chainhash.Hash) {
+	if c.format&MetaFormatDictionary == 0 {
+		buf.Write(hash[:])
+		return
+	}
+
+	if idx, ok := c.nodeIndex[hash]; ok {
+		buf.Write(binary.AppendUvarint(c.scratch[:0], uint64(idx)<<1|1)) //nolint:gosec // G115: node indices are never negative
+		return
+	}
+
+	buf.Write(binary.AppendUvarint(c.scratch[:0], c.dictIndex[hash]<<1))
+}
+
+// readParent reads a parent hash written by writeParent.
+func (c *metaCodec) readParent(buf io.Reader, br io.ByteReader) (chainhash.Hash, error) {
+	var hash chainhash.Hash
+
+	if c.format&MetaFormatDictionary == 0 {
+		if _, err := io.ReadFull(buf, c.scratch[:]); err != nil {
+			return hash, fmt.Errorf("unable to read parent tx hash: %w", err)
+		}
+
+		return chainhash.Hash(c.scratch), nil
+	}
+
+	ref, err := binary.ReadUvarint(br)
+	if err != nil {
+		return hash, fmt.Errorf("unable to read parent tx reference: %w", err)
+	}
+
+	idx := ref >> 1
+
+	if ref&1 == 1 {
+		if c.rootMismatch != nil {
+			return hash, fmt.Errorf("unable to resolve parent node index %d: %w", idx, c.rootMismatch)
+		}
+
+		if idx >= uint64(c.subtree.Length()) { //nolint:gosec // G115: length is never negative
+			return hash, fmt.Errorf("%w: parent node index %d", ErrIndexOutOfRange, idx)
+		}
+
+		return c.subtree.Nodes[idx].Hash, nil
+	}
+
+	if idx >= uint64(len(c.dictHashes)) {
+		return hash, fmt.Errorf("%w: parent dictionary index %d", ErrIndexOutOfRange, idx)
+	}
+
+	return c.dictHashes[idx], nil
+}
+
+// writeUint32 writes an integer field of a TxInpoints record, as a varint when the
+// varint format is used.
+func (c *metaCodec) writeUint32(buf *bytes.Buffer, v uint32) {
+	if c.format&MetaFormatVarint != 0 {
+		buf.Write(binary.AppendUvarint(c.scratch[:0], uint64(v)))
+		return
+	}
+
+	buf.Write(binary.LittleEndian.AppendUint32(c.scratch[:0], v))
+}
+
+// readUint32 reads an integer field of a TxInpoints record written by writeUint32.
+func (c *metaCodec) readUint32(buf io.Reader, br io.ByteReader) (uint32, error) {
+	if c.format&MetaFormatVarint != 0 {
+		v, err := binary.ReadUvarint(br)
+		if err != nil {
+			return 0, err
+		}
+
+		return safe.Uint64ToUint32(v)
+	}
+
+	if _, err := io.ReadFull(buf, c.scratch[:4]); err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint32(c.scratch[:4]), nil
+}
@@ -0,0 +1,364 @@
+package subtree
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildFormatTestMeta creates a meta for a subtree with a coinbase placeholder and
+// count-1 transactions. Every transaction spends an output of the previous transaction
+// and every other transaction also spends two outputs of one of 16 external parents,
+// similar to the chains found in real blocks.
+func buildFormatTestMeta(t testing.TB, count int) *Meta {
+	st, err := NewTreeByLeafCount(CeilPowerOfTwo(count))
+	require.NoError(t, err)
+	require.NoError(t, st.AddCoinbaseNode())
+
+	for i := 1; i < count; i++ {
+		require.NoError(t, st.AddNode(chainhash.HashH([]byte{byte(i), byte(i >> 8), byte(i >> 16)}), 1, 1))
+	}
+
+	meta := NewSubtreeMeta(st)
+
+	for i := 1; i < count; i++ {
+		p := NewTxInpoints()
+
+		if i > 1 {
+			p.appendInput(st.Nodes[i-1].Hash, 0)
+		}
+
+		if i%2 == 1 || i == 1 {
+			external := chainhash.HashH([]byte{byte(i % 16), 'x'})
+			p.appendInput(external, uint32(i%5))   //nolint:gosec // G115: test data
+			p.appendInput(external, uint32(i%5)+1) //nolint:gosec // G115: test data
+		}
+
+		require.NoError(t, meta.SetTxInpoints(i, p))
+	}
+
+	return meta
+}
+
+func TestMetaFormatString(t *testing.T) {
+	assert.Equal(t, "legacy", MetaFormatLegacy.String())
+	assert.Equal(t, "dictionary", MetaFormatDictionary.String())
+	assert.Equal(t, "varint", MetaFormatVarint.String())
+	assert.Equal(t, "dictionary+varint", (MetaFormatDictionary | MetaFormatVarint).String())
+	assert.Equal(t, "dictionary+varint+offsets", (MetaFormatDictionary | MetaFormatVarint | MetaFormatOffsets).String())
+	assert.Equal(t, "dictionary+unknown(128)", (MetaFormatDictionary | 0x80).String())
+}
+
+func TestMetaFormat(t *testing.T) {
+	formats := []MetaFormat{MetaFormatLegacy, MetaFormatDictionary, MetaFormatVarint, MetaFormatDictionary | MetaFormatVarint}
+
+	for _, format := range formats {
+		t.Run(format.String()+" round trip", func(t *testing.T) {
+			meta := buildFormatTestMeta(t, 1000)
+			meta.Format = format
+
+			b, err := meta.Serialize()
+			require.NoError(t, err)
+
+			readMeta, err := NewSubtreeMetaFromBytes(meta.Subtree, b)
+			require.NoError(t, err)
+			assert.Equal(t, format, readMeta.Format)
+			assert.Equal(t, meta.TxInpoints, readMeta.TxInpoints)
+
+			// a reader that is not an io.ByteReader
+			readMeta, err = NewSubtreeMetaFromReader(meta.Subtree, io.MultiReader(bytes.NewReader(b)))
+			require.NoError(t, err)
+			assert.Equal(t, meta.TxInpoints, readMeta.TxInpoints)
+
+			// written back in the format it was read in
+			b2, err := readMeta.Serialize()
+			require.NoError(t, err)
+			assert.Equal(t, b, b2)
+
+			peeked, err := PeekMetaRootHash(bufio.NewReader(bytes.NewReader(b)))
+			require.NoError(t, err)
+			assert.Equal(t, meta.Subtree.RootHash(), peeked)
+		})
+	}
+
+	t.Run("dictionary is less than half the size", func(t *testing.T) {
+		meta := buildFormatTestMeta(t, 1000)
+
+		legacy, err := meta.Serialize()
+		require.NoError(t, err)
+
+		meta.Format = MetaFormatDictionary
+
+		dictionary, err := meta.Serialize()
+		require.NoError(t, err)
+
+		assert.Less(t, len(dictionary)*2, len(legacy))
+	})
+
+	t.Run("varint is smaller", func(t *testing.T) {
+		meta := buildFormatTestMeta(t, 1000)
+
+		legacy, err := meta.Serialize()
+		require.NoError(t, err)
+
+		meta.Format = MetaFormatVarint
+
+		varint, err := meta.Serialize()
+		require.NoError(t, err)
+
+		meta.Format = MetaFormatDictionary
+
+		dictionary, err := meta.Serialize()
+		require.NoError(t, err)
+
+		meta.Format = MetaFormatDictionary | MetaFormatVarint
+
+		both, err := meta.Serialize()
+		require.NoError(t, err)
+
+		assert.Less(t, len(varint), len(legacy))
+		assert.Less(t, len(both), len(dictionary))
+	})
+
+	t.Run("dictionary after removing a node", func(t *testing.T) {
+		meta := buildFormatTestMeta(t, 8)
+		meta.Format = MetaFormatDictionary | MetaFormatVarint
+
+		// populate the node index of the subtree before removing a node
+		require.Equal(t, 5, meta.Subtree.NodeIndex(meta.Subtree.Nodes[5].Hash))
+
+		require.NoError(t, meta.Subtree.RemoveNodeAtIndex(2))
+		meta.TxInpoints = append(meta.TxInpoints[:2], meta.TxInpoints[3:]...)
+
+		b, err := meta.Serialize()
+		require.NoError(t, err)
+
+		readMeta, err := NewSubtreeMetaFromBytes(meta.Subtree, b)
+		require.NoError(t, err)
+		assert.Equal(t, meta.TxInpoints[:meta.Subtree.Length()], readMeta.TxInpoints[:meta.Subtree.Length()])
+	})
+
+	t.Run("lenient loading against another subtree", func(t *testing.T) {
+		other, err := NewTreeByLeafCount(8)
+		require.NoError(t, err)
+		require.NoError(t, other.AddCoinbaseNode())
+
+		for i := 1; i < 8; i++ {
+			require.NoError(t, other.AddNode(chainhash.HashH([]byte{byte(i), 'o'}), 1, 1))
+		}
+
+		for _, format := range formats {
+			meta := buildFormatTestMeta(t, 8)
+			meta.Format = format
+
+			b, err := meta.Serialize()
+			require.NoError(t, err)
+
+			readMeta, err := NewSubtreeMetaFromBytesLenient(meta.Subtree, b)
+			require.NoError(t, err, format.String())
+			assert.Equal(t, meta.TxInpoints, readMeta.TxInpoints)
+
+			// the parents in the subtree cannot be resolved against the nodes of another subtree
+			_, err = NewSubtreeMetaFromBytesLenient(other, b)
+			_, readerErr := NewSubtreeMetaFromReaderLenient(other, bytes.NewReader(b))
+
+			if format&MetaFormatDictionary != 0 {
+				require.ErrorIs(t, err, ErrSubtreeRootMismatch, format.String())
+				require.ErrorIs(t, readerErr, ErrSubtreeRootMismatch, format.String())
+			} else {
+				require.NoError(t, err, format.String())
+				require.NoError(t, readerErr, format.String())
+			}
+		}
+	})
+
+	t.Run("merge and split keep the format", func(t *testing.T) {
+		meta := buildFormatTestMeta(t, 8)
+		meta.Format = MetaFormatDictionary
+
+		parts, err := SplitMeta(meta, 4)
+		require.NoError(t, err)
+		assert.Equal(t, MetaFormatDictionary, parts[1].Format)
+
+		merged, err := MergeMeta(parts[0], parts[1])
+		require.NoError(t, err)
+		assert.Equal(t, MetaFormatDictionary, merged.Format)
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		meta := buildFormatTestMeta(t, 8)
+		meta.Format = 0x80
+
+		_, err := meta.Serialize()
+		require.ErrorIs(t, err, ErrUnknownMetaFormat)
+
+		meta.Format = MetaFormatDictionary
+
+		b, err := meta.Serialize()
+		require.NoError(t, err)
+
+		b[36] |= 0x80
+
+		_, err = NewSubtreeMetaFromBytes(meta.Subtree, b)
+		require.ErrorIs(t, err, ErrUnknownMetaFormat)
+	})
+
+	t.Run("truncated data", func(t *testing.T) {
+		meta := buildFormatTestMeta(t, 8)
+		meta.Format = MetaFormatDictionary
+
+		b, err := meta.Serialize()
+		require.NoError(t, err)
+
+		for _, length := range []int{36, 37, 40, 44, 60, len(b) - 1} {
+			_, err = NewSubtreeMetaFromBytes(meta.Subtree, b[:length])
+			require.Error(t, err, "length %d", length)
+		}
+	})
+
+	t.Run("invalid references", func(t *testing.T) {
+		st, err := NewTreeByLeafCount(2)
+		require.NoError(t, err)
+		require.NoError(t, st.AddNode(chainhash.HashH([]byte("a")), 1, 1))
+
+		header := append([]byte{}, st.RootHash()[:]...)
+		header = binary.LittleEndian.AppendUint32(header, metaFormatMarker)
+		header = append(header, byte(MetaFormatDictionary))
+		header = binary.LittleEndian.AppendUint32(header, 1) // nodes
+		header = binary.LittleEndian.AppendUint32(header, 0) // dictionary hashes
+		header = binary.LittleEndian.AppendUint32(header, 1) // parents of node 0
+
+		// node index 5 is not in the subtree
+		_, err = NewSubtreeMetaFromBytes(st, binary.AppendUvarint(append([]byte{}, header...), 5<<1|1))
+		require.ErrorIs(t, err, ErrIndexOutOfRange)
+
+		// dictionary index 0 is not in the empty dictionary
+		_, err = NewSubtreeMetaFromBytes(st, binary.AppendUvarint(append([]byte{}, header...), 0))
+		require.ErrorIs(t, err, ErrIndexOutOfRange)
+	})
+
+	t.Run("too many nodes", func(t *testing.T) {
+		meta := buildFormatTestMeta(t, 8)
+		meta.Format = MetaFormatDictionary
+
+		b, err := meta.Serialize()
+		require.NoError(t, err)
+
+		binary.LittleEndian.PutUint32(b[37:41], 9)
+
+		_, err = NewSubtreeMetaFromBytes(meta.Subtree, b)
+		require.ErrorIs(t, err, ErrSubtreeLengthMismatch)
+	})
+}
+
+// formatBenchDistributions are input distributions for the meta format benchmarks.
+// Every function returns the inpoints of transaction i of the subtree.
+var formatBenchDistributions = []struct {
+	name     string
+	inpoints func(st *Subtree, i int) TxInpoints
+}{
+	{
+		// 1-2 inputs spending low outputs of external parents
+		name: "typical",
+		inpoints: func(_ *Subtree, i int) TxInpoints {
+			p := NewTxInpoints()
+			p.appendInput(chainhash.HashH([]byte{byte(i), byte(i >> 8), 'a'}), uint32(i%3)) //nolint:gosec // G115: test data
+
+			if i%3 == 0 {
+				p.appendInput(chainhash.HashH([]byte{byte(i), byte(i >> 8), 'b'}), 1)
+			}
+
+			return p
+		},
+	},
+	{
+		// a chain of transactions, every transaction spending the change of the previous one
+		name: "chained",
+		inpoints: func(st *Subtree, i int) TxInpoints {
+			p := NewTxInpoints()
+			p.appendInput(st.Nodes[i-1].Hash, 1)
+
+			return p
+		},
+	},
+	{
+		// consolidations spending many outputs of a few large fan-out transactions
+		name: "consolidation",
+		inpoints: func(_ *Subtree, i int) TxInpoints {
+			p := NewTxInpoints()
+
+			for j := 0; j < 20; j++ {
+				p.appendInput(chainhash.HashH([]byte{byte(j % 4), 'c'}), uint32(i*20+j)) //nolint:gosec // G115: test data
+			}
+
+			return p
+		},
+	},
+}
+
+func buildFormatBenchMeta(b *testing.B, count int, inpoints func(st *Subtree, i int) TxInpoints) *Meta {
+	st, err := NewTreeByLeafCount(CeilPowerOfTwo(count))
+	require.NoError(b, err)
+	require.NoError(b, st.AddCoinbaseNode())
+
+	for i := 1; i < count; i++ {
+		require.NoError(b, st.AddNode(chainhash.HashH([]byte{byte(i), byte(i >> 8), byte(i >> 16)}), 1, 1))
+	}
+
+	meta := NewSubtreeMeta(st)
+
+	for i := 1; i < count; i++ {
+		require.NoError(b, meta.SetTxInpoints(i, inpoints(st, i)))
+	}
+
+	return meta
+}
+
+// BenchmarkMetaFormat measures the serialized size and the speed of serializing and
+// deserializing a meta in every format, for several input distributions.
+func BenchmarkMetaFormat(b *testing.B) {
+	const count = 8192
+
+	formats := []MetaFormat{MetaFormatLegacy, MetaFormatVarint, MetaFormatDictionary, MetaFormatDictionary | MetaFormatVarint}
+
+	for _, distribution := range formatBenchDistributions {
+		meta := buildFormatBenchMeta(b, count, distribution.inpoints)
+
+		for _, format := range formats {
+			meta.Format = format
+
+			serialized, err := meta.Serialize()
+			require.NoError(b, err)
+
+			b.Run(distribution.name+"/"+format.String()+"/serialize", func(b *testing.B) {
+				meta.Format = format
+
+				b.ReportAllocs()
+				b.ReportMetric(float64(len(serialized))/count, "bytes/tx")
+
+				for i := 0; i < b.N; i++ {
+					if _, err := meta.Serialize(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+
+			b.Run(distribution.name+"/"+format.String()+"/deserialize", func(b *testing.B) {
+				b.ReportAllocs()
+				b.ReportMetric(float64(len(serialized))/count, "bytes/tx")
+
+				for i := 0; i < b.N; i++ {
+					if _, err := NewSubtreeMetaFromBytes(meta.Subtree, serialized); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
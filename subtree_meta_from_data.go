@@ -0,0 +1,340 @@
+package subtree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+
+	safe "github.com/bsv-blockchain/go-safe-conversion"
+)
+
+// NewSubtreeMetaFromData creates a new Meta object with the inpoints of all transactions
+// in the subtree data. The inpoints are derived concurrently for large subtrees. The
+// coinbase placeholder at index 0 gets empty inpoints, also when the data holds the
+// real coinbase transaction.
+//
+// Parameters:
+//   - data: The subtree data, holding all transactions of the subtree
+//
+// Returns:
+//   - *Meta: A new Meta object for the subtree of the data, ready to be serialized
+//   - error: An error if the data is not set, a transaction is missing or does not match the subtree
+func NewSubtreeMetaFromData(data *Data) (*Meta, error) {
+	if data == nil || data.Subtree == nil {
+		return nil, ErrSubtreeNil
+	}
+
+	s := NewSubtreeMeta(data.Subtree)
+	length := data.Subtree.Length()
+
+	var start int
+	if data.Subtree.HasCoinbasePlaceholder() {
+		start = 1
+	}
+
+	if len(data.Txs) < length {
+		return nil, fmt.Errorf("%w: subtree has %d nodes, data has %d transactions", ErrSubtreeLengthMismatch, length, len(data.Txs))
+	}
+
+	if length-start <= setOperationSplitSize {
+		if err := s.setTxInpointsFromData(data, start, length); err != nil {
+			return nil, err
+		}
+
+		return s, nil
+	}
+
+	chunks := splitRange(length - start)
+	errs := make([]error, len(chunks))
+
+	var wg sync.WaitGroup
+
+	for i, chunk := range chunks {
+		wg.Add(1)
+
+		go func(i, from, to int) {
+			defer wg.Done()
+
+			errs[i] = s.setTxInpointsFromData(data, from, to)
+		}(i, start+chunk[0], start+chunk[1])
+	}
+
+	wg.Wait()
+
+	// chunks are in index order, so the first error is the error of the lowest index
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// NewSubtreeMetaFromDataBytes creates a new Meta object with the inpoints of all
+// transactions in a serialized subtree data file. The inpoints are read straight from
+// the transaction bytes, see NewTxInpointsFromTxBytes, concurrently for large subtrees.
+// The result is identical to NewSubtreeMetaFromData for the parsed data.
+//
+// Parameters:
+//   - subtree: The subtree the data belongs to
+//   - dataBytes: The complete subtree data file
+//
+// Returns:
+//   - *Meta: A new Meta object for the subtree, ready to be serialized
+//   - error: An error if a transaction cannot be read, does not match the subtree, or
+//     the data does not hold all transactions
+func NewSubtreeMetaFromDataBytes(subtree *Subtree, dataBytes []byte) (*Meta, error) {
+	if subtree == nil || len(subtree.Nodes) == 0 {
+		return nil, ErrSubtreeNodesEmpty
+	}
+
+	spans, scanErr := scanTxSpans(subtree, dataBytes)
+
+	s := NewSubtreeMeta(subtree)
+	chunks := [][2]int{{0, len(spans)}}
+
+	if len(spans) > setOperationSplitSize {
+		chunks = splitRange(len(spans))
+	}
+
+	errs := make([]error, len(chunks))
+
+	var wg sync.WaitGroup
+
+	for i, chunk := range chunks {
+		wg.Add(1)
+
+		go func(i int, spans []txSpan) {
+			defer wg.Done()
+
+			errs[i] = s.setTxInpointsFromBytes(dataBytes, spans)
+		}(i, spans[chunk[0]:chunk[1]])
+	}
+
+	wg.Wait()
+
+	// chunks are in index order, so the first error is the error of the lowest index
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if scanErr != nil {
+		return nil, fmt.Errorf("error reading transaction: %w", scanErr)
+	}
+
+	next := 0
+	if subtree.HasCoinbasePlaceholder() {
+		next = 1
+	}
+
+	if len(spans) > 0 {
+		next = Max(next, spans[len(spans)-1].index+1)
+	}
+
+	if next != subtree.Length() {
+		return nil, fmt.Errorf("%w: subtree has %d nodes, data has %d transactions", ErrSubtreeLengthMismatch, subtree.Length(), next)
+	}
+
+	return s, nil
+}
+
+// NewSubtreeMetaFromDataReader creates a new Meta object with the inpoints of all
+// transactions in a subtree data stream. Like WriteSubtreeMetaFromData, the inpoints are
+// read straight from the transaction bytes and only one transaction is held in memory at
+// a time.
+//
+// Parameters:
+//   - subtree: The subtree the data belongs to
+//   - dataReader: The reader with the serialized transactions of the subtree
+//
+// Returns:
+//   - *Meta: A new Meta object for the subtree, ready to be serialized
+//   - error: An error if a transaction cannot be read, does not match the subtree, or
+//     the data does not hold all transactions
+func NewSubtreeMetaFromDataReader(subtree *Subtree, dataReader io.Reader) (*Meta, error) {
+	reader, err := NewDataReader(subtree, dataReader)
+	if err != nil {
+		return nil, err
+	}
+
+	s := NewSubtreeMeta(subtree)
+	next := 0
+
+	if subtree.HasCoinbasePlaceholder() {
+		next = 1
+	}
+
+	for {
+		idx, txInpoints, err := reader.nextTxInpoints()
+		if err != nil {
+			break
+		}
+
+		if idx == 0 && next == 1 {
+			// the real coinbase tx in place of the placeholder, which has no inpoints
+			continue
+		}
+
+		s.TxInpoints[idx] = txInpoints
+		next = idx + 1
+	}
+
+	if err = reader.Err(); err != nil {
+		return nil, fmt.Errorf("error reading transaction: %w", err)
+	}
+
+	if next != subtree.Length() {
+		return nil, fmt.Errorf("%w: subtree has %d nodes, data has %d transactions", ErrSubtreeLengthMismatch, subtree.Length(), next)
+	}
+
+	return s, nil
+}
+
+// WriteSubtreeMetaFromData reads a subtree data stream and writes the matching subtree
+// meta to w, in the same format as Meta.Serialize. Only one transaction is held in
+// memory at a time, which makes it suitable to regenerate the meta of large subtrees
+// straight from a data file. The inpoints are read straight from the transaction bytes,
+// without parsing the transactions.
+//
+// Parameters:
+//   - w: The writer to write the subtree meta to
+//   - subtree: The subtree the data belongs to
+//   - dataReader: The reader with the serialized transactions of the subtree
+//
+// Returns:
+//   - error: An error if reading a transaction fails, a transaction does not match the
+//     subtree, the data does not hold all transactions or writing fails
+func WriteSubtreeMetaFromData(w io.Writer, subtree *Subtree, dataReader io.Reader) error {
+	reader, err := NewDataReader(subtree, dataReader)
+	if err != nil {
+		return err
+	}
+
+	length := subtree.Length()
+
+	length32, err := safe.IntToUint32(length)
+	if err != nil {
+		return fmt.Errorf("cannot serialize, unable to get safe uint32: %w", err)
+	}
+
+	buf := bufio.NewWriterSize(w, 32*1024) // 32KB buffer
+
+	// write root hash
+	if _, err = buf.Write(subtree.RootHash()[:]); err != nil {
+		return fmt.Errorf("cannot serialize, unable to write root hash: %w", err)
+	}
+
+	var bytesUint32 [4]byte
+
+	// write number of parent tx hashes
+	binary.LittleEndian.PutUint32(bytesUint32[:], length32)
+
+	if _, err = buf.Write(bytesUint32[:]); err != nil {
+		return fmt.Errorf("cannot serialize, unable to write total number of nodes: %w", err)
+	}
+
+	next := 0
+
+	if subtree.HasCoinbasePlaceholder() {
+		// the coinbase placeholder has no inpoints, write an empty record
+		binary.LittleEndian.PutUint32(bytesUint32[:], 0)
+
+		if _, err = buf.Write(bytesUint32[:]); err != nil {
+			return fmt.Errorf("cannot serialize, unable to write parent tx hash: %w", err)
+		}
+
+		next = 1
+	}
+
+	var (
+		idx            int
+		txInpoints     TxInpoints
+		txInPointBytes []byte
+	)
+
+	for {
+		if idx, txInpoints, err = reader.nextTxInpoints(); err != nil {
+			break
+		}
+
+		if idx == 0 && next == 1 {
+			// the real coinbase tx in place of the placeholder, already written
+			continue
+		}
+
+		if txInPointBytes, err = txInpoints.Serialize(); err != nil {
+			return fmt.Errorf("cannot serialize, unable to write parent tx hash: %w", err)
+		}
+
+		if _, err = buf.Write(txInPointBytes); err != nil {
+			return fmt.Errorf("cannot serialize, unable to write parent tx hash: %w", err)
+		}
+
+		next = idx + 1
+	}
+
+	if err = reader.Err(); err != nil {
+		return fmt.Errorf("error reading transaction: %w", err)
+	}
+
+	if next != length {
+		return fmt.Errorf("%w: subtree has %d nodes, data has %d transactions", ErrSubtreeLengthMismatch, length, next)
+	}
+
+	return buf.Flush()
+}
+
+// setTxInpointsFromBytes sets the inpoints of the transactions in the spans of the data
+// file. Every call writes the TxInpoints of its own spans, so spans can be set concurrently.
+func (s *Meta) setTxInpointsFromBytes(dataBytes []byte, spans []txSpan) error {
+	coinbase := s.Subtree.HasCoinbasePlaceholder()
+
+	for _, span := range spans {
+		tx, err := scanTx(dataBytes[span.start:span.end], true)
+		if err != nil {
+			return fmt.Errorf("%w at index %d: %w", ErrTransactionRead, span.index, err)
+		}
+
+		if span.index == 0 && coinbase && tx.coinbase {
+			// the real coinbase tx in place of the placeholder, which has no inpoints
+			continue
+		}
+
+		if !s.Subtree.Nodes[span.index].Hash.Equal(tx.txid) {
+			return fmt.Errorf("%w at index %d", ErrTxHashMismatch, span.index)
+		}
+
+		s.TxInpoints[span.index] = tx.inpoints
+	}
+
+	return nil
+}
+
+// setTxInpointsFromData sets the inpoints of the transactions in [from, to) of the data.
+// Every call writes its own range of the TxInpoints slice, so ranges can be set concurrently.
+func (s *Meta) setTxInpointsFromData(data *Data, from, to int) error {
+	for i := from; i < to; i++ {
+		tx := data.Txs[i]
+		if tx == nil {
+			return fmt.Errorf("%w at index %d", ErrTransactionNil, i)
+		}
+
+		if !data.Subtree.Nodes[i].Hash.Equal(*tx.TxIDChainHash()) {
+			return fmt.Errorf("%w at index %d", ErrTxHashMismatch, i)
+		}
+
+		txInpoints, err := NewTxInpointsFromTx(tx)
+		if err != nil {
+			return fmt.Errorf("unable to create inpoints at index %d: %w", i, err)
+		}
+
+		s.TxInpoints[i] = txInpoints
+	}
+
+	return nil
+}
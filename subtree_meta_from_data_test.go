@@ -0,0 +1,331 @@
+package subtree
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/bsv-blockchain/go-bt/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errShortWrite = errors.New("short write")
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errShortWrite
+}
+
+func TestNewSubtreeMetaFromData(t *testing.T) {
+	t.Run("matches meta built per transaction", func(t *testing.T) {
+		txs, subtree, expectedMeta := initMeta(t)
+
+		data := NewSubtreeData(subtree)
+		for i, tx := range txs {
+			require.NoError(t, data.AddTx(tx, i))
+		}
+
+		meta, err := NewSubtreeMetaFromData(data)
+		require.NoError(t, err)
+		assert.Equal(t, expectedMeta.TxInpoints, meta.TxInpoints)
+
+		b, err := meta.Serialize()
+		require.NoError(t, err)
+
+		expectedBytes, err := expectedMeta.Serialize()
+		require.NoError(t, err)
+		assert.Equal(t, expectedBytes, b)
+	})
+
+	t.Run("coinbase placeholder", func(t *testing.T) {
+		subtree, data, txs := setupCoinbaseTestSubtreeData(t)
+
+		meta, err := NewSubtreeMetaFromData(data)
+		require.NoError(t, err)
+		assert.Nil(t, meta.TxInpoints[0].ParentTxHashes)
+
+		for i, tx := range txs {
+			expected, err := NewTxInpointsFromTx(tx)
+			require.NoError(t, err)
+			assert.Equal(t, expected, meta.TxInpoints[i+1])
+		}
+
+		// the real coinbase tx in the data does not result in inpoints
+		require.NoError(t, data.AddTx(coinbaseTx, 0))
+
+		meta, err = NewSubtreeMetaFromData(data)
+		require.NoError(t, err)
+		assert.Nil(t, meta.TxInpoints[0].ParentTxHashes)
+
+		_, err = meta.Serialize()
+		require.NoError(t, err)
+		assert.Equal(t, subtree, meta.Subtree)
+	})
+
+	t.Run("missing transaction", func(t *testing.T) {
+		_, data, _ := setupTestSubtreeData(t)
+		data.Txs[2] = nil
+
+		_, err := NewSubtreeMetaFromData(data)
+		require.ErrorIs(t, err, ErrTransactionNil)
+		assert.Contains(t, err.Error(), "at index 2")
+	})
+
+	t.Run("transaction mismatch", func(t *testing.T) {
+		_, data, txs := setupTestSubtreeData(t)
+		data.Txs[1] = txs[3]
+
+		_, err := NewSubtreeMetaFromData(data)
+		require.ErrorIs(t, err, ErrTxHashMismatch)
+	})
+
+	t.Run("nil data", func(t *testing.T) {
+		_, err := NewSubtreeMetaFromData(nil)
+		require.ErrorIs(t, err, ErrSubtreeNil)
+	})
+
+	t.Run("large subtree", func(t *testing.T) {
+		subtree, dataBytes := buildLargeTestData(t, setOperationSplitSize+10)
+
+		data, err := NewSubtreeDataFromBytes(subtree, dataBytes)
+		require.NoError(t, err)
+
+		meta, err := NewSubtreeMetaFromData(data)
+		require.NoError(t, err)
+
+		discrepancies, err := ValidateDataAgainstMeta(data, meta)
+		require.NoError(t, err)
+		assert.Empty(t, discrepancies)
+
+		// the error of the lowest index is returned
+		data.Txs[setOperationSplitSize+5] = nil
+		data.Txs[7] = nil
+
+		_, err = NewSubtreeMetaFromData(data)
+		require.ErrorIs(t, err, ErrTransactionNil)
+		assert.Contains(t, err.Error(), "at index 7")
+	})
+}
+
+func TestNewSubtreeMetaFromDataBytes(t *testing.T) {
+	t.Run("matches meta from parsed data", func(t *testing.T) {
+		subtree, data, _ := setupTestSubtreeData(t)
+
+		dataBytes, err := data.Serialize()
+		require.NoError(t, err)
+
+		expected, err := NewSubtreeMetaFromData(data)
+		require.NoError(t, err)
+
+		meta, err := NewSubtreeMetaFromDataBytes(subtree, dataBytes)
+		require.NoError(t, err)
+		assert.Equal(t, expected.TxInpoints, meta.TxInpoints)
+
+		meta, err = NewSubtreeMetaFromDataReader(subtree, bytes.NewReader(dataBytes))
+		require.NoError(t, err)
+		assert.Equal(t, expected.TxInpoints, meta.TxInpoints)
+	})
+
+	t.Run("coinbase placeholder", func(t *testing.T) {
+		subtree, data, _ := setupCoinbaseTestSubtreeData(t)
+
+		expected, err := NewSubtreeMetaFromData(data)
+		require.NoError(t, err)
+
+		dataBytes, err := data.Serialize()
+		require.NoError(t, err)
+
+		for _, b := range [][]byte{
+			dataBytes,
+			append(coinbaseTx.Bytes(), dataBytes...),
+			append(sequenceCoinbaseTx.Bytes(), dataBytes...),
+		} {
+			meta, err := NewSubtreeMetaFromDataBytes(subtree, b)
+			require.NoError(t, err)
+			assert.Equal(t, expected.TxInpoints, meta.TxInpoints)
+
+			meta, err = NewSubtreeMetaFromDataReader(subtree, bytes.NewReader(b))
+			require.NoError(t, err)
+			assert.Equal(t, expected.TxInpoints, meta.TxInpoints)
+		}
+	})
+
+	t.Run("large subtree", func(t *testing.T) {
+		subtree, dataBytes := buildLargeTestData(t, setOperationSplitSize+10)
+
+		data, err := NewSubtreeDataFromBytes(subtree, dataBytes)
+		require.NoError(t, err)
+
+		expected, err := NewSubtreeMetaFromData(data)
+		require.NoError(t, err)
+
+		meta, err := NewSubtreeMetaFromDataBytes(subtree, dataBytes)
+		require.NoError(t, err)
+		assert.Equal(t, expected.TxInpoints, meta.TxInpoints)
+	})
+
+	t.Run("transaction mismatch", func(t *testing.T) {
+		subtree, data, txs := setupTestSubtreeData(t)
+		data.Txs[1] = txs[3]
+
+		dataBytes, err := data.Serialize()
+		require.NoError(t, err)
+
+		_, err = NewSubtreeMetaFromDataBytes(subtree, dataBytes)
+		require.ErrorIs(t, err, ErrTxHashMismatch)
+		assert.Contains(t, err.Error(), "at index 1")
+
+		_, err = NewSubtreeMetaFromDataReader(subtree, bytes.NewReader(dataBytes))
+		require.ErrorIs(t, err, ErrTxHashMismatch)
+		assert.Contains(t, err.Error(), "at index 1")
+	})
+
+	t.Run("truncated data", func(t *testing.T) {
+		subtree, data, _ := setupTestSubtreeData(t)
+
+		buf := &bytes.Buffer{}
+		require.NoError(t, data.WriteTransactionsToWriter(buf, 0, 3))
+
+		_, err := NewSubtreeMetaFromDataBytes(subtree, buf.Bytes())
+		require.ErrorIs(t, err, ErrSubtreeLengthMismatch)
+
+		_, err = NewSubtreeMetaFromDataReader(subtree, bytes.NewReader(buf.Bytes()))
+		require.ErrorIs(t, err, ErrSubtreeLengthMismatch)
+	})
+
+	t.Run("corrupt data", func(t *testing.T) {
+		subtree, data, _ := setupTestSubtreeData(t)
+
+		dataBytes, err := data.Serialize()
+		require.NoError(t, err)
+
+		_, err = NewSubtreeMetaFromDataBytes(subtree, dataBytes[:len(dataBytes)-3])
+		require.ErrorIs(t, err, ErrTransactionRead)
+
+		_, err = NewSubtreeMetaFromDataReader(subtree, bytes.NewReader(dataBytes[:len(dataBytes)-3]))
+		require.ErrorIs(t, err, ErrTransactionRead)
+	})
+
+	t.Run("empty subtree", func(t *testing.T) {
+		subtree, err := NewTree(2)
+		require.NoError(t, err)
+
+		_, err = NewSubtreeMetaFromDataBytes(subtree, nil)
+		require.ErrorIs(t, err, ErrSubtreeNodesEmpty)
+
+		_, err = NewSubtreeMetaFromDataReader(subtree, bytes.NewReader(nil))
+		require.ErrorIs(t, err, ErrSubtreeNodesEmpty)
+	})
+}
+
+func TestWriteSubtreeMetaFromData(t *testing.T) {
+	t.Run("matches serialized meta", func(t *testing.T) {
+		subtree, data, _ := setupTestSubtreeData(t)
+
+		dataBytes, err := data.Serialize()
+		require.NoError(t, err)
+
+		meta, err := NewSubtreeMetaFromData(data)
+		require.NoError(t, err)
+
+		expected, err := meta.Serialize()
+		require.NoError(t, err)
+
+		buf := &bytes.Buffer{}
+		require.NoError(t, WriteSubtreeMetaFromData(buf, subtree, bytes.NewReader(dataBytes)))
+		assert.Equal(t, expected, buf.Bytes())
+
+		readMeta, err := NewSubtreeMetaFromBytes(subtree, buf.Bytes())
+		require.NoError(t, err)
+		assert.Equal(t, meta.TxInpoints, readMeta.TxInpoints)
+	})
+
+	t.Run("coinbase placeholder", func(t *testing.T) {
+		subtree, data, _ := setupCoinbaseTestSubtreeData(t)
+
+		meta, err := NewSubtreeMetaFromData(data)
+		require.NoError(t, err)
+
+		expected, err := meta.Serialize()
+		require.NoError(t, err)
+
+		dataBytes, err := data.Serialize()
+		require.NoError(t, err)
+
+		buf := &bytes.Buffer{}
+		require.NoError(t, WriteSubtreeMetaFromData(buf, subtree, bytes.NewReader(dataBytes)))
+		assert.Equal(t, expected, buf.Bytes())
+
+		// with the real coinbase tx written in place of the placeholder
+		for _, cb := range []*bt.Tx{coinbaseTx, sequenceCoinbaseTx} {
+			buf.Reset()
+			require.NoError(t, WriteSubtreeMetaFromData(buf, subtree, bytes.NewReader(append(cb.Bytes(), dataBytes...))))
+			assert.Equal(t, expected, buf.Bytes())
+		}
+	})
+
+	t.Run("truncated data", func(t *testing.T) {
+		subtree, data, _ := setupTestSubtreeData(t)
+
+		buf := &bytes.Buffer{}
+		require.NoError(t, data.WriteTransactionsToWriter(buf, 0, 3))
+
+		err := WriteSubtreeMetaFromData(&bytes.Buffer{}, subtree, buf)
+		require.ErrorIs(t, err, ErrSubtreeLengthMismatch)
+	})
+
+	t.Run("corrupt data", func(t *testing.T) {
+		subtree, data, _ := setupTestSubtreeData(t)
+
+		dataBytes, err := data.Serialize()
+		require.NoError(t, err)
+
+		err = WriteSubtreeMetaFromData(&bytes.Buffer{}, subtree, bytes.NewReader(dataBytes[:len(dataBytes)-3]))
+		require.ErrorIs(t, err, ErrTransactionRead)
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		subtree, data, _ := setupTestSubtreeData(t)
+
+		dataBytes, err := data.Serialize()
+		require.NoError(t, err)
+
+		err = WriteSubtreeMetaFromData(failingWriter{}, subtree, bytes.NewReader(dataBytes))
+		require.ErrorIs(t, err, errShortWrite)
+	})
+
+	t.Run("empty subtree", func(t *testing.T) {
+		subtree, err := NewTree(2)
+		require.NoError(t, err)
+
+		err = WriteSubtreeMetaFromData(&bytes.Buffer{}, subtree, bytes.NewReader(nil))
+		require.ErrorIs(t, err, ErrSubtreeNodesEmpty)
+	})
+}
+
+func BenchmarkNewSubtreeMetaFromDataBytes(b *testing.B) {
+	subtree, dataBytes := buildLargeTestData(b, 4096)
+
+	b.Run("parsed", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for b.Loop() {
+			data, err := NewSubtreeDataFromBytes(subtree, dataBytes)
+			require.NoError(b, err)
+
+			_, err = NewSubtreeMetaFromData(data)
+			require.NoError(b, err)
+		}
+	})
+
+	b.Run("raw bytes", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for b.Loop() {
+			_, err := NewSubtreeMetaFromDataBytes(subtree, dataBytes)
+			require.NoError(b, err)
+		}
+	})
+}
@@ -0,0 +1,198 @@
+package subtree
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+)
+
+// metaFormattedHeaderSize is the size of the header of a meta file in a non-legacy
+// format: the root hash, the format marker, the format flags and the node count.
+const metaFormattedHeaderSize = 32 + 4 + 1 + 4
+
+// maxMetaRecordSize is the largest TxInpoints record a MetaReader reads when the size of
+// the meta file is not known. A record is always smaller than its transaction, every
+// input takes at least 41 bytes in the transaction and at most 40 bytes in the record.
+const maxMetaRecordSize = 256 * 1024 * 1024
+
+// MetaReader reads the TxInpoints of single nodes from a stored subtree meta file,
+// without decoding the records of the other nodes. The meta must have been written
+// with the MetaFormatOffsets flag. Only the header, and the dictionary of parent
+// hashes when the format has one, are read when the reader is created.
+//
+// A MetaReader is safe for concurrent use when the underlying io.ReaderAt is.
+type MetaReader struct {
+	subtree *Subtree
+	reader  io.ReaderAt
+	codec   *metaCodec
+	count   int
+
+	// size is the size of the meta file, -1 when the reader does not report it
+	size int64
+
+	// tableStart is the file offset of the offset table, recordsStart the file offset
+	// the offsets in the table are relative to
+	tableStart   int64
+	recordsStart int64
+}
+
+// NewMetaReader creates a new MetaReader for the meta file in reader. When the reader
+// has a Size method, like bytes.Reader and io.SectionReader, no record is read beyond
+// that size, otherwise records are limited to 256 MiB.
+//
+// Parameters:
+//   - subtree: The subtree the meta file belongs to
+//   - reader: The meta file
+//
+// Returns:
+//   - *MetaReader: A new MetaReader
+//   - error: ErrMetaNoOffsetTable if the meta has no offset table, a *RootHashMismatchError
+//     if the meta is for another subtree, or an error if the header cannot be read
+func NewMetaReader(subtree *Subtree, reader io.ReaderAt) (*MetaReader, error) {
+	if subtree == nil || len(subtree.Nodes) == 0 {
+		return nil, ErrSubtreeNodesEmpty
+	}
+
+	var header [metaFormattedHeaderSize]byte
+
+	if err := readFullAt(reader, header[:], 0); err != nil {
+		return nil, fmt.Errorf("unable to read meta header: %w", err)
+	}
+
+	if err := checkMetaRootHash(subtree, chainhash.Hash(header[:32])); err != nil {
+		return nil, err
+	}
+
+	if binary.LittleEndian.Uint32(header[32:36]) != metaFormatMarker {
+		return nil, fmt.Errorf("%w: format %s", ErrMetaNoOffsetTable, MetaFormatLegacy)
+	}
+
+	format := MetaFormat(header[36])
+	if unknown := format &^ metaFormatKnown; unknown != 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMetaFormat, format)
+	}
+
+	if format&MetaFormatOffsets == 0 {
+		return nil, fmt.Errorf("%w: format %s", ErrMetaNoOffsetTable, format)
+	}
+
+	count := binary.LittleEndian.Uint32(header[37:41])
+	if uint64(count) > uint64(subtree.Size()) { //nolint:gosec // G115: size is never negative
+		return nil, fmt.Errorf("%w: meta has %d tx inpoints, subtree has room for %d", ErrSubtreeLengthMismatch, count, subtree.Size())
+	}
+
+	r := &MetaReader{
+		subtree:    subtree,
+		reader:     reader,
+		codec:      &metaCodec{format: format, subtree: subtree},
+		count:      int(count),
+		size:       -1,
+		tableStart: metaFormattedHeaderSize,
+	}
+
+	if sizer, ok := reader.(interface{ Size() int64 }); ok {
+		r.size = sizer.Size()
+	}
+
+	if format&MetaFormatDictionary != 0 {
+		if err := r.codec.readDictionary(bufio.NewReader(io.NewSectionReader(reader, metaFormattedHeaderSize, math.MaxInt64-metaFormattedHeaderSize))); err != nil {
+			return nil, err
+		}
+
+		r.tableStart += 4 + int64(len(r.codec.dictHashes))*chainhash.HashSize
+	}
+
+	r.recordsStart = r.tableStart + (int64(count)+1)*8
+
+	return r, nil
+}
+
+// Len returns the number of nodes with a TxInpoints record in the meta file.
+func (r *MetaReader) Len() int {
+	return r.count
+}
+
+// Format returns the format of the meta file.
+func (r *MetaReader) Format() MetaFormat {
+	return r.codec.format
+}
+
+// TxInpointsAt reads and decodes the TxInpoints of the node at index idx.
+func (r *MetaReader) TxInpointsAt(idx int) (TxInpoints, error) {
+	var p TxInpoints
+
+	record, err := r.record(idx)
+	if err != nil {
+		return p, err
+	}
+
+	// the codec is copied, so lookups can run concurrently
+	codec := *r.codec
+	br := bytes.NewReader(record)
+
+	if err = codec.readTxInpoints(br, br, &p); err != nil {
+		return p, fmt.Errorf("unable to deserialize parent outpoints %d: %w", idx, err)
+	}
+
+	return p, nil
+}
+
+// ParentTxHashesAt reads the parent transaction hashes of the node at index idx. Only the
+// parents are decoded, the vouts of the record are skipped.
+func (r *MetaReader) ParentTxHashesAt(idx int) ([]chainhash.Hash, error) {
+	record, err := r.record(idx)
+	if err != nil {
+		return nil, err
+	}
+
+	codec := *r.codec
+	br := bytes.NewReader(record)
+
+	parents, err := codec.appendParents(br, br, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to deserialize parent outpoints %d: %w", idx, err)
+	}
+
+	return parents, nil
+}
+
+// record reads the raw TxInpoints record of the node at index idx, using the offset table.
+func (r *MetaReader) record(idx int) ([]byte, error) {
+	if idx < 0 || idx >= r.count {
+		return nil, ErrIndexOutOfRange
+	}
+
+	var entries [16]byte
+
+	if err := readFullAt(r.reader, entries[:], r.tableStart+int64(idx)*8); err != nil {
+		return nil, fmt.Errorf("unable to read offset table entry %d: %w", idx, err)
+	}
+
+	start := binary.LittleEndian.Uint64(entries[0:8])
+	end := binary.LittleEndian.Uint64(entries[8:16])
+
+	if end < start || end > math.MaxInt64-uint64(r.recordsStart) { //nolint:gosec // G115: recordsStart is never negative
+		return nil, fmt.Errorf("%w: invalid offset table entry %d", ErrIndexOutOfRange, idx)
+	}
+
+	if r.size >= 0 {
+		if r.recordsStart+int64(end) > r.size { //nolint:gosec // G115: checked above
+			return nil, fmt.Errorf("%w: offset table entry %d is beyond the end of the meta", ErrIndexOutOfRange, idx)
+		}
+	} else if end-start > maxMetaRecordSize {
+		return nil, fmt.Errorf("%w: offset table entry %d has a record of %d bytes", ErrIndexOutOfRange, idx, end-start)
+	}
+
+	record := make([]byte, end-start)
+
+	if err := readFullAt(r.reader, record, r.recordsStart+int64(start)); err != nil { //nolint:gosec // G115: checked above
+		return nil, fmt.Errorf("unable to read tx inpoints %d: %w", idx, err)
+	}
+
+	return record, nil
+}
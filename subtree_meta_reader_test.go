@@ -0,0 +1,223 @@
+package subtree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetaReader(t *testing.T) {
+	formats := []MetaFormat{
+		MetaFormatOffsets,
+		MetaFormatOffsets | MetaFormatVarint,
+		MetaFormatOffsets | MetaFormatDictionary,
+		MetaFormatOffsets | MetaFormatDictionary | MetaFormatVarint,
+	}
+
+	for _, format := range formats {
+		t.Run(format.String(), func(t *testing.T) {
+			meta := buildFormatTestMeta(t, 100)
+			meta.Format = format
+
+			b, err := meta.Serialize()
+			require.NoError(t, err)
+
+			r, err := NewMetaReader(meta.Subtree, bytes.NewReader(b))
+			require.NoError(t, err)
+			assert.Equal(t, 100, r.Len())
+			assert.Equal(t, format, r.Format())
+
+			for i := 0; i < r.Len(); i++ {
+				p, err := r.TxInpointsAt(i)
+				require.NoError(t, err)
+				assert.Equal(t, meta.TxInpoints[i], p, "index %d", i)
+
+				parents, err := r.ParentTxHashesAt(i)
+				require.NoError(t, err)
+				assert.Equal(t, meta.TxInpoints[i].ParentTxHashes, parents, "index %d", i)
+			}
+
+			_, err = r.TxInpointsAt(-1)
+			require.ErrorIs(t, err, ErrIndexOutOfRange)
+
+			_, err = r.ParentTxHashesAt(r.Len())
+			require.ErrorIs(t, err, ErrIndexOutOfRange)
+
+			// the sequential reader skips the offset table
+			readMeta, err := NewSubtreeMetaFromBytes(meta.Subtree, b)
+			require.NoError(t, err)
+			assert.Equal(t, meta.TxInpoints, readMeta.TxInpoints)
+			assert.Equal(t, format, readMeta.Format)
+		})
+	}
+
+	t.Run("no offset table", func(t *testing.T) {
+		meta := buildFormatTestMeta(t, 8)
+
+		for _, format := range []MetaFormat{MetaFormatLegacy, MetaFormatDictionary} {
+			meta.Format = format
+
+			b, err := meta.Serialize()
+			require.NoError(t, err)
+
+			_, err = NewMetaReader(meta.Subtree, bytes.NewReader(b))
+			require.ErrorIs(t, err, ErrMetaNoOffsetTable)
+		}
+	})
+
+	t.Run("other subtree", func(t *testing.T) {
+		meta := buildFormatTestMeta(t, 8)
+		meta.Format = MetaFormatOffsets
+
+		b, err := meta.Serialize()
+		require.NoError(t, err)
+
+		other := buildFormatTestMeta(t, 7)
+
+		_, err = NewMetaReader(other.Subtree, bytes.NewReader(b))
+		require.ErrorIs(t, err, ErrSubtreeRootMismatch)
+
+		_, err = NewMetaReader(nil, bytes.NewReader(b))
+		require.ErrorIs(t, err, ErrSubtreeNodesEmpty)
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		meta := buildFormatTestMeta(t, 8)
+		meta.Format = MetaFormatOffsets
+
+		b, err := meta.Serialize()
+		require.NoError(t, err)
+
+		b[36] |= 0x80
+
+		_, err = NewMetaReader(meta.Subtree, bytes.NewReader(b))
+		require.ErrorIs(t, err, ErrUnknownMetaFormat)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		meta := buildFormatTestMeta(t, 8)
+		meta.Format = MetaFormatOffsets | MetaFormatDictionary
+
+		b, err := meta.Serialize()
+		require.NoError(t, err)
+
+		_, err = NewMetaReader(meta.Subtree, bytes.NewReader(b[:40]))
+		require.Error(t, err)
+
+		_, err = NewMetaReader(meta.Subtree, bytes.NewReader(b[:50]))
+		require.Error(t, err)
+
+		r, err := NewMetaReader(meta.Subtree, bytes.NewReader(b[:len(b)-1]))
+		require.NoError(t, err)
+
+		_, err = r.TxInpointsAt(0)
+		require.NoError(t, err)
+
+		_, err = r.TxInpointsAt(7)
+		require.Error(t, err)
+	})
+
+	t.Run("invalid offset table entry", func(t *testing.T) {
+		meta := buildFormatTestMeta(t, 8)
+		meta.Format = MetaFormatOffsets
+
+		b, err := meta.Serialize()
+		require.NoError(t, err)
+
+		// the end offset of record 2 before its start offset
+		binary.LittleEndian.PutUint64(b[metaFormattedHeaderSize+3*8:], 0)
+
+		r, err := NewMetaReader(meta.Subtree, bytes.NewReader(b))
+		require.NoError(t, err)
+
+		_, err = r.TxInpointsAt(2)
+		require.ErrorIs(t, err, ErrIndexOutOfRange)
+	})
+
+	t.Run("record beyond the end of the meta", func(t *testing.T) {
+		meta := buildFormatTestMeta(t, 8)
+		meta.Format = MetaFormatOffsets
+
+		b, err := meta.Serialize()
+		require.NoError(t, err)
+
+		// the end offset of record 2 far beyond the end of the file
+		binary.LittleEndian.PutUint64(b[metaFormattedHeaderSize+3*8:], 1<<40)
+
+		r, err := NewMetaReader(meta.Subtree, bytes.NewReader(b))
+		require.NoError(t, err)
+
+		_, err = r.TxInpointsAt(2)
+		require.ErrorIs(t, err, ErrIndexOutOfRange)
+
+		// a reader without a size is limited to the maximum record size
+		r, err = NewMetaReader(meta.Subtree, eofReaderAt{bytes.NewReader(b)})
+		require.NoError(t, err)
+
+		_, err = r.ParentTxHashesAt(2)
+		require.ErrorIs(t, err, ErrIndexOutOfRange)
+
+		_, err = r.TxInpointsAt(1)
+		require.NoError(t, err)
+	})
+
+	t.Run("eof with full read", func(t *testing.T) {
+		meta := buildFormatTestMeta(t, 8)
+		meta.Format = MetaFormatOffsets | MetaFormatDictionary
+
+		b, err := meta.Serialize()
+		require.NoError(t, err)
+
+		r, err := NewMetaReader(meta.Subtree, eofReaderAt{bytes.NewReader(b)})
+		require.NoError(t, err)
+
+		// the last record ends at the end of the file
+		p, err := r.TxInpointsAt(7)
+		require.NoError(t, err)
+		assert.Equal(t, meta.TxInpoints[7], p)
+	})
+}
+
+// BenchmarkMetaReaderTxInpointsAt compares the lookup of a single TxInpoints through a
+// MetaReader with decoding the complete meta file.
+func BenchmarkMetaReaderTxInpointsAt(b *testing.B) {
+	meta := buildFormatBenchMeta(b, 8192, formatBenchDistributions[0].inpoints)
+	meta.Format = MetaFormatOffsets | MetaFormatVarint
+
+	serialized, err := meta.Serialize()
+	require.NoError(b, err)
+
+	b.Run("MetaReader", func(b *testing.B) {
+		r, err := NewMetaReader(meta.Subtree, bytes.NewReader(serialized))
+		require.NoError(b, err)
+
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			if _, err = r.TxInpointsAt(8000); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("NewSubtreeMetaFromBytes", func(b *testing.B) {
+		b.ReportAllocs()
+
+		var parents []chainhash.Hash
+
+		for i := 0; i < b.N; i++ {
+			m, err := NewSubtreeMetaFromBytes(meta.Subtree, serialized)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			parents = m.TxInpoints[8000].ParentTxHashes
+		}
+
+		_ = parents
+	})
+}
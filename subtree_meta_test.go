@@ -1,7 +1,10 @@
 package subtree
 
 import (
+	"bufio"
 	"bytes"
+	"io"
+	"sync"
 	"testing"
 
 	"github.com/bsv-blockchain/go-bt/v2"
@@ -306,6 +309,47 @@ func TestMetaSetTxInpoints(t *testing.T) {
 		))
 		require.Error(t, err)
 		assert.Equal(t, "index out of range", err.Error())
+
+		require.ErrorIs(t, subtreeMeta.SetTxInpoints(-1, TxInpoints{}), ErrIndexOutOfRange)
+	})
+
+	t.Run("concurrent setters", func(t *testing.T) {
+		subtree, dataBytes := buildLargeTestData(t, 1000)
+
+		data, err := NewSubtreeDataFromBytes(subtree, dataBytes)
+		require.NoError(t, err)
+
+		subtreeMeta := NewSubtreeMeta(subtree)
+
+		var wg sync.WaitGroup
+
+		for worker := 0; worker < 4; worker++ {
+			wg.Add(1)
+
+			go func(worker int) {
+				defer wg.Done()
+
+				for i := worker; i < len(data.Txs); i += 4 {
+					if worker%2 == 0 {
+						assert.NoError(t, subtreeMeta.SetTxInpointsFromTx(data.Txs[i]))
+						continue
+					}
+
+					txInpoints, err := NewTxInpointsFromTx(data.Txs[i])
+					assert.NoError(t, err)
+					assert.NoError(t, subtreeMeta.SetTxInpoints(i, txInpoints))
+				}
+			}(worker)
+		}
+
+		wg.Wait()
+
+		for i, tx := range data.Txs {
+			inpoints, err := subtreeMeta.GetTxInpoints(i)
+			require.NoError(t, err)
+			require.Len(t, inpoints, 1)
+			assert.Equal(t, *tx.Inputs[0].PreviousTxIDChainHash(), inpoints[0].Hash)
+		}
 	})
 }
 
@@ -349,6 +393,102 @@ func TestNewSubtreeMetaFromBytesErrors(t *testing.T) {
 	})
 }
 
+func TestMetaRootHash(t *testing.T) {
+	t.Run("stored root hash", func(t *testing.T) {
+		_, subtree, subtreeMeta := initMeta(t)
+		assert.Nil(t, subtreeMeta.StoredRootHash())
+
+		b, err := subtreeMeta.Serialize()
+		require.NoError(t, err)
+		assert.Equal(t, subtree.RootHash(), subtreeMeta.StoredRootHash())
+
+		readMeta, err := NewSubtreeMetaFromBytes(subtree, b)
+		require.NoError(t, err)
+		assert.Equal(t, subtree.RootHash(), readMeta.StoredRootHash())
+
+		peeked, err := PeekMetaRootHash(bufio.NewReader(bytes.NewReader(b)))
+		require.NoError(t, err)
+		assert.Equal(t, subtree.RootHash(), peeked)
+	})
+
+	t.Run("meta of another subtree", func(t *testing.T) {
+		_, subtree, subtreeMeta := initMeta(t)
+
+		b, err := subtreeMeta.Serialize()
+		require.NoError(t, err)
+
+		// same number of nodes, different transactions
+		otherSubtree, err := NewTreeByLeafCount(4)
+		require.NoError(t, err)
+
+		for i := 0; i < 4; i++ {
+			otherTx := tx.Clone()
+			otherTx.Version = uint32(i + 100) //nolint:gosec // G115: test data
+			require.NoError(t, otherSubtree.AddNode(*otherTx.TxIDChainHash(), 1, 1))
+		}
+
+		_, err = NewSubtreeMetaFromBytes(otherSubtree, b)
+		require.ErrorIs(t, err, ErrSubtreeRootMismatch)
+
+		var mismatchErr *RootHashMismatchError
+		require.ErrorAs(t, err, &mismatchErr)
+		assert.Equal(t, *otherSubtree.RootHash(), mismatchErr.Expected)
+		assert.Equal(t, *subtree.RootHash(), mismatchErr.Actual)
+		assert.Contains(t, err.Error(), subtree.RootHash().String())
+
+		_, err = NewSubtreeMetaFromReader(otherSubtree, bytes.NewReader(b))
+		require.ErrorIs(t, err, ErrSubtreeRootMismatch)
+
+		// the lenient constructors load the meta anyway
+		readMeta, err := NewSubtreeMetaFromBytesLenient(otherSubtree, b)
+		require.NoError(t, err)
+		assert.Equal(t, subtree.RootHash(), readMeta.StoredRootHash())
+		assert.Equal(t, subtreeMeta.TxInpoints[:4], readMeta.TxInpoints[:4])
+
+		readMeta, err = NewSubtreeMetaFromReaderLenient(otherSubtree, bytes.NewReader(b))
+		require.NoError(t, err)
+		assert.Equal(t, subtree.RootHash(), readMeta.StoredRootHash())
+	})
+
+	t.Run("legacy meta without root hash", func(t *testing.T) {
+		_, subtree, subtreeMeta := initMeta(t)
+
+		b, err := subtreeMeta.Serialize()
+		require.NoError(t, err)
+
+		copy(b[:32], make([]byte, 32))
+
+		_, err = NewSubtreeMetaFromBytes(subtree, b)
+		require.ErrorIs(t, err, ErrSubtreeRootMismatch)
+
+		readMeta, err := NewSubtreeMetaFromBytesLenient(subtree, b)
+		require.NoError(t, err)
+		assert.Nil(t, readMeta.StoredRootHash())
+	})
+
+	t.Run("peek does not consume the reader", func(t *testing.T) {
+		_, subtree, subtreeMeta := initMeta(t)
+
+		b, err := subtreeMeta.Serialize()
+		require.NoError(t, err)
+
+		reader := bufio.NewReader(bytes.NewReader(b))
+
+		peeked, err := PeekMetaRootHash(reader)
+		require.NoError(t, err)
+		assert.Equal(t, subtree.RootHash(), peeked)
+
+		readMeta, err := NewSubtreeMetaFromReader(subtree, reader)
+		require.NoError(t, err)
+		assert.Equal(t, subtreeMeta.TxInpoints, readMeta.TxInpoints)
+	})
+
+	t.Run("peek short data", func(t *testing.T) {
+		_, err := PeekMetaRootHash(bufio.NewReader(bytes.NewReader([]byte{0x01, 0x02})))
+		require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+}
+
 func TestNewSubtreeMetaFromReaderErrors(t *testing.T) {
 	t.Run("invalid reader", func(t *testing.T) {
 		subtree, err := NewTreeByLeafCount(4)
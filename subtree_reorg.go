@@ -0,0 +1,130 @@
+package subtree
+
+import (
+	"fmt"
+
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+)
+
+// ReorgResult holds the output of ReorgSubtrees.
+type ReorgResult struct {
+	// Subtrees are the freshly packed subtrees, in the original transaction order.
+	// Every subtree except the last one is complete.
+	Subtrees []*Subtree
+	// Metas holds the matching Meta for each subtree in Subtrees. It is nil when
+	// ReorgSubtrees was called without metas.
+	Metas []*Meta
+}
+
+// ReorgSubtrees takes the subtrees of an orphaned block, removes every transaction
+// that has been mined in the new chain and re-packs the remaining transactions into
+// fresh subtrees of leafCount leaves each.
+//
+// The relative order of the transactions is kept, so a topologically ordered input
+// produces a topologically ordered output. Fees, sizes and conflicting flags are
+// carried over for every remaining node. The coinbase placeholder of the old block
+// is dropped, the caller is responsible for adding a new one when the subtrees are
+// used for block assembly.
+//
+// Parameters:
+//   - subtrees: The subtrees of the orphaned block, in block order
+//   - metas: Optional Meta objects matching subtrees by index, nil to skip the inpoints
+//   - minedTxs: The txids that have been mined in the new chain, nil if none
+//   - leafCount: The number of leaves of the new subtrees, must be a power of two
+//
+// Returns:
+//   - *ReorgResult: The re-packed subtrees and, when metas were given, their Meta
+//   - error: An error if the parameters are invalid or a subtree could not be created
+func ReorgSubtrees(subtrees []*Subtree, metas []*Meta, minedTxs TxMap, leafCount int) (*ReorgResult, error) {
+	if !IsPowerOfTwo(leafCount) {
+		return nil, ErrNotPowerOfTwo
+	}
+
+	withMeta := len(metas) > 0
+	if withMeta && len(metas) != len(subtrees) {
+		return nil, fmt.Errorf("%w: %d subtrees, %d metas", ErrSubtreeMetaCountMismatch, len(subtrees), len(metas))
+	}
+
+	result := &ReorgResult{
+		Subtrees: make([]*Subtree, 0, len(subtrees)),
+	}
+
+	if withMeta {
+		result.Metas = make([]*Meta, 0, len(subtrees))
+	}
+
+	var (
+		current     *Subtree
+		currentMeta *Meta
+		err         error
+	)
+
+	for i, st := range subtrees {
+		if st == nil {
+			return nil, fmt.Errorf("subtree %d: %w", i, ErrSubtreeNil)
+		}
+
+		var conflicting map[chainhash.Hash]struct{}
+		if len(st.ConflictingNodes) > 0 {
+			conflicting = make(map[chainhash.Hash]struct{}, len(st.ConflictingNodes))
+			for _, hash := range st.ConflictingNodes {
+				conflicting[hash] = struct{}{}
+			}
+		}
+
+		for j, node := range st.Nodes {
+			if node.Hash.Equal(CoinbasePlaceholderHashValue) {
+				continue
+			}
+
+			if minedTxs != nil && minedTxs.Exists(node.Hash) {
+				continue
+			}
+
+			if current == nil || current.IsComplete() {
+				if current, err = NewTreeByLeafCount(leafCount); err != nil {
+					return nil, err
+				}
+
+				result.Subtrees = append(result.Subtrees, current)
+
+				if withMeta {
+					currentMeta = NewSubtreeMeta(current)
+					result.Metas = append(result.Metas, currentMeta)
+				}
+			}
+
+			if err = current.AddSubtreeNode(node); err != nil {
+				return nil, fmt.Errorf("unable to add node %s to reorg subtree: %w", node.Hash.String(), err)
+			}
+
+			if _, ok := conflicting[node.Hash]; ok {
+				if err = current.AddConflictingNode(node.Hash); err != nil {
+					return nil, fmt.Errorf("unable to mark node %s as conflicting in reorg subtree: %w", node.Hash.String(), err)
+				}
+			}
+
+			if withMeta {
+				if err = copyTxInpoints(metas[i], j, currentMeta, current.Length()-1); err != nil {
+					return nil, fmt.Errorf("subtree %d: %w", i, err)
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// copyTxInpoints copies the TxInpoints at index from of the source meta to index to
+// of the destination meta.
+func copyTxInpoints(src *Meta, from int, dst *Meta, to int) error {
+	if src == nil {
+		return ErrSubtreeMetaNil
+	}
+
+	if from >= len(src.TxInpoints) {
+		return fmt.Errorf("meta node %d: %w", from, ErrIndexOutOfRange)
+	}
+
+	return dst.SetTxInpoints(to, src.TxInpoints[from])
+}
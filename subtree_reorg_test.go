@@ -0,0 +1,152 @@
+package subtree
+
+import (
+	"testing"
+
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+	txmap "github.com/bsv-blockchain/go-tx-map"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReorgSubtrees(t *testing.T) {
+	hashes := make([]chainhash.Hash, 8)
+	for i := range hashes {
+		hashes[i] = chainhash.HashH([]byte{byte(i)})
+	}
+
+	buildSubtrees := func(t *testing.T) ([]*Subtree, []*Meta) {
+		t.Helper()
+
+		st1, err := NewTreeByLeafCount(4)
+		require.NoError(t, err)
+		require.NoError(t, st1.AddCoinbaseNode())
+
+		st2, err := NewTreeByLeafCount(4)
+		require.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			require.NoError(t, st1.AddNode(hashes[i], uint64(i+1), uint64(i+10)))
+		}
+
+		for i := 3; i < 7; i++ {
+			require.NoError(t, st2.AddNode(hashes[i], uint64(i+1), uint64(i+10)))
+		}
+
+		require.NoError(t, st2.AddConflictingNode(hashes[5]))
+
+		meta1 := NewSubtreeMeta(st1)
+		meta2 := NewSubtreeMeta(st2)
+
+		for i := 1; i < 4; i++ {
+			require.NoError(t, meta1.SetTxInpoints(i, txInpointsFromParentVouts(hashes[7], uint32(i))))
+		}
+
+		for i := 0; i < 4; i++ {
+			require.NoError(t, meta2.SetTxInpoints(i, txInpointsFromParentVouts(hashes[7], uint32(i+4))))
+		}
+
+		return []*Subtree{st1, st2}, []*Meta{meta1, meta2}
+	}
+
+	t.Run("removes mined txs and repacks in order", func(t *testing.T) {
+		subtrees, metas := buildSubtrees(t)
+
+		mined := txmap.NewSwissMapUint64(2)
+		require.NoError(t, mined.Put(hashes[1], 0))
+		require.NoError(t, mined.Put(hashes[4], 0))
+
+		result, err := ReorgSubtrees(subtrees, metas, mined, 2)
+		require.NoError(t, err)
+
+		require.Len(t, result.Subtrees, 3)
+		require.Len(t, result.Metas, 3)
+
+		expected := []int{0, 2, 3, 5, 6}
+		pos := 0
+
+		for i, st := range result.Subtrees {
+			assert.Equal(t, 2, st.Size())
+
+			for j, node := range st.Nodes {
+				idx := expected[pos]
+				assert.Equal(t, hashes[idx], node.Hash)
+				assert.Equal(t, uint64(idx+1), node.Fee)
+				assert.Equal(t, uint64(idx+10), node.SizeInBytes)
+
+				vouts, err := result.Metas[i].TxInpoints[j].GetParentVoutsAtIndex(0)
+				require.NoError(t, err)
+				assert.Equal(t, []uint32{uint32(idx + 1)}, vouts)
+
+				pos++
+			}
+		}
+
+		assert.Equal(t, len(expected), pos)
+
+		var totalFees uint64
+		for _, st := range result.Subtrees {
+			totalFees += st.Fees
+		}
+
+		assert.Equal(t, uint64(1+3+4+6+7), totalFees)
+		assert.Equal(t, []chainhash.Hash{hashes[5]}, result.Subtrees[1].ConflictingNodes)
+		assert.True(t, result.Subtrees[1].IsConflicting(hashes[5]))
+		assert.Empty(t, result.Subtrees[0].ConflictingNodes)
+	})
+
+	t.Run("without metas and mined txs", func(t *testing.T) {
+		subtrees, _ := buildSubtrees(t)
+
+		result, err := ReorgSubtrees(subtrees, nil, nil, 8)
+		require.NoError(t, err)
+
+		require.Len(t, result.Subtrees, 1)
+		assert.Nil(t, result.Metas)
+		assert.Equal(t, 7, result.Subtrees[0].Length())
+		assert.Equal(t, subtrees[0].Fees+subtrees[1].Fees, result.Subtrees[0].Fees)
+		assert.Equal(t, subtrees[0].SizeInBytes+subtrees[1].SizeInBytes, result.Subtrees[0].SizeInBytes)
+	})
+
+	t.Run("all txs mined", func(t *testing.T) {
+		subtrees, _ := buildSubtrees(t)
+
+		mined, err := subtrees[1].GetMap()
+		require.NoError(t, err)
+
+		for _, node := range subtrees[0].Nodes[1:] {
+			require.NoError(t, mined.Put(node.Hash, 0))
+		}
+
+		result, err := ReorgSubtrees(subtrees, nil, mined, 4)
+		require.NoError(t, err)
+		assert.Empty(t, result.Subtrees)
+	})
+
+	t.Run("invalid leaf count", func(t *testing.T) {
+		subtrees, _ := buildSubtrees(t)
+
+		_, err := ReorgSubtrees(subtrees, nil, nil, 3)
+		require.ErrorIs(t, err, ErrNotPowerOfTwo)
+	})
+
+	t.Run("meta count mismatch", func(t *testing.T) {
+		subtrees, metas := buildSubtrees(t)
+
+		_, err := ReorgSubtrees(subtrees, metas[:1], nil, 4)
+		require.ErrorIs(t, err, ErrSubtreeMetaCountMismatch)
+	})
+
+	t.Run("nil subtree", func(t *testing.T) {
+		_, err := ReorgSubtrees([]*Subtree{nil}, nil, nil, 4)
+		require.ErrorIs(t, err, ErrSubtreeNil)
+	})
+
+	t.Run("nil meta", func(t *testing.T) {
+		subtrees, metas := buildSubtrees(t)
+		metas[1] = nil
+
+		_, err := ReorgSubtrees(subtrees, metas, nil, 4)
+		require.ErrorIs(t, err, ErrSubtreeMetaNil)
+	})
+}
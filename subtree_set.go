@@ -0,0 +1,201 @@
+package subtree
+
+import (
+	"sync"
+)
+
+// setOperationSplitSize is the number of nodes above which set operations are split
+// over multiple goroutines, and the number of nodes each goroutine handles.
+const setOperationSplitSize = 32 * 1024
+
+// NodeSet is a selection of nodes of a subtree, together with their indices in the
+// subtree. Nodes and Indices are in subtree order.
+type NodeSet struct {
+	Indices []int
+	Nodes   []Node
+}
+
+// Len returns the number of nodes in the set.
+func (ns *NodeSet) Len() int {
+	return len(ns.Nodes)
+}
+
+// DifferenceWithIndices returns the nodes in the subtree that are not present in the
+// given TxMap, together with their indices. Large subtrees are processed in parallel,
+// the TxMap must not be modified during the call.
+func (st *Subtree) DifferenceWithIndices(ids TxMap) (*NodeSet, error) {
+	return filterNodes(st.Nodes, func(node Node) bool {
+		return !ids.Exists(node.Hash)
+	}), nil
+}
+
+// Intersection returns the nodes in the subtree that are also present in the given
+// TxMap, together with their indices. Large subtrees are processed in parallel, the
+// TxMap must not be modified during the call.
+func (st *Subtree) Intersection(ids TxMap) (*NodeSet, error) {
+	return filterNodes(st.Nodes, func(node Node) bool {
+		return ids.Exists(node.Hash)
+	}), nil
+}
+
+// SymmetricDifference returns the nodes that are only in this subtree and the nodes
+// that are only in the other subtree, each with their indices in their own subtree.
+func (st *Subtree) SymmetricDifference(other *Subtree) (onlyInSt, onlyInOther *NodeSet, err error) {
+	if other == nil {
+		return nil, nil, ErrSubtreeNil
+	}
+
+	stMap, err := st.GetMap()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	otherMap, err := other.GetMap()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if onlyInSt, err = st.DifferenceWithIndices(otherMap); err != nil {
+		return nil, nil, err
+	}
+
+	if onlyInOther, err = other.DifferenceWithIndices(stMap); err != nil {
+		return nil, nil, err
+	}
+
+	return onlyInSt, onlyInOther, nil
+}
+
+// FirstDivergence returns the first index at which the txids of the two subtrees
+// differ. When one subtree is a prefix of the other, the length of the shorter one is
+// returned, and -1 is returned when both subtrees contain the same txids in the same
+// order. Large subtrees are compared in parallel.
+func (st *Subtree) FirstDivergence(other *Subtree) int {
+	length := len(st.Nodes)
+	otherLength := 0
+
+	if other != nil {
+		otherLength = len(other.Nodes)
+	}
+
+	common := Min(length, otherLength)
+
+	firstMismatch := func(from, to int) int {
+		for i := from; i < to; i++ {
+			if !st.Nodes[i].Hash.Equal(other.Nodes[i].Hash) {
+				return i
+			}
+		}
+
+		return -1
+	}
+
+	divergence := -1
+
+	if common <= setOperationSplitSize {
+		divergence = firstMismatch(0, common)
+	} else {
+		chunks := splitRange(common)
+		results := make([]int, len(chunks))
+
+		var wg sync.WaitGroup
+
+		for i, chunk := range chunks {
+			wg.Add(1)
+
+			go func(i, from, to int) {
+				defer wg.Done()
+
+				results[i] = firstMismatch(from, to)
+			}(i, chunk[0], chunk[1])
+		}
+
+		wg.Wait()
+
+		for _, result := range results {
+			if result != -1 {
+				divergence = result
+				break
+			}
+		}
+	}
+
+	if divergence == -1 && length != otherLength {
+		return common
+	}
+
+	return divergence
+}
+
+// filterNodes returns the nodes for which keep returns true, with their indices.
+// Slices larger than setOperationSplitSize are split in chunks that are filtered
+// concurrently and concatenated in order.
+func filterNodes(nodes []Node, keep func(node Node) bool) *NodeSet {
+	filter := func(from, to int) *NodeSet {
+		set := &NodeSet{}
+
+		for i := from; i < to; i++ {
+			if keep(nodes[i]) {
+				set.Indices = append(set.Indices, i)
+				set.Nodes = append(set.Nodes, nodes[i])
+			}
+		}
+
+		return set
+	}
+
+	if len(nodes) <= setOperationSplitSize {
+		set := filter(0, len(nodes))
+		if set.Nodes == nil {
+			set.Indices = []int{}
+			set.Nodes = []Node{}
+		}
+
+		return set
+	}
+
+	chunks := splitRange(len(nodes))
+	results := make([]*NodeSet, len(chunks))
+
+	var wg sync.WaitGroup
+
+	for i, chunk := range chunks {
+		wg.Add(1)
+
+		go func(i, from, to int) {
+			defer wg.Done()
+
+			results[i] = filter(from, to)
+		}(i, chunk[0], chunk[1])
+	}
+
+	wg.Wait()
+
+	total := 0
+	for _, result := range results {
+		total += result.Len()
+	}
+
+	set := &NodeSet{
+		Indices: make([]int, 0, total),
+		Nodes:   make([]Node, 0, total),
+	}
+
+	for _, result := range results {
+		set.Indices = append(set.Indices, result.Indices...)
+		set.Nodes = append(set.Nodes, result.Nodes...)
+	}
+
+	return set
+}
+
+// splitRange splits [0, length) into [from, to) chunks of setOperationSplitSize.
+func splitRange(length int) [][2]int {
+	chunks := make([][2]int, 0, (length+setOperationSplitSize-1)/setOperationSplitSize)
+
+	for from := 0; from < length; from += setOperationSplitSize {
+		chunks = append(chunks, [2]int{from, Min(from+setOperationSplitSize, length)})
+	}
+
+	return chunks
+}
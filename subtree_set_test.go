@@ -0,0 +1,144 @@
+package subtree
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+	txmap "github.com/bsv-blockchain/go-tx-map"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildSetTestSubtree creates a subtree with count nodes whose hashes are derived
+// from their index.
+func buildSetTestSubtree(t *testing.T, count int) *Subtree {
+	t.Helper()
+
+	st, err := NewTreeByLeafCount(CeilPowerOfTwo(count))
+	require.NoError(t, err)
+
+	var b [8]byte
+
+	for i := 0; i < count; i++ {
+		binary.LittleEndian.PutUint64(b[:], uint64(i))
+		require.NoError(t, st.AddNode(chainhash.HashH(b[:]), uint64(i), 1))
+	}
+
+	return st
+}
+
+func TestSubtreeIntersection(t *testing.T) {
+	tests := []struct {
+		name  string
+		count int
+	}{
+		{name: "small subtree", count: 16},
+		{name: "large subtree processed in parallel", count: 3*setOperationSplitSize + 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := buildSetTestSubtree(t, tt.count)
+
+			ids := txmap.NewSwissMapUint64(0)
+			for i := 1; i < tt.count; i += 3 {
+				require.NoError(t, ids.Put(st.Nodes[i].Hash, 0))
+			}
+
+			intersection, err := st.Intersection(ids)
+			require.NoError(t, err)
+
+			difference, err := st.DifferenceWithIndices(ids)
+			require.NoError(t, err)
+
+			assert.Equal(t, ids.Length(), intersection.Len())
+			assert.Equal(t, tt.count, intersection.Len()+difference.Len())
+
+			for i, idx := range intersection.Indices {
+				assert.Equal(t, 1+i*3, idx)
+				assert.Equal(t, st.Nodes[idx], intersection.Nodes[i])
+			}
+
+			for i, idx := range difference.Indices {
+				assert.NotEqual(t, 1, idx%3)
+				assert.Equal(t, st.Nodes[idx], difference.Nodes[i])
+			}
+
+			nodes, err := st.Difference(ids)
+			require.NoError(t, err)
+			assert.Equal(t, difference.Nodes, nodes)
+		})
+	}
+
+	t.Run("empty result", func(t *testing.T) {
+		st := buildSetTestSubtree(t, 4)
+
+		intersection, err := st.Intersection(txmap.NewSwissMapUint64(0))
+		require.NoError(t, err)
+		assert.NotNil(t, intersection.Nodes)
+		assert.Equal(t, 0, intersection.Len())
+	})
+}
+
+func TestSubtreeSymmetricDifference(t *testing.T) {
+	st1 := buildSetTestSubtree(t, 8)
+	st2 := buildSetTestSubtree(t, 8)
+
+	// replace the last 2 nodes of st2
+	st2.Nodes = st2.Nodes[:6]
+	require.NoError(t, st2.AddNode(chainhash.HashH([]byte("a")), 1, 1))
+	require.NoError(t, st2.AddNode(chainhash.HashH([]byte("b")), 1, 1))
+
+	onlyIn1, onlyIn2, err := st1.SymmetricDifference(st2)
+	require.NoError(t, err)
+
+	assert.Equal(t, []int{6, 7}, onlyIn1.Indices)
+	assert.Equal(t, st1.Nodes[6:], onlyIn1.Nodes)
+	assert.Equal(t, []int{6, 7}, onlyIn2.Indices)
+	assert.Equal(t, st2.Nodes[6:], onlyIn2.Nodes)
+
+	_, _, err = st1.SymmetricDifference(nil)
+	require.ErrorIs(t, err, ErrSubtreeNil)
+}
+
+func TestSubtreeFirstDivergence(t *testing.T) {
+	large := 2*setOperationSplitSize + 5
+
+	tests := []struct {
+		name     string
+		count    int
+		modify   func(st *Subtree)
+		expected int
+	}{
+		{name: "identical", count: 8, modify: func(_ *Subtree) {}, expected: -1},
+		{name: "differs in the middle", count: 8, modify: func(st *Subtree) { st.Nodes[5].Hash = chainhash.Hash{} }, expected: 5},
+		{name: "prefix", count: 8, modify: func(st *Subtree) { st.Nodes = st.Nodes[:3] }, expected: 3},
+		{name: "large identical", count: large, modify: func(_ *Subtree) {}, expected: -1},
+		{
+			name:  "large differs in later chunks",
+			count: large,
+			modify: func(st *Subtree) {
+				st.Nodes[setOperationSplitSize+10].Hash = chainhash.Hash{}
+				st.Nodes[large-1].Hash = chainhash.Hash{}
+			},
+			expected: setOperationSplitSize + 10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st1 := buildSetTestSubtree(t, tt.count)
+			st2 := st1.Duplicate()
+			tt.modify(st2)
+
+			assert.Equal(t, tt.expected, st1.FirstDivergence(st2))
+			assert.Equal(t, tt.expected, st2.FirstDivergence(st1))
+		})
+	}
+
+	t.Run("nil other", func(t *testing.T) {
+		st := buildSetTestSubtree(t, 2)
+		assert.Equal(t, 0, st.FirstDivergence(nil))
+	})
+}
@@ -0,0 +1,178 @@
+package subtree
+
+import (
+	"fmt"
+
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+)
+
+// Spender is a transaction spending an outpoint, at its position in the subtrees of a
+// SpentIndex.
+type Spender struct {
+	// TxHash is the txid of the spending transaction
+	TxHash chainhash.Hash
+	// Subtree is the index of the subtree the transaction is in, in the order the
+	// subtrees were added to the index
+	Subtree int
+	// Index is the index of the transaction in its subtree
+	Index int
+}
+
+// SpendConflict describes two transactions spending the same outpoint.
+type SpendConflict struct {
+	// Inpoint is the outpoint spent by both transactions
+	Inpoint Inpoint
+	// First is the spender that was in the index first
+	First Spender
+	// Second is the spender that was added later and conflicts with First
+	Second Spender
+}
+
+// String returns a string representation of the conflict.
+func (c SpendConflict) String() string {
+	return fmt.Sprintf("%s:%d spent by %s at %d:%d and by %s at %d:%d",
+		c.Inpoint.Hash.String(), c.Inpoint.Index,
+		c.First.TxHash.String(), c.First.Subtree, c.First.Index,
+		c.Second.TxHash.String(), c.Second.Subtree, c.Second.Index,
+	)
+}
+
+// SpentIndex maps every outpoint spent by the transactions of one or more subtrees to
+// the transaction spending it, built from the TxInpoints in their Meta. Subtrees can
+// be added one at a time, as they are completed, and every outpoint that is spent by
+// more than one transaction is reported as a SpendConflict when it is added. The index
+// keeps the first spender of an outpoint.
+//
+// Nodes without TxInpoints in their meta, like the coinbase placeholder, do not spend
+// any outpoints. A SpentIndex is not safe for concurrent use.
+type SpentIndex struct {
+	spenders  map[Inpoint]Spender
+	conflicts []SpendConflict
+	subtrees  int
+}
+
+// NewSpentIndex creates a new SpentIndex and adds the given metas, in order.
+//
+// Parameters:
+//   - metas: The Meta objects of the subtrees, in block order
+//
+// Returns:
+//   - *SpentIndex: The index of all outpoints spent in the subtrees, see Conflicts for the double spends
+//   - error: An error if a meta or its subtree is not set
+func NewSpentIndex(metas ...*Meta) (*SpentIndex, error) {
+	total := 0
+
+	for i, meta := range metas {
+		if err := checkSpentIndexMeta(meta); err != nil {
+			return nil, fmt.Errorf("meta %d: %w", i, err)
+		}
+
+		total += meta.Subtree.Length()
+	}
+
+	// most transactions spend 1 or 2 outpoints
+	si := &SpentIndex{
+		spenders: make(map[Inpoint]Spender, total*2),
+	}
+
+	for _, meta := range metas {
+		if _, err := si.AddMeta(meta); err != nil {
+			return nil, err
+		}
+	}
+
+	return si, nil
+}
+
+// AddMeta adds the outpoints spent by the transactions of the subtree of the meta to
+// the index, as the next subtree. When the meta cannot be added, the index is not
+// changed.
+//
+// Parameters:
+//   - meta: The Meta of the next subtree
+//
+// Returns:
+//   - []SpendConflict: The conflicts with the outpoints already in the index, in node order
+//   - error: An error if the meta or its subtree is not set
+func (si *SpentIndex) AddMeta(meta *Meta) ([]SpendConflict, error) {
+	if err := checkSpentIndexMeta(meta); err != nil {
+		return nil, err
+	}
+
+	// the meta has been validated, nothing below can fail and leave the index half updated
+	subtreeIdx := si.subtrees
+	si.subtrees++
+
+	var conflicts []SpendConflict
+
+	for i := 0; i < meta.Subtree.Length() && i < len(meta.TxInpoints); i++ {
+		spender := Spender{
+			TxHash:  meta.Subtree.Nodes[i].Hash,
+			Subtree: subtreeIdx,
+			Index:   i,
+		}
+
+		for _, inpoint := range meta.TxInpoints[i].GetTxInpoints() {
+			first, ok := si.spenders[inpoint]
+			if !ok {
+				si.spenders[inpoint] = spender
+				continue
+			}
+
+			conflicts = append(conflicts, SpendConflict{
+				Inpoint: inpoint,
+				First:   first,
+				Second:  spender,
+			})
+		}
+	}
+
+	si.conflicts = append(si.conflicts, conflicts...)
+
+	return conflicts, nil
+}
+
+// Len returns the number of distinct outpoints in the index.
+func (si *SpentIndex) Len() int {
+	return len(si.spenders)
+}
+
+// Subtrees returns the number of subtrees added to the index.
+func (si *SpentIndex) Subtrees() int {
+	return si.subtrees
+}
+
+// Spender returns the first transaction spending the outpoint, and whether the outpoint
+// is spent in any of the subtrees.
+func (si *SpentIndex) Spender(inpoint Inpoint) (Spender, bool) {
+	spender, ok := si.spenders[inpoint]
+	return spender, ok
+}
+
+// IsSpent returns true if the outpoint is spent in any of the subtrees.
+func (si *SpentIndex) IsSpent(inpoint Inpoint) bool {
+	_, ok := si.spenders[inpoint]
+	return ok
+}
+
+// Conflicts returns all conflicts found since the index was created, in the order they
+// were found.
+func (si *SpentIndex) Conflicts() []SpendConflict {
+	conflicts := make([]SpendConflict, len(si.conflicts))
+	copy(conflicts, si.conflicts)
+
+	return conflicts
+}
+
+// checkSpentIndexMeta returns an error if the meta cannot be added to a SpentIndex.
+func checkSpentIndexMeta(meta *Meta) error {
+	if meta == nil {
+		return ErrSubtreeMetaNil
+	}
+
+	if meta.Subtree == nil {
+		return ErrSubtreeNil
+	}
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package subtree
+
+import (
+	"testing"
+
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpentIndex(t *testing.T) {
+	h := make([]chainhash.Hash, 8)
+	for i := range h {
+		h[i] = chainhash.HashH([]byte{byte(i), 's'})
+	}
+
+	external := make([]chainhash.Hash, 4)
+	for i := range external {
+		external[i] = chainhash.HashH([]byte{byte(i), 'e'})
+	}
+
+	t.Run("no conflicts", func(t *testing.T) {
+		meta1 := buildChainMeta(t, 4, h[:4], [][]chainhash.Hash{{external[0]}, {h[0]}, {h[1], external[1]}, {external[2]}})
+		meta2 := buildChainMeta(t, 4, h[4:], [][]chainhash.Hash{{h[3]}, {h[2]}, {external[3]}, {h[6]}})
+
+		si, err := NewSpentIndex(meta1, meta2)
+		require.NoError(t, err)
+		assert.Equal(t, 9, si.Len())
+		assert.Equal(t, 2, si.Subtrees())
+		assert.Empty(t, si.Conflicts())
+
+		spender, ok := si.Spender(Inpoint{Hash: h[2], Index: 0})
+		require.True(t, ok)
+		assert.Equal(t, Spender{TxHash: h[5], Subtree: 1, Index: 1}, spender)
+
+		assert.True(t, si.IsSpent(Inpoint{Hash: external[1], Index: 0}))
+		assert.False(t, si.IsSpent(Inpoint{Hash: external[1], Index: 1}))
+		assert.False(t, si.IsSpent(Inpoint{Hash: h[7], Index: 0}))
+
+		_, ok = si.Spender(Inpoint{Hash: h[7], Index: 0})
+		assert.False(t, ok)
+	})
+
+	t.Run("conflicts in a subtree", func(t *testing.T) {
+		meta := buildChainMeta(t, 4, h[:4], [][]chainhash.Hash{{external[0]}, {external[1]}, {external[0]}, {external[1], external[0]}})
+
+		si, err := NewSpentIndex()
+		require.NoError(t, err)
+
+		conflicts, err := si.AddMeta(meta)
+		require.NoError(t, err)
+		require.Len(t, conflicts, 3)
+
+		assert.Equal(t, SpendConflict{
+			Inpoint: Inpoint{Hash: external[0], Index: 0},
+			First:   Spender{TxHash: h[0], Subtree: 0, Index: 0},
+			Second:  Spender{TxHash: h[2], Subtree: 0, Index: 2},
+		}, conflicts[0])
+		assert.Equal(t, h[3], conflicts[1].Second.TxHash)
+		assert.Equal(t, h[1], conflicts[1].First.TxHash)
+		assert.Equal(t, h[3], conflicts[2].Second.TxHash)
+		assert.Equal(t, h[0], conflicts[2].First.TxHash)
+
+		// the first spender is kept
+		spender, ok := si.Spender(Inpoint{Hash: external[0], Index: 0})
+		require.True(t, ok)
+		assert.Equal(t, h[0], spender.TxHash)
+
+		assert.Equal(t, conflicts, si.Conflicts())
+		assert.Contains(t, conflicts[0].String(), "spent by "+h[0].String()+" at 0:0 and by "+h[2].String()+" at 0:2")
+	})
+
+	t.Run("incremental", func(t *testing.T) {
+		si, err := NewSpentIndex()
+		require.NoError(t, err)
+		assert.Equal(t, 0, si.Len())
+
+		conflicts, err := si.AddMeta(buildChainMeta(t, 4, h[:4], [][]chainhash.Hash{{external[0]}, {h[0]}, {h[1]}, {h[2]}}))
+		require.NoError(t, err)
+		assert.Empty(t, conflicts)
+
+		conflicts, err = si.AddMeta(buildChainMeta(t, 4, h[4:], [][]chainhash.Hash{{external[1]}, {h[1]}, {h[5]}, {external[1]}}))
+		require.NoError(t, err)
+		require.Len(t, conflicts, 2)
+
+		assert.Equal(t, Spender{TxHash: h[2], Subtree: 0, Index: 2}, conflicts[0].First)
+		assert.Equal(t, Spender{TxHash: h[5], Subtree: 1, Index: 1}, conflicts[0].Second)
+		assert.Equal(t, Spender{TxHash: h[4], Subtree: 1, Index: 0}, conflicts[1].First)
+		assert.Equal(t, Spender{TxHash: h[7], Subtree: 1, Index: 3}, conflicts[1].Second)
+
+		assert.Len(t, si.Conflicts(), 2)
+		assert.Equal(t, 2, si.Subtrees())
+
+		// the returned conflicts are a copy
+		si.Conflicts()[0] = SpendConflict{}
+		assert.Equal(t, h[2], si.Conflicts()[0].First.TxHash)
+	})
+
+	t.Run("transactions spending the same inputs", func(t *testing.T) {
+		// the transactions of initMeta only differ in their version
+		_, _, meta := initMeta(t)
+
+		inpoints, err := meta.GetTxInpoints(0)
+		require.NoError(t, err)
+
+		si, err := NewSpentIndex(meta)
+		require.NoError(t, err)
+		assert.Equal(t, len(inpoints), si.Len())
+		assert.Len(t, si.Conflicts(), 3*len(inpoints))
+
+		for _, conflict := range si.Conflicts() {
+			assert.Equal(t, 0, conflict.First.Index)
+		}
+	})
+
+	t.Run("coinbase placeholder", func(t *testing.T) {
+		meta := buildFormatTestMeta(t, 16)
+
+		si, err := NewSpentIndex(meta)
+		require.NoError(t, err)
+		assert.Equal(t, 1, si.Subtrees())
+
+		spender, ok := si.Spender(Inpoint{Hash: meta.Subtree.Nodes[1].Hash, Index: 0})
+		require.True(t, ok)
+		assert.Equal(t, 2, spender.Index)
+
+		for _, conflict := range si.Conflicts() {
+			assert.NotEqual(t, 0, conflict.First.Index)
+		}
+	})
+
+	t.Run("invalid metas", func(t *testing.T) {
+		_, err := NewSpentIndex(nil)
+		require.ErrorIs(t, err, ErrSubtreeMetaNil)
+
+		_, err = NewSpentIndex(&Meta{})
+		require.ErrorIs(t, err, ErrSubtreeNil)
+
+		si, err := NewSpentIndex()
+		require.NoError(t, err)
+
+		_, err = si.AddMeta(nil)
+		require.ErrorIs(t, err, ErrSubtreeMetaNil)
+		assert.Equal(t, 0, si.Subtrees())
+
+		// a failing meta leaves the index unchanged
+		_, _, meta := initMeta(t)
+
+		_, err = si.AddMeta(meta)
+		require.NoError(t, err)
+
+		length := si.Len()
+		conflicts := si.Conflicts()
+
+		_, err = si.AddMeta(&Meta{})
+		require.ErrorIs(t, err, ErrSubtreeNil)
+		assert.Equal(t, 1, si.Subtrees())
+		assert.Equal(t, length, si.Len())
+		assert.Equal(t, conflicts, si.Conflicts())
+	})
+}
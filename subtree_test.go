@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/bsv-blockchain/go-bt/v2/chainhash"
@@ -631,6 +632,31 @@ func TestSubtreeNodeIndex(t *testing.T) {
 		assert.Equal(t, -1, index)
 	})
 
+	t.Run("concurrent lookups", func(t *testing.T) {
+		st, err := NewTree(4)
+		require.NoError(t, err)
+
+		_ = st.AddNode(hash1, 111, 1)
+		_ = st.AddNode(hash2, 112, 2)
+
+		var wg sync.WaitGroup
+
+		// the node index map is created lazily by the first lookup, which must not race with the others
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				assert.Equal(t, 0, st.NodeIndex(hash1))
+				assert.Equal(t, 1, st.NodeIndex(hash2))
+				assert.Equal(t, -1, st.NodeIndex(hash3))
+			}()
+		}
+
+		wg.Wait()
+	})
+
 	t.Run("remove existing node", func(t *testing.T) {
 		st, err := NewTree(4)
 		require.NoError(t, err)
@@ -648,6 +674,40 @@ func TestSubtreeNodeIndex(t *testing.T) {
 		assert.Equal(t, hash2, st.Nodes[0].Hash)
 	})
 
+	t.Run("node index after removing a node", func(t *testing.T) {
+		st, err := NewTree(4)
+		require.NoError(t, err)
+
+		_ = st.AddNode(hash1, 111, 1)
+		_ = st.AddNode(hash2, 112, 2)
+
+		assert.Equal(t, 1, st.NodeIndex(hash2))
+
+		require.NoError(t, st.RemoveNodeAtIndex(0))
+		assert.Equal(t, 0, st.NodeIndex(hash2))
+		assert.Equal(t, -1, st.NodeIndex(hash1))
+	})
+
+	t.Run("node index after deserializing into a used subtree", func(t *testing.T) {
+		_, serialized := getSubtreeBytes(t)
+
+		for _, deserialize := range []func(st *Subtree) error{
+			func(st *Subtree) error { return st.Deserialize(serialized) },
+			func(st *Subtree) error { return st.DeserializeFromReader(bytes.NewReader(serialized)) },
+		} {
+			st, err := NewTree(2)
+			require.NoError(t, err)
+			require.NoError(t, st.AddNode(hash1, 111, 1))
+
+			// populate the node index before deserializing
+			require.Equal(t, 0, st.NodeIndex(hash1))
+
+			require.NoError(t, deserialize(st))
+			assert.Equal(t, -1, st.NodeIndex(hash1))
+			assert.Equal(t, 0, st.NodeIndex(st.Nodes[0].Hash))
+		}
+	})
+
 	t.Run("remove non-existing node", func(t *testing.T) {
 		st, err := NewTree(4)
 		require.NoError(t, err)
@@ -1061,6 +1121,64 @@ func TestSubtree_ConflictingNodes(t *testing.T) {
 	assert.Len(t, newSt.Nodes, 2)
 	assert.Equal(t, 2, newSt.Length())
 	assert.Len(t, newSt.ConflictingNodes, 1)
+	assert.True(t, newSt.IsConflicting(hash1))
+	assert.False(t, newSt.IsConflicting(hash2))
+
+	t.Run("membership", func(t *testing.T) {
+		st, err := NewTree(2)
+		require.NoError(t, err)
+		require.NoError(t, st.AddNode(hash1, 111, 1))
+		require.NoError(t, st.AddNode(hash2, 112, 2))
+
+		assert.False(t, st.IsConflicting(hash1))
+
+		require.ErrorIs(t, st.AddConflictingNode(chainhash.HashH([]byte("not in subtree"))), ErrConflictingNodeNotInSubtree)
+
+		require.NoError(t, st.AddConflictingNode(hash1))
+		require.NoError(t, st.AddConflictingNode(hash1))
+		assert.Equal(t, []chainhash.Hash{hash1}, st.ConflictingNodes)
+		assert.True(t, st.IsConflicting(hash1))
+		assert.False(t, st.IsConflicting(hash2))
+
+		st.SetConflictingNodes([]chainhash.Hash{hash2})
+		assert.False(t, st.IsConflicting(hash1))
+		assert.True(t, st.IsConflicting(hash2))
+
+		// the same backing array, with the same length
+		st.SetConflictingNodes(append(st.ConflictingNodes[:0], hash1))
+		assert.True(t, st.IsConflicting(hash1))
+		assert.False(t, st.IsConflicting(hash2))
+
+		st.SetConflictingNodes(nil)
+		assert.False(t, st.IsConflicting(hash1))
+		assert.False(t, st.IsConflicting(hash2))
+
+		require.NoError(t, st.AddConflictingNode(hash2))
+		assert.Equal(t, []chainhash.Hash{hash2}, st.ConflictingNodes)
+	})
+
+	t.Run("concurrent lookups", func(t *testing.T) {
+		st, err := NewTree(2)
+		require.NoError(t, err)
+		require.NoError(t, st.AddNode(hash1, 111, 1))
+		require.NoError(t, st.AddNode(hash2, 112, 2))
+		st.SetConflictingNodes([]chainhash.Hash{hash1})
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				assert.True(t, st.IsConflicting(hash1))
+				assert.False(t, st.IsConflicting(hash2))
+			}()
+		}
+
+		wg.Wait()
+	})
 }
 
 func BenchmarkSubtree_Deserialize(b *testing.B) {
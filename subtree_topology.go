@@ -0,0 +1,224 @@
+package subtree
+
+import (
+	"fmt"
+
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+)
+
+// TopologicalViolation describes a transaction that appears before (or at the same
+// position as) one of its parents in an ordered list of subtrees.
+type TopologicalViolation struct {
+	// ChildHash is the txid of the transaction spending the parent
+	ChildHash chainhash.Hash
+	// ChildSubtree is the index of the subtree the child is in
+	ChildSubtree int
+	// ChildIndex is the index of the child in its subtree
+	ChildIndex int
+	// ParentHash is the txid of the parent transaction
+	ParentHash chainhash.Hash
+	// ParentSubtree is the index of the subtree the parent is in
+	ParentSubtree int
+	// ParentIndex is the index of the parent in its subtree
+	ParentIndex int
+}
+
+// String returns a string representation of the violation.
+func (v TopologicalViolation) String() string {
+	return fmt.Sprintf("child %s at %d:%d appears before parent %s at %d:%d",
+		v.ChildHash.String(), v.ChildSubtree, v.ChildIndex,
+		v.ParentHash.String(), v.ParentSubtree, v.ParentIndex,
+	)
+}
+
+// nodePosition is the position of a node in an ordered list of subtrees.
+type nodePosition struct {
+	subtree int
+	index   int
+}
+
+// before returns true if p is ordered before o.
+func (p nodePosition) before(o nodePosition) bool {
+	if p.subtree != o.subtree {
+		return p.subtree < o.subtree
+	}
+
+	return p.index < o.index
+}
+
+// ValidateTopologicalOrder checks that every parent transaction recorded in the
+// metas appears before its child, both inside a subtree and across the ordered list
+// of subtrees. Parents that are not part of any of the subtrees are ignored, they
+// are expected to have been mined before.
+//
+// Parameters:
+//   - metas: The Meta objects of the subtrees, in block order
+//
+// Returns:
+//   - []TopologicalViolation: Every child-before-parent violation found, empty when the order is valid
+//   - error: An error if a meta or its subtree is not set
+func ValidateTopologicalOrder(metas []*Meta) ([]TopologicalViolation, error) {
+	positions, err := nodePositions(metas)
+	if err != nil {
+		return nil, err
+	}
+
+	violations := make([]TopologicalViolation, 0)
+
+	for i, meta := range metas {
+		for j, node := range meta.Subtree.Nodes {
+			if j >= len(meta.TxInpoints) {
+				break
+			}
+
+			child := nodePosition{subtree: i, index: j}
+
+			for _, parentHash := range meta.TxInpoints[j].ParentTxHashes {
+				parent, ok := positions[parentHash]
+				if !ok || parent.before(child) {
+					continue
+				}
+
+				violations = append(violations, TopologicalViolation{
+					ChildHash:     node.Hash,
+					ChildSubtree:  i,
+					ChildIndex:    j,
+					ParentHash:    parentHash,
+					ParentSubtree: parent.subtree,
+					ParentIndex:   parent.index,
+				})
+			}
+		}
+	}
+
+	return violations, nil
+}
+
+// SortTopologically re-orders the nodes of the subtree, and the matching TxInpoints
+// of the meta, in place so that every parent in the subtree appears before its
+// children. Nodes that are already in a valid position keep their relative order,
+// and the coinbase placeholder stays at index 0.
+//
+// Only dependencies inside this subtree can be fixed, violations across subtrees
+// need to be resolved by moving transactions between subtrees.
+//
+// Returns:
+//   - error: An error if the subtree is not set or the dependencies contain a cycle
+func (s *Meta) SortTopologically() error {
+	if s.Subtree == nil {
+		return ErrSubtreeNil
+	}
+
+	st := s.Subtree
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	length := len(st.Nodes)
+	if length > len(s.TxInpoints) {
+		return fmt.Errorf("%w: %d nodes, %d tx inpoints", ErrSubtreeLengthMismatch, length, len(s.TxInpoints))
+	}
+
+	index := make(map[chainhash.Hash]int, length)
+	for i, node := range st.Nodes {
+		index[node.Hash] = i
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		placed
+	)
+
+	state := make([]uint8, length)
+	order := make([]int, 0, length)
+
+	// depth-first search placing the parents of a node before it, with an explicit stack
+	// as the dependency chains can be as long as the subtree
+	type frame struct {
+		node   int
+		parent int // position of the next parent to visit in the TxInpoints of the node
+	}
+
+	stack := make([]frame, 0, 16)
+
+	for i := 0; i < length; i++ {
+		if state[i] != unvisited {
+			continue
+		}
+
+		state[i] = visiting
+		stack = append(stack[:0], frame{node: i})
+
+		for len(stack) > 0 {
+			top := &stack[len(stack)-1]
+			parents := s.TxInpoints[top.node].ParentTxHashes
+
+			if top.parent == len(parents) {
+				state[top.node] = placed
+				order = append(order, top.node)
+				stack = stack[:len(stack)-1]
+
+				continue
+			}
+
+			parentIdx, ok := index[parents[top.parent]]
+			top.parent++
+
+			if !ok {
+				continue
+			}
+
+			switch state[parentIdx] {
+			case visiting:
+				return fmt.Errorf("%w: %s", ErrTopologicalCycle, st.Nodes[parentIdx].Hash.String())
+			case unvisited:
+				state[parentIdx] = visiting
+				stack = append(stack, frame{node: parentIdx})
+			}
+		}
+	}
+
+	nodes := make([]Node, length)
+	txInpoints := make([]TxInpoints, length)
+
+	for newIdx, oldIdx := range order {
+		nodes[newIdx] = st.Nodes[oldIdx]
+		txInpoints[newIdx] = s.TxInpoints[oldIdx]
+	}
+
+	copy(st.Nodes, nodes)
+	copy(s.TxInpoints, txInpoints)
+
+	st.rootHash = nil // reset rootHash
+	st.nodeIndex = nil
+
+	return nil
+}
+
+// nodePositions maps every node of the subtrees of the metas to its position.
+func nodePositions(metas []*Meta) (map[chainhash.Hash]nodePosition, error) {
+	total := 0
+
+	for i, meta := range metas {
+		if meta == nil {
+			return nil, fmt.Errorf("meta %d: %w", i, ErrSubtreeMetaNil)
+		}
+
+		if meta.Subtree == nil {
+			return nil, fmt.Errorf("meta %d: %w", i, ErrSubtreeNil)
+		}
+
+		total += len(meta.Subtree.Nodes)
+	}
+
+	positions := make(map[chainhash.Hash]nodePosition, total)
+
+	for i, meta := range metas {
+		for j, node := range meta.Subtree.Nodes {
+			positions[node.Hash] = nodePosition{subtree: i, index: j}
+		}
+	}
+
+	return positions, nil
+}
@@ -0,0 +1,172 @@
+package subtree
+
+import (
+	"testing"
+
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildChainMeta creates a subtree with the given txids and a meta in which every
+// txid in parents[i] is set as parent of node i.
+func buildChainMeta(t *testing.T, leafCount int, hashes []chainhash.Hash, parents [][]chainhash.Hash) *Meta {
+	t.Helper()
+
+	st, err := NewTreeByLeafCount(leafCount)
+	require.NoError(t, err)
+
+	for i, hash := range hashes {
+		require.NoError(t, st.AddNode(hash, uint64(i), uint64(i)))
+	}
+
+	meta := NewSubtreeMeta(st)
+
+	for i := range hashes {
+		p := NewTxInpoints()
+		for _, parent := range parents[i] {
+			p.appendInput(parent, 0)
+		}
+
+		require.NoError(t, meta.SetTxInpoints(i, p))
+	}
+
+	return meta
+}
+
+func TestValidateTopologicalOrder(t *testing.T) {
+	h := make([]chainhash.Hash, 6)
+	for i := range h {
+		h[i] = chainhash.HashH([]byte{byte(i)})
+	}
+
+	external := chainhash.HashH([]byte("external"))
+
+	t.Run("valid order across subtrees", func(t *testing.T) {
+		meta1 := buildChainMeta(t, 4, h[0:3], [][]chainhash.Hash{{external}, {h[0]}, {h[1]}})
+		meta2 := buildChainMeta(t, 4, h[3:6], [][]chainhash.Hash{{h[2]}, {h[0], h[3]}, {external}})
+
+		violations, err := ValidateTopologicalOrder([]*Meta{meta1, meta2})
+		require.NoError(t, err)
+		assert.Empty(t, violations)
+	})
+
+	t.Run("reports violations inside and across subtrees", func(t *testing.T) {
+		meta1 := buildChainMeta(t, 4, h[0:3], [][]chainhash.Hash{{h[1]}, {external}, {h[4]}})
+		meta2 := buildChainMeta(t, 4, h[3:6], [][]chainhash.Hash{{external}, {h[3]}, {h[5]}})
+
+		violations, err := ValidateTopologicalOrder([]*Meta{meta1, meta2})
+		require.NoError(t, err)
+		require.Len(t, violations, 3)
+
+		assert.Equal(t, TopologicalViolation{
+			ChildHash: h[0], ChildSubtree: 0, ChildIndex: 0,
+			ParentHash: h[1], ParentSubtree: 0, ParentIndex: 1,
+		}, violations[0])
+		assert.Equal(t, TopologicalViolation{
+			ChildHash: h[2], ChildSubtree: 0, ChildIndex: 2,
+			ParentHash: h[4], ParentSubtree: 1, ParentIndex: 1,
+		}, violations[1])
+		assert.Equal(t, h[5], violations[2].ParentHash)
+		assert.Equal(t, h[5], violations[2].ChildHash)
+		assert.Contains(t, violations[0].String(), "appears before parent")
+	})
+
+	t.Run("nil meta", func(t *testing.T) {
+		_, err := ValidateTopologicalOrder([]*Meta{nil})
+		require.ErrorIs(t, err, ErrSubtreeMetaNil)
+	})
+
+	t.Run("nil subtree", func(t *testing.T) {
+		_, err := ValidateTopologicalOrder([]*Meta{{}})
+		require.ErrorIs(t, err, ErrSubtreeNil)
+	})
+}
+
+func TestMetaSortTopologically(t *testing.T) {
+	h := make([]chainhash.Hash, 5)
+	for i := range h {
+		h[i] = chainhash.HashH([]byte{byte(i)})
+	}
+
+	t.Run("reorders children after parents", func(t *testing.T) {
+		// h0 <- h2 <- h1, h3 independent, h4 spends h3 and h1
+		meta := buildChainMeta(t, 8,
+			[]chainhash.Hash{h[4], h[1], h[0], h[3], h[2]},
+			[][]chainhash.Hash{{h[3], h[1]}, {h[2]}, {}, {}, {h[0]}},
+		)
+		rootBefore := *meta.Subtree.RootHash()
+		feesBefore := meta.Subtree.Fees
+
+		require.NoError(t, meta.SortTopologically())
+
+		order := make([]chainhash.Hash, 0, 5)
+		for _, node := range meta.Subtree.Nodes {
+			order = append(order, node.Hash)
+		}
+
+		assert.Equal(t, []chainhash.Hash{h[3], h[0], h[2], h[1], h[4]}, order)
+		assert.Equal(t, []chainhash.Hash{h[3], h[1]}, meta.TxInpoints[4].ParentTxHashes)
+		assert.Equal(t, []chainhash.Hash{h[0]}, meta.TxInpoints[2].ParentTxHashes)
+		assert.NotEqual(t, rootBefore, *meta.Subtree.RootHash())
+		assert.Equal(t, feesBefore, meta.Subtree.Fees)
+		assert.Equal(t, 1, meta.Subtree.NodeIndex(h[0]))
+
+		violations, err := ValidateTopologicalOrder([]*Meta{meta})
+		require.NoError(t, err)
+		assert.Empty(t, violations)
+	})
+
+	t.Run("keeps valid order and coinbase placeholder", func(t *testing.T) {
+		st, err := NewTreeByLeafCount(4)
+		require.NoError(t, err)
+		require.NoError(t, st.AddCoinbaseNode())
+		require.NoError(t, st.AddNode(h[0], 1, 1))
+		require.NoError(t, st.AddNode(h[1], 1, 1))
+
+		meta := NewSubtreeMeta(st)
+		require.NoError(t, meta.SetTxInpoints(2, txInpointsFromParentVouts(h[0], 0)))
+		require.NoError(t, meta.SetTxInpoints(1, NewTxInpoints()))
+
+		require.NoError(t, meta.SortTopologically())
+
+		assert.Equal(t, CoinbasePlaceholderHashValue, st.Nodes[0].Hash)
+		assert.Equal(t, h[0], st.Nodes[1].Hash)
+		assert.Equal(t, h[1], st.Nodes[2].Hash)
+	})
+
+	t.Run("long dependency chain", func(t *testing.T) {
+		const count = 1 << 14
+
+		// every transaction spends the one after it, the sorted order is reversed
+		hashes := make([]chainhash.Hash, count)
+		for i := range hashes {
+			hashes[i] = chainhash.HashH([]byte{byte(i), byte(i >> 8), 'c'})
+		}
+
+		parents := make([][]chainhash.Hash, count)
+		for i := 0; i < count-1; i++ {
+			parents[i] = []chainhash.Hash{hashes[i+1]}
+		}
+
+		meta := buildChainMeta(t, count, hashes, parents)
+
+		require.NoError(t, meta.SortTopologically())
+
+		for i, node := range meta.Subtree.Nodes {
+			require.Equal(t, hashes[count-1-i], node.Hash)
+		}
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		meta := buildChainMeta(t, 4, h[0:2], [][]chainhash.Hash{{h[1]}, {h[0]}})
+
+		err := meta.SortTopologically()
+		require.ErrorIs(t, err, ErrTopologicalCycle)
+	})
+
+	t.Run("nil subtree", func(t *testing.T) {
+		meta := &Meta{}
+		require.ErrorIs(t, meta.SortTopologically(), ErrSubtreeNil)
+	})
+}
@@ -0,0 +1,395 @@
+package subtree
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/bsv-blockchain/go-bt/v2"
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+)
+
+// extendedFormatMarker is the marker following the version of a transaction in the
+// Extended Format (BIP-239).
+var extendedFormatMarker = [6]byte{0x00, 0x00, 0x00, 0x00, 0x00, 0xEF}
+
+// txScanner walks the fields of a serialized transaction without parsing it into a
+// bt.Tx. It does not allocate and checks the bounds of every field, a malformed
+// transaction results in an error wrapping io.ErrUnexpectedEOF.
+type txScanner struct {
+	b   []byte
+	pos int
+}
+
+// scanTxLength returns the length of the serialized transaction, in standard or
+// Extended Format, at the start of b.
+func scanTxLength(b []byte) (int, error) {
+	s := txScanner{b: b}
+
+	extended, err := s.header()
+	if err != nil {
+		return 0, err
+	}
+
+	inputCount, err := s.varInt()
+	if err != nil {
+		return 0, err
+	}
+
+	for i := uint64(0); i < inputCount; i++ {
+		if _, _, _, err = s.input(extended); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = s.outputs(); err != nil {
+		return 0, err
+	}
+
+	// lock time
+	if err = s.skip(4); err != nil {
+		return 0, err
+	}
+
+	return s.pos, nil
+}
+
+// scannedTx holds the fields of a serialized transaction found by scanTx.
+type scannedTx struct {
+	inpoints TxInpoints
+	txid     chainhash.Hash
+	length   int
+	coinbase bool
+}
+
+// scanTx walks the serialized transaction, in standard or Extended Format, at the start
+// of b and collects the outpoints spent by its inputs, without parsing any scripts. When
+// withTxID is set, the txid is calculated over the standard serialization of the
+// transaction, also for a transaction in Extended Format.
+func scanTx(b []byte, withTxID bool) (scannedTx, error) {
+	var (
+		tx  scannedTx
+		err error
+	)
+
+	s := txScanner{b: b}
+
+	extended, err := s.header()
+	if err != nil {
+		return tx, err
+	}
+
+	inputCountPos := s.pos
+
+	inputCount, err := s.varInt()
+	if err != nil {
+		return tx, err
+	}
+
+	// every input takes at least 41 bytes, the count is not trusted before that
+	n := int(Min(inputCount, uint64(len(b)-s.pos)/41)) //nolint:gosec // G115: bounded by len(b)
+	if n > 0 {
+		tx.inpoints = TxInpoints{
+			ParentTxHashes: make([]chainhash.Hash, 0, n),
+			voutIdxs:       make([]uint32, 0, 2*n),
+		}
+	}
+
+	var hasher hashWriter
+	if withTxID {
+		hasher.init()
+		// version and input count, without the Extended Format marker
+		hasher.write(b[:4])
+		hasher.write(b[inputCountPos:s.pos])
+	}
+
+	var (
+		prevTxIDPos int
+		vout        uint32
+		sequence    uint32
+	)
+
+	for i := uint64(0); i < inputCount; i++ {
+		inputPos := s.pos
+
+		if prevTxIDPos, vout, sequence, err = s.input(false); err != nil {
+			return tx, err
+		}
+
+		hasher.write(b[inputPos:s.pos])
+
+		if extended {
+			// previous satoshis and previous locking script, not part of the txid
+			if err = s.skip(8); err != nil {
+				return tx, err
+			}
+
+			if err = s.script(); err != nil {
+				return tx, err
+			}
+		}
+
+		prevTxID := chainhash.Hash(b[prevTxIDPos : prevTxIDPos+32])
+		tx.inpoints.appendInput(prevTxID, vout)
+
+		// the same rule as bt.Tx.IsCoinbase
+		if inputCount == 1 && prevTxID.IsEqual(&chainhash.Hash{}) &&
+			(vout == bt.DefaultSequenceNumber || sequence == bt.DefaultSequenceNumber) {
+			tx.coinbase = true
+		}
+	}
+
+	outputsPos := s.pos
+
+	if err = s.outputs(); err != nil {
+		return tx, err
+	}
+
+	// lock time
+	if err = s.skip(4); err != nil {
+		return tx, err
+	}
+
+	tx.length = s.pos
+
+	if withTxID {
+		hasher.write(b[outputsPos:s.pos])
+		tx.txid = hasher.sum()
+	}
+
+	return tx, nil
+}
+
+// header skips the version and the Extended Format marker, and returns whether the
+// transaction is in Extended Format.
+func (s *txScanner) header() (bool, error) {
+	if err := s.skip(4); err != nil {
+		return false, err
+	}
+
+	if len(s.b)-s.pos >= len(extendedFormatMarker) && [6]byte(s.b[s.pos:s.pos+6]) == extendedFormatMarker {
+		s.pos += len(extendedFormatMarker)
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// input skips an input and returns the offset of its previous txid, its previous
+// output index and its sequence number.
+func (s *txScanner) input(extended bool) (int, uint32, uint32, error) {
+	prevTxIDPos := s.pos
+
+	// previous txid and output index
+	if err := s.skip(32 + 4); err != nil {
+		return 0, 0, 0, err
+	}
+
+	vout := binary.LittleEndian.Uint32(s.b[s.pos-4 : s.pos])
+
+	// unlocking script
+	if err := s.script(); err != nil {
+		return 0, 0, 0, err
+	}
+
+	// sequence number
+	if err := s.skip(4); err != nil {
+		return 0, 0, 0, err
+	}
+
+	sequence := binary.LittleEndian.Uint32(s.b[s.pos-4 : s.pos])
+
+	if extended {
+		// previous satoshis and previous locking script
+		if err := s.skip(8); err != nil {
+			return 0, 0, 0, err
+		}
+
+		if err := s.script(); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+
+	return prevTxIDPos, vout, sequence, nil
+}
+
+// outputs skips the output count and all outputs.
+func (s *txScanner) outputs() error {
+	outputCount, err := s.varInt()
+	if err != nil {
+		return err
+	}
+
+	for i := uint64(0); i < outputCount; i++ {
+		// satoshis
+		if err = s.skip(8); err != nil {
+			return err
+		}
+
+		if err = s.script(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// script skips a varint length prefixed script.
+func (s *txScanner) script() error {
+	length, err := s.varInt()
+	if err != nil {
+		return err
+	}
+
+	if length > uint64(len(s.b)-s.pos) {
+		return s.errShort()
+	}
+
+	s.pos += int(length) //nolint:gosec // G115: length is bounded by len(s.b)
+
+	return nil
+}
+
+// varInt reads a Bitcoin compact size unsigned integer.
+func (s *txScanner) varInt() (uint64, error) {
+	if s.pos >= len(s.b) {
+		return 0, s.errShort()
+	}
+
+	prefix := s.b[s.pos]
+	s.pos++
+
+	var size int
+
+	switch prefix {
+	case 0xfd:
+		size = 2
+	case 0xfe:
+		size = 4
+	case 0xff:
+		size = 8
+	default:
+		return uint64(prefix), nil
+	}
+
+	if err := s.skip(size); err != nil {
+		return 0, err
+	}
+
+	v := s.b[s.pos-size : s.pos]
+
+	switch size {
+	case 2:
+		return uint64(binary.LittleEndian.Uint16(v)), nil
+	case 4:
+		return uint64(binary.LittleEndian.Uint32(v)), nil
+	default:
+		return binary.LittleEndian.Uint64(v), nil
+	}
+}
+
+// skip advances the position by n bytes.
+func (s *txScanner) skip(n int) error {
+	if n > len(s.b)-s.pos {
+		return s.errShort()
+	}
+
+	s.pos += n
+
+	return nil
+}
+
+// errShort returns the error for a transaction that ends before all fields are read.
+func (s *txScanner) errShort() error {
+	return fmt.Errorf("transaction truncated at byte %d: %w", s.pos, io.ErrUnexpectedEOF)
+}
+
+// hashWriter calculates the double sha256 of data written in parts. The zero value
+// ignores all writes.
+type hashWriter struct {
+	h hash.Hash
+}
+
+// init starts a new hash.
+func (w *hashWriter) init() {
+	w.h = sha256.New()
+}
+
+// write adds b to the hash.
+func (w *hashWriter) write(b []byte) {
+	if w.h != nil {
+		_, _ = w.h.Write(b)
+	}
+}
+
+// sum returns the double sha256 of everything written.
+func (w *hashWriter) sum() chainhash.Hash {
+	var first [sha256.Size]byte
+
+	w.h.Sum(first[:0])
+
+	return sha256.Sum256(first[:])
+}
+
+// rawTxReader reads the serialized transactions of a stream one at a time, as raw
+// bytes, using txScanner to find where every transaction ends.
+type rawTxReader struct {
+	r     io.Reader
+	buf   []byte
+	start int
+	end   int
+	eof   bool
+}
+
+// newRawTxReader creates a new rawTxReader for the stream.
+func newRawTxReader(r io.Reader) *rawTxReader {
+	return &rawTxReader{
+		r:   r,
+		buf: make([]byte, 32*1024), // 32KB buffer, grown for larger transactions
+	}
+}
+
+// next returns the bytes of the next transaction, which are only valid until the next
+// call. At the end of the stream io.EOF is returned, for a stream ending in the middle
+// of a transaction an error wrapping io.ErrUnexpectedEOF.
+func (r *rawTxReader) next() ([]byte, error) {
+	for {
+		if r.start < r.end {
+			length, err := scanTxLength(r.buf[r.start:r.end])
+			if err == nil {
+				tx := r.buf[r.start : r.start+length]
+				r.start += length
+
+				return tx, nil
+			}
+
+			if r.eof || !errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, err
+			}
+		} else if r.eof {
+			return nil, io.EOF
+		}
+
+		// the transaction is incomplete, read more of the stream
+		if r.start > 0 {
+			r.end = copy(r.buf, r.buf[r.start:r.end])
+			r.start = 0
+		}
+
+		if r.end == len(r.buf) {
+			r.buf = append(r.buf, make([]byte, len(r.buf))...)
+		}
+
+		n, err := r.r.Read(r.buf[r.end:])
+		r.end += n
+
+		if errors.Is(err, io.EOF) {
+			r.eof = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package subtree
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/bsv-blockchain/go-bt/v2"
+	"github.com/bsv-blockchain/go-bt/v2/chainhash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sequenceCoinbaseTx is a coinbase transaction whose input only has the final sequence
+// number, its previous output index is not 0xffffffff.
+var sequenceCoinbaseTx = func() *bt.Tx {
+	cb := coinbaseTx.Clone()
+	cb.Inputs[0].PreviousTxOutIndex = 0
+
+	return cb
+}()
+
+func TestScanTxLength(t *testing.T) {
+	t.Run("standard and extended format", func(t *testing.T) {
+		for _, b := range [][]byte{tx.Bytes(), tx.ExtendedBytes(), coinbaseTx.Bytes()} {
+			length, err := scanTxLength(append(b, 0x01, 0x02))
+			require.NoError(t, err)
+			assert.Equal(t, len(b), length)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		b := tx.ExtendedBytes()
+
+		for _, l := range []int{0, 3, 5, 10, 50, len(b) - 1} {
+			_, err := scanTxLength(b[:l])
+			require.Error(t, err)
+		}
+	})
+
+	t.Run("large varint", func(t *testing.T) {
+		s := txScanner{b: []byte{0xfd, 0x01, 0x02, 0xfe, 0x01, 0, 0, 0, 0xff, 1, 0, 0, 0, 0, 0, 0, 0}}
+
+		v, err := s.varInt()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0x0201), v)
+
+		v, err = s.varInt()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), v)
+
+		v, err = s.varInt()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), v)
+
+		_, err = s.varInt()
+		require.Error(t, err)
+	})
+}
+
+func TestScanTx(t *testing.T) {
+	t.Run("txid of standard and extended format", func(t *testing.T) {
+		for _, b := range [][]byte{tx.Bytes(), tx.ExtendedBytes()} {
+			scanned, err := scanTx(b, true)
+			require.NoError(t, err)
+			assert.Equal(t, *tx.TxIDChainHash(), scanned.txid)
+			assert.Equal(t, len(b), scanned.length)
+			assert.False(t, scanned.coinbase)
+		}
+	})
+
+	t.Run("coinbase", func(t *testing.T) {
+		scanned, err := scanTx(coinbaseTx.Bytes(), true)
+		require.NoError(t, err)
+		assert.True(t, scanned.coinbase)
+		assert.Equal(t, *coinbaseTx.TxIDChainHash(), scanned.txid)
+	})
+
+	t.Run("without txid", func(t *testing.T) {
+		scanned, err := scanTx(tx.ExtendedBytes(), false)
+		require.NoError(t, err)
+		assert.Equal(t, chainhash.Hash{}, scanned.txid)
+	})
+
+	t.Run("input count larger than the data", func(t *testing.T) {
+		// version, 0xff input count, no inputs
+		b := []byte{1, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}
+
+		_, err := scanTx(b, false)
+		require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+}
+
+func TestRawTxReader(t *testing.T) {
+	t.Run("reads transactions across small reads", func(t *testing.T) {
+		_, b := buildLargeTestData(t, 10)
+		r := newRawTxReader(iotest.OneByteReader(bytes.NewReader(b)))
+
+		pos := 0
+
+		for {
+			txBytes, err := r.next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, b[pos:pos+len(txBytes)], txBytes)
+			pos += len(txBytes)
+		}
+
+		assert.Equal(t, len(b), pos)
+	})
+
+	t.Run("grows the buffer for large transactions", func(t *testing.T) {
+		_, b := buildLargeTestData(t, 10)
+		r := newRawTxReader(bytes.NewReader(b))
+		r.buf = make([]byte, 16)
+
+		total := 0
+
+		for {
+			txBytes, err := r.next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			require.NoError(t, err)
+			total += len(txBytes)
+		}
+
+		assert.Equal(t, len(b), total)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		_, b := buildLargeTestData(t, 2)
+		r := newRawTxReader(bytes.NewReader(b[:len(b)-3]))
+
+		_, err := r.next()
+		require.NoError(t, err)
+
+		_, err = r.next()
+		require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+}
+
+func TestScanTxMatchesBt(t *testing.T) {
+	notCoinbase := coinbaseTx.Clone()
+	notCoinbase.Inputs[0].PreviousTxOutIndex = 0
+	notCoinbase.Inputs[0].SequenceNumber = 0
+
+	_, dataBytes := buildLargeTestData(t, 3)
+
+	txs := []*bt.Tx{tx, coinbaseTx, sequenceCoinbaseTx, notCoinbase}
+
+	for r := newRawTxReader(bytes.NewReader(dataBytes)); ; {
+		b, err := r.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		require.NoError(t, err)
+
+		parsed, err := bt.NewTxFromBytes(b)
+		require.NoError(t, err)
+
+		txs = append(txs, parsed)
+	}
+
+	for i, btTx := range txs {
+		for _, b := range [][]byte{btTx.Bytes(), btTx.ExtendedBytes()} {
+			parsed, err := bt.NewTxFromBytes(b)
+			require.NoError(t, err)
+
+			scanned, err := scanTx(b, true)
+			require.NoError(t, err)
+
+			expected, err := NewTxInpointsFromTx(parsed)
+			require.NoError(t, err)
+
+			assert.Equal(t, expected, scanned.inpoints, "tx %d", i)
+			assert.Equal(t, *parsed.TxIDChainHash(), scanned.txid, "tx %d", i)
+			assert.Equal(t, parsed.IsCoinbase(), scanned.coinbase, "tx %d", i)
+			assert.Equal(t, len(b), scanned.length, "tx %d", i)
+		}
+	}
+
+	assert.True(t, sequenceCoinbaseTx.IsCoinbase())
+	assert.False(t, notCoinbase.IsCoinbase())
+}